@@ -1,78 +1,74 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
-	"strings"
+	"os"
+	"strconv"
+	"time"
 
 	"backend/internal/auth"
+	"backend/internal/crosspost"
 	"backend/internal/database"
 	"backend/internal/handlers"
 	"backend/internal/middleware"
+	"backend/internal/router"
+	"backend/internal/storage"
+	"backend/internal/store"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
 	database.InitDB()
-	auth.InitSessionStore()
+	stores := store.NewPostgres(database.DB)
+	auth.InitSessionStore(stores.Sessions)
+	auth.InitProviders()
 
-	mux := http.NewServeMux()
+	// Background workers delivering queued cross-posts
+	workers, err := strconv.Atoi(os.Getenv("CROSSPOST_WORKERS"))
+	if err != nil || workers < 1 {
+		workers = 2
+	}
+	crosspost.StartWorkers(context.Background(), workers, stores.Crossposts, stores.Connections)
 
-	// Auth routes
-	mux.HandleFunc("/auth/spotify", auth.HandleSpotifyLogin)
-	mux.HandleFunc("/auth/spotify/callback", auth.HandleSpotifyCallback)
-	mux.HandleFunc("/auth/twitter", auth.HandleTwitterLogin)
-	mux.HandleFunc("/auth/twitter/callback", auth.HandleTwitterCallback)
-	mux.HandleFunc("/auth/logout", auth.HandleLogout)
-	mux.HandleFunc("/auth/me", auth.HandleGetCurrentUser)
-	mux.HandleFunc("/auth/profile", auth.HandleUpdateProfile)
-	
-	// Upload routes
-	mux.HandleFunc("/api/upload/image", handlers.UploadImage)
-	
-	// Twitter integration routes
-	mux.HandleFunc("/api/twitter/check", handlers.CheckTwitterConnection)
-	mux.HandleFunc("/api/twitter/disconnect", handlers.DisconnectTwitter)
-	
-	// Static file serving for uploads
-	fs := http.FileServer(http.Dir("./uploads"))
-	mux.Handle("/uploads/", http.StripPrefix("/uploads/", fs))
-	
-	// API routes
-	mux.HandleFunc("/api/posts", func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case "GET":
-			handlers.GetPosts(w, r)
-		case "POST":
-			handlers.CreatePost(w, r)
-		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	})
+	blobs, err := storage.FromEnv(context.Background())
+	if err != nil {
+		log.Fatal("Failed to set up upload storage: ", err)
+	}
+
+	api := handlers.NewHandler(stores, blobs)
+	authAPI := auth.NewHandler(stores, blobs)
+	authenticator := &auth.Authenticator{Tokens: stores.Tokens, Sessions: auth.Store}
 
-	mux.HandleFunc("/api/posts/", func(w http.ResponseWriter, r *http.Request) {
-		path := r.URL.Path
-		switch {
-		case strings.HasSuffix(path, "/like") && r.Method == "POST":
-			handlers.ToggleLike(w, r)
-		case strings.HasSuffix(path, "/reply") && r.Method == "POST":
-			handlers.CreateReply(w, r)
-		case strings.HasSuffix(path, "/replies") && r.Method == "GET":
-			handlers.GetReplies(w, r)
-		default:
-			http.NotFound(w, r)
+	// Purge accounts whose deletion grace period has passed
+	go func() {
+		for {
+			api.PurgeDueAccounts(context.Background())
+			time.Sleep(time.Hour)
 		}
-	})
+	}()
 
-	mux.HandleFunc("/api/search/posts", handlers.SearchPosts)
-	mux.HandleFunc("/api/search/users", handlers.SearchUsers)
+	// Delete uploads nothing has linked to within the grace period
+	go func() {
+		for {
+			api.SweepOrphanUploads(context.Background())
+			time.Sleep(time.Hour)
+		}
+	}()
 
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprintf(w, "OK")
-	})
+	if auth.DevLoginEnabled() {
+		log.Println("WARNING: dev login is enabled at /auth/dev, do not use in production")
+	}
+	mux := router.New(router.Routes(api, authAPI))
 
 	fmt.Println("Server starting on :8080")
-	if err := http.ListenAndServe(":8080", middleware.CORS(mux)); err != nil {
+	if err := http.ListenAndServe(":8080", middleware.RequestID(middleware.CORS(middleware.CSRF(authenticator.Middleware(mux))))); err != nil {
 		log.Fatal(err)
 	}
 }
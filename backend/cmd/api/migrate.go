@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"backend/internal/database"
+)
+
+const migrateUsage = `usage: main migrate <command>
+
+commands:
+  up          apply all pending migrations
+  down [n]    revert the last n applied migrations (default 1)
+  status      list migrations and when they were applied`
+
+// runMigrate implements the "migrate" subcommand
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+
+	database.Connect()
+	defer database.DB.Close()
+
+	switch args[0] {
+	case "up":
+		if err := database.MigrateUp(database.DB); err != nil {
+			log.Fatal(err)
+		}
+		log.Println("Database is up to date")
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				fmt.Fprintln(os.Stderr, migrateUsage)
+				os.Exit(2)
+			}
+			steps = n
+		}
+		if err := database.MigrateDown(database.DB, steps); err != nil {
+			log.Fatal(err)
+		}
+	case "status":
+		statuses, err := database.GetMigrationStatus(database.DB)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-40s %s\n", s.Version, s.Name, applied)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,173 @@
+package apierror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// Code is a machine-readable error code clients can switch on
+type Code string
+
+const (
+	CodeBadRequest       Code = "bad_request"
+	CodeValidation       Code = "validation_failed"
+	CodeUnauthorized     Code = "unauthorized"
+	CodeForbidden        Code = "forbidden"
+	CodeNotFound         Code = "not_found"
+	CodeMethodNotAllowed Code = "method_not_allowed"
+	CodeConflict         Code = "conflict"
+	CodeTooLarge         Code = "payload_too_large"
+	CodeQuotaExceeded    Code = "quota_exceeded"
+	CodeUnavailable      Code = "service_unavailable"
+	CodeInternal         Code = "internal_error"
+)
+
+// FieldError describes why one field of the request was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is an error response of the API. Status, Code, Message and Fields
+// are shown to the client; Err is the internal cause and is only logged.
+type Error struct {
+	Status  int
+	Code    Code
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// New returns an error with the given status, code and client message
+func New(status int, code Code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// BadRequest is a request that could not be understood, e.g. malformed JSON
+func BadRequest(message string) *Error {
+	return New(http.StatusBadRequest, CodeBadRequest, message)
+}
+
+// Invalid is a request with one invalid field
+func Invalid(field, message string) *Error {
+	return Validation(FieldError{Field: field, Message: message})
+}
+
+// Validation is a request with one or more invalid fields
+func Validation(fields ...FieldError) *Error {
+	e := New(http.StatusBadRequest, CodeValidation, "Invalid request")
+	if len(fields) == 1 {
+		e.Message = fields[0].Message
+	}
+	e.Fields = fields
+	return e
+}
+
+// Unauthorized is a request without valid credentials
+func Unauthorized(message string) *Error {
+	return New(http.StatusUnauthorized, CodeUnauthorized, message)
+}
+
+// Forbidden is a request whose credentials do not allow the action
+func Forbidden(message string) *Error {
+	return New(http.StatusForbidden, CodeForbidden, message)
+}
+
+// NotFound is a request for a resource that does not exist
+func NotFound(message string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, message)
+}
+
+// Conflict is a request that conflicts with the current state
+func Conflict(message string) *Error {
+	return New(http.StatusConflict, CodeConflict, message)
+}
+
+// TooLarge is a request whose body exceeds the allowed size
+func TooLarge(message string) *Error {
+	return New(http.StatusRequestEntityTooLarge, CodeTooLarge, message)
+}
+
+// QuotaExceeded is a request that would take the user past a storage quota
+func QuotaExceeded(message string) *Error {
+	return New(http.StatusRequestEntityTooLarge, CodeQuotaExceeded, message)
+}
+
+// Unavailable is a request that cannot be served right now
+func Unavailable(message string, err error) *Error {
+	e := New(http.StatusServiceUnavailable, CodeUnavailable, message)
+	e.Err = err
+	return e
+}
+
+// Internal wraps an unexpected server-side failure. Its cause is logged and
+// never shown to the client.
+func Internal(err error) *Error {
+	e := New(http.StatusInternalServerError, CodeInternal, "Internal server error")
+	e.Err = err
+	return e
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns ctx carrying the ID of the request being served
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the ID stored by WithRequestID, if any
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+type envelope struct {
+	Error body `json:"error"`
+}
+
+type body struct {
+	Code      Code         `json:"code"`
+	Message   string       `json:"message"`
+	Fields    []FieldError `json:"fields,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+// Write renders err as {"error": {"code", "message", "fields", "request_id"}}.
+// An err that is not an *Error is treated as Internal. Server errors are
+// logged with their cause and the request ID.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	var e *Error
+	if !errors.As(err, &e) {
+		e = Internal(err)
+	}
+
+	requestID := RequestID(r.Context())
+	if e.Status >= http.StatusInternalServerError {
+		log.Printf("[%s] %s %s: %v", requestID, r.Method, r.URL.Path, e)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(e.Status)
+	json.NewEncoder(w).Encode(envelope{Error: body{
+		Code:      e.Code,
+		Message:   e.Message,
+		Fields:    e.Fields,
+		RequestID: requestID,
+	}})
+}
@@ -0,0 +1,48 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		status  int
+		code    Code
+		message string
+	}{
+		{"not found", NotFound("Post not found"), http.StatusNotFound, CodeNotFound, "Post not found"},
+		{"validation", Invalid("tags", "Too many tags"), http.StatusBadRequest, CodeValidation, "Too many tags"},
+		{"wrapped", errors.Join(errors.New("context"), Conflict("Taken")), http.StatusConflict, CodeConflict, "Taken"},
+		{"internal", errors.New(`pq: relation "posts" does not exist`), http.StatusInternalServerError, CodeInternal, "Internal server error"},
+		{"internal with cause", Internal(errors.New("disk full")), http.StatusInternalServerError, CodeInternal, "Internal server error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/posts", nil)
+			req = req.WithContext(WithRequestID(req.Context(), "req-1"))
+			rec := httptest.NewRecorder()
+			Write(rec, req, tt.err)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			var got envelope
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Error.Code != tt.code || got.Error.Message != tt.message || got.Error.RequestID != "req-1" {
+				t.Errorf("error = %+v, want code %q, message %q and request ID", got.Error, tt.code, tt.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"backend/internal/apierror"
+	"backend/internal/models"
+	"backend/internal/store"
+	"backend/internal/utils"
+	"context"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+const (
+	// AccessTokenPrefix marks Otogram personal access tokens
+	AccessTokenPrefix = "otg_"
+	// DefaultAccessTokenDays is the lifetime of a token created without one
+	DefaultAccessTokenDays = 30
+	// MaxAccessTokenDays caps the lifetime of a token
+	MaxAccessTokenDays = 365
+)
+
+func hashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueAccessToken creates a personal access token. The returned token
+// carries the secret, which is not stored and cannot be recovered later.
+func IssueAccessToken(ctx context.Context, tokens store.TokenStore, userID int, name string, scopes []string, expiresAt time.Time) (*models.AccessToken, error) {
+	secret := AccessTokenPrefix + strings.ToLower(strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "="))
+	token := models.AccessToken{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    secret[:len(AccessTokenPrefix)+6],
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+		Token:     secret,
+	}
+
+	if err := tokens.Create(ctx, &token, hashAccessToken(secret)); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// HandleListAccessTokens lists the current user's personal access tokens
+func (h *Handler) HandleListAccessTokens(w http.ResponseWriter, r *http.Request) {
+	userID, ok := RequireSession(w, r)
+	if !ok {
+		return
+	}
+
+	tokens, err := h.Tokens.List(r.Context(), userID)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// HandleCreateAccessToken issues a personal access token. The secret is only
+// returned in this response.
+func (h *Handler) HandleCreateAccessToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := RequireSession(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, r, apierror.BadRequest("Invalid request body"))
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		apierror.Write(w, r, apierror.Invalid("name", "Name is required (max 100 characters)"))
+		return
+	}
+	if len(req.Scopes) == 0 {
+		apierror.Write(w, r, apierror.Invalid("scopes", "At least one scope is required"))
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !validScope(scope) {
+			apierror.Write(w, r, apierror.Invalid("scopes", "Unknown scope: "+scope))
+			return
+		}
+	}
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = DefaultAccessTokenDays
+	}
+	if req.ExpiresInDays < 1 || req.ExpiresInDays > MaxAccessTokenDays {
+		apierror.Write(w, r, apierror.Invalid("expires_in_days", "expires_in_days must be between 1 and "+strconv.Itoa(MaxAccessTokenDays)))
+		return
+	}
+
+	token, err := IssueAccessToken(r.Context(), h.Tokens, userID, req.Name, req.Scopes, time.Now().AddDate(0, 0, req.ExpiresInDays))
+	if err != nil {
+		apierror.Write(w, r, fmt.Errorf("create access token: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(token)
+}
+
+// HandleRevokeAccessToken deletes one of the current user's tokens, e.g.
+// DELETE /api/tokens/3
+func (h *Handler) HandleRevokeAccessToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := RequireSession(w, r)
+	if !ok {
+		return
+	}
+
+	tokenID, ok := utils.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	err := h.Tokens.Revoke(r.Context(), userID, tokenID)
+	if err == store.ErrNotFound {
+		apierror.Write(w, r, apierror.NotFound("Token not found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Token revoked successfully",
+	})
+}
+
+func validScope(scope string) bool {
+	for _, s := range AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
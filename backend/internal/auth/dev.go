@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"backend/internal/apierror"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DevProviderName is the provider recorded for users created on the dev
+// login page
+const DevProviderName = "dev"
+
+// DevLoginEnabled reports whether the local development login is turned on.
+// It must never be enabled in production: anyone can log in as anyone.
+func DevLoginEnabled() bool {
+	return os.Getenv("DEV_LOGIN_ENABLED") == "true"
+}
+
+var devLoginPage = template.Must(template.New("dev").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Otogram dev login</title></head>
+<body style="font-family: sans-serif; max-width: 40em; margin: 2em auto">
+<h1>Otogram dev login</h1>
+<p>Development only. No external OAuth provider is contacted.</p>
+
+<h2>Log in as an existing user</h2>
+{{if .Users}}
+<form method="post" action="/auth/dev/callback">
+{{range .Users}}
+<p><button name="user_id" value="{{.ID}}">#{{.ID}} {{if .DisplayName}}{{.DisplayName}}{{else}}(no name){{end}}</button> <small>{{.OAuthProvider}}:{{.OAuthID}}</small></p>
+{{end}}
+</form>
+{{else}}
+<p>No users yet.</p>
+{{end}}
+
+<h2>Create a user</h2>
+<form method="post" action="/auth/dev/callback">
+<p><label>Username <input name="username" required pattern="[A-Za-z0-9_.-]+"></label></p>
+<p><button>Log in</button></p>
+</form>
+</body>
+</html>
+`))
+
+// HandleDevLogin renders the fake authorize page listing existing users
+func (h *Handler) HandleDevLogin(w http.ResponseWriter, r *http.Request) {
+	if !DevLoginEnabled() {
+		apierror.Write(w, r, apierror.NotFound("Not found"))
+		return
+	}
+
+	users, err := h.Users.List(r.Context(), 100)
+	if err != nil {
+		apierror.Write(w, r, fmt.Errorf("list users for dev login: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	devLoginPage.Execute(w, map[string]interface{}{"Users": users})
+}
+
+// HandleDevCallback logs in as the chosen user, or creates a "dev" user for
+// a new username, through the same path as the OAuth callbacks. Integration
+// tests can POST user_id or username here to obtain a session cookie.
+func (h *Handler) HandleDevCallback(w http.ResponseWriter, r *http.Request) {
+	if !DevLoginEnabled() {
+		apierror.Write(w, r, apierror.NotFound("Not found"))
+		return
+	}
+	var provider string
+	var profile Profile
+
+	if idStr := r.FormValue("user_id"); idStr != "" {
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			apierror.Write(w, r, apierror.Invalid("user_id", "Invalid user ID"))
+			return
+		}
+		// Log in through the user's own primary identity so the existing
+		// account is found instead of a new one being created
+		user, err := h.Users.Get(r.Context(), id)
+		if err != nil {
+			apierror.Write(w, r, apierror.NotFound("User not found"))
+			return
+		}
+		provider = user.OAuthProvider
+		profile = Profile{ID: user.OAuthID, DisplayName: user.DisplayName, ProfileImage: user.ProfileImage}
+	} else {
+		username := strings.TrimSpace(r.FormValue("username"))
+		if username == "" || strings.ContainsAny(username, " /") {
+			apierror.Write(w, r, apierror.Invalid("username", "Username is required"))
+			return
+		}
+		provider = DevProviderName
+		profile = Profile{ID: username}
+	}
+
+	h.completeLogin(w, r, oauthFlow{}, provider, profile, nil)
+}
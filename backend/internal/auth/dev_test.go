@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"backend/internal/models"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestDevLoginDisabledByDefault(t *testing.T) {
+	t.Setenv("DEV_LOGIN_ENABLED", "")
+	api, _ := newSessionTest(t)
+
+	for _, h := range []http.HandlerFunc{api.HandleDevLogin, api.HandleDevCallback} {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodPost, "/auth/dev/callback", nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestDevCallbackValidation(t *testing.T) {
+	t.Setenv("DEV_LOGIN_ENABLED", "true")
+	api, _ := newSessionTest(t)
+
+	tests := []struct {
+		name   string
+		method string
+		form   url.Values
+		want   int
+	}{
+		{"missing username", http.MethodPost, url.Values{}, http.StatusBadRequest},
+		{"username with slash", http.MethodPost, url.Values{"username": {"a/b"}}, http.StatusBadRequest},
+		{"invalid user id", http.MethodPost, url.Values{"user_id": {"abc"}}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/auth/dev/callback", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			api.HandleDevCallback(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestDevCallbackLogsIn(t *testing.T) {
+	t.Setenv("DEV_LOGIN_ENABLED", "true")
+	api, authenticator := newSessionTest(t)
+	ctx := context.Background()
+
+	devLogin := func() *http.Cookie {
+		t.Helper()
+		form := url.Values{"username": {"carol"}}
+		req := httptest.NewRequest(http.MethodPost, "/auth/dev/callback", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		api.HandleDevCallback(rec, req)
+		if rec.Code != http.StatusSeeOther {
+			t.Fatalf("status = %d, want %d", rec.Code, http.StatusSeeOther)
+		}
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == GetSessionCookieName() {
+				return c
+			}
+		}
+		t.Fatal("no session cookie set")
+		return nil
+	}
+	currentUser := func(cookie *http.Cookie) models.User {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/auth/me", nil)
+		req.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		authenticator.Middleware(http.HandlerFunc(api.HandleGetCurrentUser)).ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /auth/me status = %d, want %d", rec.Code, http.StatusOK)
+		}
+		var user models.User
+		if err := json.NewDecoder(rec.Body).Decode(&user); err != nil {
+			t.Fatal(err)
+		}
+		return user
+	}
+
+	user := currentUser(devLogin())
+	if user.OAuthProvider != DevProviderName || user.OAuthID != "carol" {
+		t.Fatalf("logged in as %s:%s, want %s:carol", user.OAuthProvider, user.OAuthID, DevProviderName)
+	}
+
+	// The dev provider sends no profile image, so logging in again must
+	// keep the one the user set
+	if err := api.Users.UpdateProfile(ctx, user.ID, "Carol", "/uploads/carol.png", ""); err != nil {
+		t.Fatal(err)
+	}
+	again := currentUser(devLogin())
+	if again.ID != user.ID || again.ProfileImage != "/uploads/carol.png" {
+		t.Errorf("second login = user %d with image %q, want user %d with image %q", again.ID, again.ProfileImage, user.ID, "/uploads/carol.png")
+	}
+}
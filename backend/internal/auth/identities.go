@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"backend/internal/apierror"
+	"backend/internal/models"
+	"backend/internal/store"
+	"backend/internal/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// ErrIdentityLinked is returned when an identity already belongs to another
+// account and merging was not requested
+var ErrIdentityLinked = errors.New("identity is linked to another account")
+
+// resolveUser returns the user an OAuth callback logs in as. For a normal
+// login the user is found (or created) through the identity; when linking,
+// the identity is attached to the logged-in user instead.
+func (h *Handler) resolveUser(ctx context.Context, flow oauthFlow, oauthID, profileImage, provider string) (*models.User, error) {
+	if flow.LinkUserID == 0 {
+		return h.Identities.Login(ctx, provider, oauthID, profileImage)
+	}
+
+	ownerID, err := h.Identities.Owner(ctx, provider, oauthID)
+	switch {
+	case err == store.ErrNotFound:
+		if err := h.Identities.Link(ctx, flow.LinkUserID, provider, oauthID); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	case ownerID != flow.LinkUserID:
+		if !flow.Merge {
+			return nil, ErrIdentityLinked
+		}
+		if err := h.mergeUsers(ctx, ownerID, flow.LinkUserID); err != nil {
+			return nil, err
+		}
+	}
+
+	return h.Users.Get(ctx, flow.LinkUserID)
+}
+
+// mergeUsers moves everything owned by the duplicate account sourceID to
+// targetID, deletes the duplicate and the blobs of its copies of files the
+// target had uploaded too
+func (h *Handler) mergeUsers(ctx context.Context, sourceID, targetID int) error {
+	if sourceID == targetID {
+		return errors.New("cannot merge a user into itself")
+	}
+	dropped, err := h.Identities.Merge(ctx, sourceID, targetID)
+	if err != nil {
+		return fmt.Errorf("merge user %d into %d: %w", sourceID, targetID, err)
+	}
+	for _, upload := range dropped {
+		for _, key := range upload.Variants {
+			if err := h.Blobs.Delete(ctx, key); err != nil {
+				log.Printf("Failed to delete upload %s: %v", key, err)
+			}
+		}
+	}
+
+	log.Printf("Merged user %d into user %d", sourceID, targetID)
+	return nil
+}
+
+// HandleGetIdentities lists the login providers linked to the current user
+func (h *Handler) HandleGetIdentities(w http.ResponseWriter, r *http.Request) {
+	userID, ok := RequireSession(w, r)
+	if !ok {
+		return
+	}
+
+	identities, err := h.Identities.List(r.Context(), userID)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(identities)
+}
+
+// HandleUnlinkIdentity removes a linked provider account, e.g.
+// DELETE /auth/identities/12
+func (h *Handler) HandleUnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	userID, ok := RequireSession(w, r)
+	if !ok {
+		return
+	}
+
+	identityID, ok := utils.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	removed, err := h.Identities.Unlink(r.Context(), userID, identityID)
+	switch {
+	case err == store.ErrNotFound:
+		apierror.Write(w, r, apierror.NotFound("Identity not found"))
+		return
+	case err == store.ErrLastIdentity:
+		apierror.Write(w, r, apierror.Conflict(err.Error()))
+		return
+	case err != nil:
+		apierror.Write(w, r, fmt.Errorf("unlink identity %d: %w", identityID, err))
+		return
+	}
+
+	// Sessions that logged in through the removed provider end with its
+	// last linked account
+	if h.providerUnlinked(r.Context(), userID, removed.Provider) {
+		if _, err := RevokeUserSessions(r.Context(), h.Sessions, userID, currentSession(r).ID, removed.Provider); err != nil {
+			log.Println("Failed to revoke sessions of unlinked identity:", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Identity unlinked successfully",
+	})
+}
+
+// providerUnlinked reports whether none of a user's identities is of
+// provider any more
+func (h *Handler) providerUnlinked(ctx context.Context, userID int, provider string) bool {
+	identities, err := h.Identities.List(ctx, userID)
+	if err != nil {
+		// Revoking too much only logs the user out
+		log.Println("Failed to list identities:", err)
+		return true
+	}
+	for _, i := range identities {
+		if i.Provider == provider {
+			return false
+		}
+	}
+	return true
+}
+
+// errLinkNeedsPost is returned when linking is started with a GET request
+var errLinkNeedsPost = errors.New("linking must be started with POST")
+
+// linkFlowFromRequest reads what a login request was started for. A GET
+// only logs in. A POST links the provider account to the logged-in user,
+// and with merge=true merges the account that already owns it. Merging
+// cannot be undone, so it is only started by a POST, which the CSRF origin
+// check covers, and never by a link another site could send.
+func linkFlowFromRequest(r *http.Request) (oauthFlow, error) {
+	var flow oauthFlow
+	if r.Method != http.MethodPost {
+		if r.URL.Query().Get("link") == "true" {
+			return flow, errLinkNeedsPost
+		}
+		return flow, nil
+	}
+
+	principal, ok := Authenticate(r)
+	if !ok || principal.TokenID != 0 {
+		return flow, errors.New("not authenticated")
+	}
+
+	flow.LinkUserID = principal.UserID
+	flow.Merge = r.FormValue("merge") == "true"
+	return flow, nil
+}
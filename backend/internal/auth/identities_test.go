@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"backend/internal/models"
+	"backend/internal/storage"
+	"backend/internal/store"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestUnlinkIdentity(t *testing.T) {
+	api, authenticator := newSessionTest(t)
+	ctx := context.Background()
+
+	// Alice logged in with dev and linked two X accounts
+	alice, err := api.Identities.Login(ctx, DevProviderName, "alice", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(api.Identities.Link(ctx, alice.ID, "twitter", "x-main"))
+	must(api.Identities.Link(ctx, alice.ID, "twitter", "x-alt"))
+	must(api.Connections.Save(ctx, &models.OAuthToken{UserID: alice.ID, Provider: "twitter", AccessToken: "token"}))
+	bob, err := api.Identities.Login(ctx, DevProviderName, "bob", "")
+	must(err)
+
+	identities, err := api.Identities.List(ctx, alice.ID)
+	must(err)
+	ids := map[string]int{}
+	for _, i := range identities {
+		ids[i.ProviderUserID] = i.ID
+	}
+	bobIdentities, err := api.Identities.List(ctx, bob.ID)
+	must(err)
+
+	current := login(t, alice.ID, DevProviderName)
+	twitterSession := login(t, alice.ID, "twitter")
+
+	unlink := func(id int) int {
+		req := httptest.NewRequest(http.MethodDelete, "/auth/identities/"+strconv.Itoa(id), nil)
+		req.SetPathValue("id", strconv.Itoa(id))
+		req.AddCookie(current)
+		rec := httptest.NewRecorder()
+		authenticator.Middleware(http.HandlerFunc(api.HandleUnlinkIdentity)).ServeHTTP(rec, req)
+		return rec.Code
+	}
+	twitterState := func() (connected, loggedIn bool) {
+		_, err := api.Connections.Get(ctx, alice.ID, "twitter")
+		if err != nil && err != store.ErrNotFound {
+			t.Fatal(err)
+		}
+		connected = err == nil
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(twitterSession)
+		session, err := Store.New(req, GetSessionCookieName())
+		must(err)
+		return connected, !session.IsNew
+	}
+
+	if code := unlink(bobIdentities[0].ID); code != http.StatusNotFound {
+		t.Errorf("unlink another user's identity: status = %d, want %d", code, http.StatusNotFound)
+	}
+
+	// Only the chosen account goes; X stays connected through the other
+	if code := unlink(ids["x-alt"]); code != http.StatusOK {
+		t.Fatalf("unlink x-alt: status = %d, want %d", code, http.StatusOK)
+	}
+	if connected, loggedIn := twitterState(); !connected || !loggedIn {
+		t.Errorf("after unlinking x-alt: connected %v, logged in %v; want both", connected, loggedIn)
+	}
+	remaining, err := api.Identities.List(ctx, alice.ID)
+	must(err)
+	if len(remaining) != 2 {
+		t.Errorf("%d identities left, want 2", len(remaining))
+	}
+
+	// Unlinking the last X account disconnects X and its sessions
+	if code := unlink(ids["x-main"]); code != http.StatusOK {
+		t.Fatalf("unlink x-main: status = %d, want %d", code, http.StatusOK)
+	}
+	if connected, loggedIn := twitterState(); connected || loggedIn {
+		t.Errorf("after unlinking x-main: connected %v, logged in %v; want neither", connected, loggedIn)
+	}
+
+	if code := unlink(ids["alice"]); code != http.StatusConflict {
+		t.Errorf("unlink last identity: status = %d, want %d", code, http.StatusConflict)
+	}
+}
+
+func TestLinkRequiresPost(t *testing.T) {
+	api, authenticator := newSessionTest(t)
+	RegisterProvider(refreshTestProvider{tokenURL: "http://provider.test/token"})
+	cookie := login(t, 1, DevProviderName)
+
+	start := func(method string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/auth/refreshtest?link=true", strings.NewReader("merge=true"))
+		req.SetPathValue("provider", "refreshtest")
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		authenticator.Middleware(http.HandlerFunc(api.HandleOAuthLogin)).ServeHTTP(rec, req)
+		return rec
+	}
+
+	// A link on another site must not be able to start a merge
+	if rec := start(http.MethodGet, cookie); rec.Code != http.StatusBadRequest {
+		t.Errorf("GET: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := start(http.MethodPost, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("POST without session: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	rec := start(http.MethodPost, cookie)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("POST: status = %d, want %d", rec.Code, http.StatusSeeOther)
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The callback finds the flow the POST started
+	callback := httptest.NewRequest(http.MethodGet, "/auth/refreshtest/callback?state="+url.QueryEscape(location.Query().Get("state")), nil)
+	for _, c := range rec.Result().Cookies() {
+		callback.AddCookie(c)
+	}
+	_, flow, err := finishOAuthFlow(httptest.NewRecorder(), callback, "refreshtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flow.LinkUserID != 1 || !flow.Merge {
+		t.Errorf("flow = %+v, want linking to user 1 with merge", flow)
+	}
+}
+
+func TestMergeDropsDuplicateUploads(t *testing.T) {
+	ctx := context.Background()
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	stores := store.NewMemory().Stores()
+	blobs, err := storage.NewLocal(t.TempDir(), "http://api.test")
+	must(err)
+	api := NewHandler(stores, blobs)
+
+	target, err := stores.Identities.Login(ctx, DevProviderName, "alice", "")
+	must(err)
+	source, err := stores.Identities.Login(ctx, "twitter", "x-alice", "")
+	must(err)
+
+	upload := func(userID int, prefix, sha string) *models.Upload {
+		t.Helper()
+		key := prefix + "_256.jpg"
+		must(api.Blobs.Put(ctx, key, strings.NewReader("jpeg"), 4, "image/jpeg"))
+		u := &models.Upload{UserID: userID, SHA256: sha, KeyPrefix: prefix, Variants: map[string]string{"256": key}, Size: 4}
+		must(stores.Uploads.Create(ctx, u, 1<<20))
+		return u
+	}
+	targetCopy := upload(target.ID, "1_aaaa", "same")
+	sourceCopy := upload(source.ID, "2_bbbb", "same")
+	sourceOnly := upload(source.ID, "2_cccc", "other")
+
+	link := func(u *models.Upload) string { return api.Blobs.URL(u.Variants["256"]) }
+	must(stores.Users.UpdateProfile(ctx, source.ID, "Alice", link(sourceCopy), ""))
+	post := &models.Post{UserID: source.ID, Title: "Song", SongID: "a", SongType: "spotify", Comment: "cover " + link(sourceCopy) + " " + link(sourceOnly)}
+	must(stores.Posts.Create(ctx, post))
+
+	must(api.mergeUsers(ctx, source.ID, target.ID))
+
+	merged, err := stores.Users.Get(ctx, target.ID)
+	must(err)
+	if merged.ProfileImage != link(targetCopy) {
+		t.Errorf("profile image = %q, want the target's copy %q", merged.ProfileImage, link(targetCopy))
+	}
+	moved, err := stores.Posts.Get(ctx, 0, post.ID)
+	must(err)
+	if want := "cover " + link(targetCopy) + " " + link(sourceOnly); moved.Comment != want {
+		t.Errorf("comment = %q, want %q", moved.Comment, want)
+	}
+
+	uploads, err := stores.Uploads.List(ctx, target.ID)
+	must(err)
+	if len(uploads) != 2 {
+		t.Errorf("target has %d uploads, want its own and the moved one", len(uploads))
+	}
+	for key, want := range map[string]bool{
+		targetCopy.Variants["256"]: true,
+		sourceOnly.Variants["256"]: true,
+		sourceCopy.Variants["256"]: false,
+	} {
+		rc, err := api.Blobs.Open(ctx, key)
+		if err == nil {
+			rc.Close()
+		}
+		if exists := err == nil; exists != want {
+			t.Errorf("blob %s exists = %v, want %v", key, exists, want)
+		}
+	}
+}
@@ -2,6 +2,9 @@ package auth
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
 	"os"
 
 	"golang.org/x/oauth2"
@@ -23,16 +26,101 @@ func GetTwitterOAuthConfig() *oauth2.Config {
 		ClientID:     os.Getenv("TWITTER_CLIENT_ID"),
 		ClientSecret: os.Getenv("TWITTER_CLIENT_SECRET"),
 		RedirectURL:  os.Getenv("TWITTER_REDIRECT_URI"),
-		Scopes:       []string{"tweet.read", "users.read"},
+		// offline.access is required to receive a refresh token
+		Scopes: []string{"tweet.read", "tweet.write", "users.read", "offline.access"},
 		Endpoint: oauth2.Endpoint{
-			AuthURL:  "https://twitter.com/i/oauth2/authorize",
-			TokenURL: "https://api.twitter.com/2/oauth2/token",
+			AuthURL:   "https://twitter.com/i/oauth2/authorize",
+			TokenURL:  "https://api.twitter.com/2/oauth2/token",
+			AuthStyle: oauth2.AuthStyleInHeader,
 		},
 	}
 }
 
-var oauthStateString = generateRandomSecret(16)
-
 func ExchangeCodeForToken(config *oauth2.Config, code string) (*oauth2.Token, error) {
 	return config.Exchange(context.Background(), code)
 }
+
+// getJSON fetches url with an authorized client and decodes the JSON body
+func getJSON(ctx context.Context, client *http.Client, url string) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+
+	var info map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// stringField returns info[key] if it is a string
+func stringField(info map[string]interface{}, key string) string {
+	s, _ := info[key].(string)
+	return s
+}
+
+// spotifyProvider logs users in with their Spotify account
+type spotifyProvider struct{}
+
+func (spotifyProvider) Name() string { return "spotify" }
+
+func (spotifyProvider) Config(ctx context.Context) (*oauth2.Config, error) {
+	return GetSpotifyOAuthConfig(), nil
+}
+
+func (spotifyProvider) FetchUserInfo(ctx context.Context, client *http.Client) (map[string]interface{}, error) {
+	return getJSON(ctx, client, "https://api.spotify.com/v1/me")
+}
+
+func (spotifyProvider) MapProfile(info map[string]interface{}) (Profile, error) {
+	profile := Profile{
+		ID:          stringField(info, "id"),
+		DisplayName: stringField(info, "display_name"),
+	}
+	if images, ok := info["images"].([]interface{}); ok && len(images) > 0 {
+		if image, ok := images[0].(map[string]interface{}); ok {
+			profile.ProfileImage = stringField(image, "url")
+		}
+	}
+	return profile, nil
+}
+
+func (spotifyProvider) KeepsToken() bool { return false }
+
+// twitterProvider logs users in with their X account. The token is kept so
+// posts can be cross-posted on their behalf.
+type twitterProvider struct{}
+
+func (twitterProvider) Name() string { return "twitter" }
+
+func (twitterProvider) Config(ctx context.Context) (*oauth2.Config, error) {
+	return GetTwitterOAuthConfig(), nil
+}
+
+func (twitterProvider) FetchUserInfo(ctx context.Context, client *http.Client) (map[string]interface{}, error) {
+	return getJSON(ctx, client, "https://api.twitter.com/2/users/me?user.fields=profile_image_url")
+}
+
+func (twitterProvider) MapProfile(info map[string]interface{}) (Profile, error) {
+	data, ok := info["data"].(map[string]interface{})
+	if !ok {
+		return Profile{}, fmt.Errorf("twitter user info has no data")
+	}
+	return Profile{
+		ID:           stringField(data, "id"),
+		DisplayName:  stringField(data, "name"),
+		ProfileImage: stringField(data, "profile_image_url"),
+	}, nil
+}
+
+func (twitterProvider) KeepsToken() bool { return true }
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// OIDCDiscoveryTimeout bounds the request for an issuer's discovery document
+const OIDCDiscoveryTimeout = 10 * time.Second
+
+// reservedAuthPaths are /auth/ routes that are not login providers
+var reservedAuthPaths = map[string]bool{
+	"logout": true, "me": true, "profile": true, "identities": true, DevProviderName: true,
+}
+
+// oidcDiscovery is the subset of the OpenID provider metadata Otogram uses
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+// OIDCProvider is a generic OpenID Connect provider. Endpoints are read from
+// the issuer's /.well-known/openid-configuration on first use.
+type OIDCProvider struct {
+	name         string
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       []string
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+}
+
+// NewOIDCProviderFromEnv configures an OIDC provider from
+// OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET, _REDIRECT_URI and the
+// optional space separated _SCOPES
+func NewOIDCProviderFromEnv(name string) (*OIDCProvider, error) {
+	name = strings.ToLower(name)
+	if name == "" || strings.ContainsAny(name, "/ ") {
+		return nil, fmt.Errorf("invalid provider name %q", name)
+	}
+	if reservedAuthPaths[name] {
+		return nil, fmt.Errorf("provider name %q is reserved", name)
+	}
+	if _, ok := GetProvider(name); ok {
+		return nil, fmt.Errorf("provider %q is already registered", name)
+	}
+
+	prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+	p := &OIDCProvider{
+		name:         name,
+		issuer:       os.Getenv(prefix + "ISSUER"),
+		clientID:     os.Getenv(prefix + "CLIENT_ID"),
+		clientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+		redirectURL:  os.Getenv(prefix + "REDIRECT_URI"),
+		scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+	}
+	if p.issuer == "" || p.clientID == "" {
+		return nil, fmt.Errorf("%sISSUER and %sCLIENT_ID are required", prefix, prefix)
+	}
+	if len(p.scopes) == 0 {
+		p.scopes = []string{"openid", "profile"}
+	}
+	return p, nil
+}
+
+func (p *OIDCProvider) Name() string { return p.name }
+
+func (p *OIDCProvider) Config(ctx context.Context) (*oauth2.Config, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Config{
+		ClientID:     p.clientID,
+		ClientSecret: p.clientSecret,
+		RedirectURL:  p.redirectURL,
+		Scopes:       p.scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  d.AuthorizationEndpoint,
+			TokenURL: d.TokenEndpoint,
+		},
+	}, nil
+}
+
+func (p *OIDCProvider) FetchUserInfo(ctx context.Context, client *http.Client) (map[string]interface{}, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if d.UserinfoEndpoint == "" {
+		return nil, fmt.Errorf("issuer %s has no userinfo endpoint", p.issuer)
+	}
+	return getJSON(ctx, client, d.UserinfoEndpoint)
+}
+
+func (p *OIDCProvider) MapProfile(info map[string]interface{}) (Profile, error) {
+	profile := Profile{
+		ID:           stringField(info, "sub"),
+		DisplayName:  stringField(info, "name"),
+		ProfileImage: stringField(info, "picture"),
+	}
+	if profile.DisplayName == "" {
+		profile.DisplayName = stringField(info, "preferred_username")
+	}
+	if profile.ID == "" {
+		return Profile{}, fmt.Errorf("userinfo has no sub claim")
+	}
+	return profile, nil
+}
+
+func (p *OIDCProvider) KeepsToken() bool { return false }
+
+// discover fetches and caches the issuer's metadata. Failures are not cached
+// so a temporarily unreachable issuer recovers on the next login.
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, OIDCDiscoveryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc discovery for %s: %s", p.issuer, resp.Status)
+	}
+
+	var d oidcDiscovery
+	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return nil, err
+	}
+	if d.Issuer != p.issuer {
+		return nil, fmt.Errorf("oidc discovery issuer mismatch: got %q, want %q", d.Issuer, p.issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" {
+		return nil, fmt.Errorf("oidc discovery for %s is missing endpoints", p.issuer)
+	}
+
+	p.discovery = &d
+	return p.discovery, nil
+}
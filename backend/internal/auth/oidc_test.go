@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOIDCDiscoverIssuer(t *testing.T) {
+	var issuer string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/openid-configuration" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                issuer,
+			AuthorizationEndpoint: issuer + "authorize",
+			TokenEndpoint:         issuer + "token",
+		})
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name       string
+		configured string
+		served     string
+		wantErr    string
+	}{
+		{"issuer with trailing slash", srv.URL + "/", srv.URL + "/", ""},
+		{"issuer without trailing slash", srv.URL, srv.URL, ""},
+		{"slash added by the server", srv.URL, srv.URL + "/", "issuer mismatch"},
+		{"slash missing from the server", srv.URL + "/", srv.URL, "issuer mismatch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer = tt.served
+			p := &OIDCProvider{name: "test", issuer: tt.configured}
+			_, err := p.discover(context.Background())
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("discover() = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("discover() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
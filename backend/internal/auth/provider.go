@@ -0,0 +1,243 @@
+package auth
+
+import (
+	"backend/internal/apierror"
+	"backend/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Profile is the part of a provider's user info Otogram keeps
+type Profile struct {
+	ID           string
+	DisplayName  string
+	ProfileImage string
+}
+
+// Provider is an OAuth 2.0 login provider. Adding one only requires
+// implementing this interface and registering it with RegisterProvider;
+// /auth/{name} and /auth/{name}/callback are then handled generically.
+type Provider interface {
+	// Name is the provider's identifier in URLs and in the database
+	Name() string
+	// Config returns the OAuth client configuration
+	Config(ctx context.Context) (*oauth2.Config, error)
+	// FetchUserInfo retrieves the raw user info with an authorized client
+	FetchUserInfo(ctx context.Context, client *http.Client) (map[string]interface{}, error)
+	// MapProfile extracts the Otogram profile from the user info
+	MapProfile(info map[string]interface{}) (Profile, error)
+	// KeepsToken reports whether the login token is stored for later API
+	// calls, e.g. cross-posting to X
+	KeepsToken() bool
+}
+
+var providers = struct {
+	sync.RWMutex
+	m map[string]Provider
+}{m: make(map[string]Provider)}
+
+// RegisterProvider makes a provider available for login
+func RegisterProvider(p Provider) {
+	providers.Lock()
+	defer providers.Unlock()
+	providers.m[p.Name()] = p
+}
+
+// GetProvider returns a registered provider by name
+func GetProvider(name string) (Provider, bool) {
+	providers.RLock()
+	defer providers.RUnlock()
+	p, ok := providers.m[name]
+	return p, ok
+}
+
+// InitProviders registers Spotify, Twitter/X and the OpenID Connect
+// providers listed in OIDC_PROVIDERS
+func InitProviders() {
+	RegisterProvider(spotifyProvider{})
+	RegisterProvider(twitterProvider{})
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		p, err := NewOIDCProviderFromEnv(name)
+		if err != nil {
+			log.Printf("Skipping OIDC provider %s: %v", name, err)
+			continue
+		}
+		RegisterProvider(p)
+	}
+}
+
+// HandleOAuthLogin serves /auth/{provider} for every registered provider:
+// GET logs in and POST links the provider account to the logged-in user
+func (h *Handler) HandleOAuthLogin(w http.ResponseWriter, r *http.Request) {
+	provider, ok := GetProvider(r.PathValue("provider"))
+	if !ok {
+		apierror.Write(w, r, apierror.NotFound("Not found"))
+		return
+	}
+	handleLogin(w, r, provider)
+}
+
+// HandleOAuthCallback serves /auth/{provider}/callback for every registered
+// provider
+func (h *Handler) HandleOAuthCallback(w http.ResponseWriter, r *http.Request) {
+	provider, ok := GetProvider(r.PathValue("provider"))
+	if !ok {
+		apierror.Write(w, r, apierror.NotFound("Not found"))
+		return
+	}
+	h.handleCallback(w, r, provider)
+}
+
+func handleLogin(w http.ResponseWriter, r *http.Request, provider Provider) {
+	config, err := provider.Config(r.Context())
+	if err != nil {
+		apierror.Write(w, r, apierror.Unavailable("Login provider unavailable", fmt.Errorf("configure %s: %w", provider.Name(), err)))
+		return
+	}
+
+	flow, err := linkFlowFromRequest(r)
+	if err == errLinkNeedsPost {
+		apierror.Write(w, r, apierror.BadRequest("Linking an account requires a POST request"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.Unauthorized("Not authenticated"))
+		return
+	}
+
+	state, opts, err := beginOAuthFlow(w, r, provider.Name(), flow)
+	if err != nil {
+		apierror.Write(w, r, fmt.Errorf("start OAuth flow: %w", err))
+		return
+	}
+	url := config.AuthCodeURL(state, opts...)
+	status := http.StatusTemporaryRedirect
+	if r.Method == http.MethodPost {
+		// The provider's authorize page must be fetched with GET
+		status = http.StatusSeeOther
+	}
+	http.Redirect(w, r, url, status)
+}
+
+func (h *Handler) handleCallback(w http.ResponseWriter, r *http.Request, provider Provider) {
+	verifier, flow, err := finishOAuthFlow(w, r, provider.Name())
+	if err != nil {
+		log.Println("OAuth state check failed:", err)
+		apierror.Write(w, r, apierror.BadRequest("Invalid state parameter"))
+		return
+	}
+
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		apierror.Write(w, r, apierror.BadRequest("Code not found"))
+		return
+	}
+
+	ctx := context.Background()
+	config, err := provider.Config(ctx)
+	if err != nil {
+		apierror.Write(w, r, apierror.Unavailable("Login provider unavailable", fmt.Errorf("configure %s: %w", provider.Name(), err)))
+		return
+	}
+
+	token, err := config.Exchange(ctx, code, verifier)
+	if err != nil {
+		apierror.Write(w, r, fmt.Errorf("exchange %s token: %w", provider.Name(), err))
+		return
+	}
+
+	// Get user info from the provider
+	info, err := provider.FetchUserInfo(ctx, config.Client(ctx, token))
+	if err != nil {
+		apierror.Write(w, r, fmt.Errorf("get %s user info: %w", provider.Name(), err))
+		return
+	}
+
+	profile, err := provider.MapProfile(info)
+	if err == nil && profile.ID == "" {
+		err = errors.New("missing user ID")
+	}
+	if err != nil {
+		apierror.Write(w, r, fmt.Errorf("parse %s user info: %w", provider.Name(), err))
+		return
+	}
+
+	h.completeLogin(w, r, flow, provider.Name(), profile, func(userID int) {
+		if !provider.KeepsToken() {
+			return
+		}
+		expiresAt := time.Now().Add(2 * time.Hour) // Twitter tokens typically expire in 2 hours
+		if !token.Expiry.IsZero() {
+			expiresAt = token.Expiry
+		}
+		err := h.Connections.Save(ctx, &models.OAuthToken{
+			UserID:       userID,
+			Provider:     provider.Name(),
+			AccessToken:  token.AccessToken,
+			RefreshToken: token.RefreshToken,
+			ExpiresAt:    expiresAt,
+		})
+		if err != nil {
+			log.Printf("Warning: Failed to save %s OAuth token: %v", provider.Name(), err)
+			// Continue anyway as this is not critical for initial login
+		}
+	})
+}
+
+// completeLogin logs the browser in as the user behind profile (or links the
+// profile to the logged-in user) and redirects to the frontend. afterResolve,
+// if set, runs once the user is known and before the session is created.
+func (h *Handler) completeLogin(w http.ResponseWriter, r *http.Request, flow oauthFlow, provider string, profile Profile, afterResolve func(userID int)) {
+	// Save or update user in database
+	user, err := h.resolveUser(r.Context(), flow, profile.ID, profile.ProfileImage, provider)
+	if err == ErrIdentityLinked {
+		apierror.Write(w, r, apierror.Conflict("This "+provider+" account is linked to another user"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, fmt.Errorf("save user: %w", err))
+		return
+	}
+
+	log.Printf("User created/updated: ID=%d, DisplayName=%s", user.ID, user.DisplayName)
+
+	if afterResolve != nil {
+		afterResolve(user.ID)
+	}
+
+	// Create session
+	if err := createSession(w, r, user, provider); err != nil {
+		apierror.Write(w, r, fmt.Errorf("create session: %w", err))
+		return
+	}
+
+	// Redirect to frontend
+	frontendURL := os.Getenv("FRONTEND_URL")
+	if frontendURL == "" {
+		frontendURL = "http://127.0.0.1:3000"
+	}
+
+	redirectURL := frontendURL
+	if user.DisplayName == "" {
+		redirectURL = frontendURL + "/setup-profile"
+	}
+
+	// Manual redirect to ensure Set-Cookie is sent first
+	w.Header().Set("Location", redirectURL)
+	w.WriteHeader(http.StatusSeeOther)
+	log.Printf("Redirecting to: %s", redirectURL)
+}
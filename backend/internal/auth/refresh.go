@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// TokenRefreshSkew refreshes tokens slightly before they expire so a request
+// started just before expiry does not fail
+const TokenRefreshSkew = time.Minute
+
+// ErrNeedsReauth is returned when the provider rejected the stored refresh
+// token and the user has to connect the account again
+var ErrNeedsReauth = errors.New("oauth connection needs re-authorization")
+
+// GetOAuthConfig returns the OAuth config of a provider
+func GetOAuthConfig(provider string) (*oauth2.Config, error) {
+	p, ok := GetProvider(provider)
+	if !ok {
+		return nil, fmt.Errorf("unknown oauth provider %q", provider)
+	}
+	return p.Config(context.Background())
+}
+
+// storeTokenSource is an oauth2.TokenSource backed by a ConnectionStore
+type storeTokenSource struct {
+	ctx         context.Context
+	connections store.ConnectionStore
+	userID      int
+	provider    string
+}
+
+// NewTokenSource returns a token source for a user's stored provider token.
+// Expired tokens are refreshed through the provider's token endpoint and the
+// rotated tokens are saved back; a rejected refresh marks the connection as
+// needing re-authorization.
+func NewTokenSource(ctx context.Context, connections store.ConnectionStore, userID int, provider string) oauth2.TokenSource {
+	return &storeTokenSource{ctx: ctx, connections: connections, userID: userID, provider: provider}
+}
+
+func (s *storeTokenSource) Token() (*oauth2.Token, error) {
+	config, err := GetOAuthConfig(s.provider)
+	if err != nil {
+		return nil, err
+	}
+
+	// Refresh holds a lock on the token, since providers such as Twitter
+	// invalidate a refresh token once it is used
+	var token *oauth2.Token
+	err = s.connections.Refresh(s.ctx, s.userID, s.provider, func(stored *models.OAuthToken) error {
+		if stored.NeedsReauth {
+			return ErrNeedsReauth
+		}
+
+		if time.Now().Add(TokenRefreshSkew).Before(stored.ExpiresAt) {
+			token = &oauth2.Token{AccessToken: stored.AccessToken, RefreshToken: stored.RefreshToken, Expiry: stored.ExpiresAt, TokenType: "Bearer"}
+			return nil
+		}
+
+		if stored.RefreshToken == "" {
+			stored.NeedsReauth = true
+			return ErrNeedsReauth
+		}
+
+		refreshed, err := config.TokenSource(s.ctx, &oauth2.Token{RefreshToken: stored.RefreshToken}).Token()
+		if err != nil {
+			var retrieveErr *oauth2.RetrieveError
+			if errors.As(err, &retrieveErr) && retrieveErr.Response != nil && retrieveErr.Response.StatusCode < 500 {
+				log.Printf("Refresh of %s token for user %d rejected: %v", s.provider, s.userID, err)
+				stored.NeedsReauth = true
+				return ErrNeedsReauth
+			}
+			return fmt.Errorf("failed to refresh token: %w", err)
+		}
+
+		// Providers that do not rotate refresh tokens omit them from the response
+		if refreshed.RefreshToken == "" {
+			refreshed.RefreshToken = stored.RefreshToken
+		}
+		if refreshed.Expiry.IsZero() {
+			refreshed.Expiry = time.Now().Add(2 * time.Hour)
+		}
+
+		stored.AccessToken = refreshed.AccessToken
+		stored.RefreshToken = refreshed.RefreshToken
+		stored.ExpiresAt = refreshed.Expiry
+		token = refreshed
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// MarkNeedsReauth flags a user's connection to provider as needing the
+// account to be connected again, e.g. after the provider rejected its token
+func MarkNeedsReauth(ctx context.Context, connections store.ConnectionStore, userID int, provider string) error {
+	return connections.Refresh(ctx, userID, provider, func(token *models.OAuthToken) error {
+		token.NeedsReauth = true
+		return nil
+	})
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// refreshTestProvider is a provider whose token endpoint is a test server
+type refreshTestProvider struct {
+	tokenURL string
+}
+
+func (refreshTestProvider) Name() string { return "refreshtest" }
+
+func (p refreshTestProvider) Config(ctx context.Context) (*oauth2.Config, error) {
+	return &oauth2.Config{ClientID: "client", Endpoint: oauth2.Endpoint{TokenURL: p.tokenURL, AuthStyle: oauth2.AuthStyleInParams}}, nil
+}
+
+func (refreshTestProvider) FetchUserInfo(ctx context.Context, client *http.Client) (map[string]interface{}, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (refreshTestProvider) MapProfile(info map[string]interface{}) (Profile, error) {
+	return Profile{}, errors.New("not implemented")
+}
+
+func (refreshTestProvider) KeepsToken() bool { return true }
+
+func TestTokenSourceRefresh(t *testing.T) {
+	tests := []struct {
+		name          string
+		expiresIn     time.Duration
+		refreshToken  string
+		status        int
+		wantErr       error
+		wantAccess    string
+		wantRefresh   string
+		wantReauth    bool
+		wantEndpoints int
+	}{
+		{"valid token", time.Hour, "refresh-1", http.StatusOK, nil, "access-1", "refresh-1", false, 0},
+		{"expired token", -time.Minute, "refresh-1", http.StatusOK, nil, "access-2", "refresh-2", false, 1},
+		{"no refresh token", -time.Minute, "", http.StatusOK, ErrNeedsReauth, "access-1", "", true, 0},
+		{"refresh rejected", -time.Minute, "refresh-1", http.StatusBadRequest, ErrNeedsReauth, "access-1", "refresh-1", true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				if tt.status == http.StatusOK {
+					w.Write([]byte(`{"access_token":"access-2","refresh_token":"refresh-2","token_type":"bearer","expires_in":7200}`))
+				} else {
+					w.Write([]byte(`{"error":"invalid_grant"}`))
+				}
+			}))
+			defer srv.Close()
+			RegisterProvider(refreshTestProvider{tokenURL: srv.URL})
+
+			ctx := context.Background()
+			connections := store.NewMemory().Stores().Connections
+			err := connections.Save(ctx, &models.OAuthToken{
+				UserID: 1, Provider: "refreshtest", AccessToken: "access-1", RefreshToken: tt.refreshToken,
+				ExpiresAt: time.Now().Add(tt.expiresIn),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := NewTokenSource(ctx, connections, 1, "refreshtest").Token()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Token() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && token.AccessToken != tt.wantAccess {
+				t.Errorf("access token = %q, want %q", token.AccessToken, tt.wantAccess)
+			}
+			if calls != tt.wantEndpoints {
+				t.Errorf("token endpoint called %d times, want %d", calls, tt.wantEndpoints)
+			}
+
+			err = connections.Refresh(ctx, 1, "refreshtest", func(stored *models.OAuthToken) error {
+				if stored.AccessToken != tt.wantAccess || stored.RefreshToken != tt.wantRefresh || stored.NeedsReauth != tt.wantReauth {
+					t.Errorf("stored token = %q/%q needs reauth %v, want %q/%q needs reauth %v",
+						stored.AccessToken, stored.RefreshToken, stored.NeedsReauth, tt.wantAccess, tt.wantRefresh, tt.wantReauth)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestMarkNeedsReauth(t *testing.T) {
+	RegisterProvider(refreshTestProvider{})
+	ctx := context.Background()
+	mem := store.NewMemory()
+	mem.Connect(1, "refreshtest")
+	connections := mem.Stores().Connections
+
+	if err := MarkNeedsReauth(ctx, connections, 1, "refreshtest"); err != nil {
+		t.Fatal(err)
+	}
+	connection, err := connections.Get(ctx, 1, "refreshtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !connection.NeedsReauth {
+		t.Error("connection not flagged as needing re-authorization")
+	}
+
+	if _, err := NewTokenSource(ctx, connections, 1, "refreshtest").Token(); !errors.Is(err, ErrNeedsReauth) {
+		t.Errorf("Token() error = %v, want %v", err, ErrNeedsReauth)
+	}
+}
@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"backend/internal/apierror"
+	"backend/internal/store"
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// Scopes a personal access token can be granted. Browser sessions have all
+// of them.
+const (
+	ScopeRead               = "read"
+	ScopePostsWrite         = "posts:write"
+	ScopeRepliesWrite       = "replies:write"
+	ScopeLikesWrite         = "likes:write"
+	ScopeFollowsWrite       = "follows:write"
+	ScopeNotificationsWrite = "notifications:write"
+	ScopeProfileWrite       = "profile:write"
+)
+
+// AllScopes lists every valid scope
+var AllScopes = []string{
+	ScopeRead,
+	ScopePostsWrite,
+	ScopeRepliesWrite,
+	ScopeLikesWrite,
+	ScopeFollowsWrite,
+	ScopeNotificationsWrite,
+	ScopeProfileWrite,
+}
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	UserID int
+	// TokenID is set when the request authenticated with a personal access token
+	TokenID int
+	Scopes  []string
+}
+
+// HasScope reports whether the principal may perform actions of a scope
+func (p *Principal) HasScope(scope string) bool {
+	if p.TokenID == 0 {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBearer reports whether the request carries an Authorization: Bearer header
+func IsBearer(r *http.Request) bool {
+	_, ok := bearerToken(r)
+	return ok
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(header[7:]), true
+}
+
+// Authenticator resolves the caller of each request from an Authorization:
+// Bearer personal access token or, failing that, the session cookie. A
+// request carrying an invalid bearer token is not authenticated even if it
+// also has a cookie.
+type Authenticator struct {
+	Tokens store.TokenStore
+	// Sessions loads browser sessions. When nil, only bearer tokens are
+	// accepted.
+	Sessions sessions.Store
+}
+
+type principalKey struct{}
+
+// Middleware stores the caller of each request in its context, where
+// Authenticate, RequireUser and RequireSession read it
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if principal, ok := a.authenticate(r); ok {
+			r = r.WithContext(context.WithValue(r.Context(), principalKey{}, principal))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *Authenticator) authenticate(r *http.Request) (*Principal, bool) {
+	if token, ok := bearerToken(r); ok {
+		return a.authenticateAccessToken(r.Context(), token)
+	}
+
+	if a.Sessions == nil {
+		return nil, false
+	}
+	session, err := a.Sessions.Get(r, GetSessionCookieName())
+	if err != nil {
+		return nil, false
+	}
+	userID, ok := session.Values["user_id"].(int)
+	if !ok {
+		return nil, false
+	}
+	return &Principal{UserID: userID}, true
+}
+
+// authenticateAccessToken looks up an unexpired token by its hash and
+// records its use
+func (a *Authenticator) authenticateAccessToken(ctx context.Context, token string) (*Principal, bool) {
+	if !strings.HasPrefix(token, AccessTokenPrefix) {
+		return nil, false
+	}
+
+	t, err := a.Tokens.Lookup(ctx, hashAccessToken(token))
+	if err != nil {
+		if err != store.ErrNotFound {
+			log.Println("Failed to look up access token:", err)
+		}
+		return nil, false
+	}
+
+	if t.LastUsedAt == nil || time.Since(*t.LastUsedAt) > lastSeenInterval {
+		if err := a.Tokens.Touch(ctx, t.ID, time.Now()); err != nil {
+			log.Println("Failed to update access token last-used time:", err)
+		}
+	}
+
+	return &Principal{UserID: t.UserID, TokenID: t.ID, Scopes: t.Scopes}, true
+}
+
+// Authenticate returns the caller resolved by Authenticator.Middleware
+func Authenticate(r *http.Request) (*Principal, bool) {
+	principal, ok := r.Context().Value(principalKey{}).(*Principal)
+	return principal, ok
+}
+
+// CurrentUserID returns the ID of the calling user, without checking scopes.
+// Handlers that act on behalf of the user should use RequireUser instead.
+func CurrentUserID(r *http.Request) (int, bool) {
+	principal, ok := Authenticate(r)
+	if !ok {
+		return 0, false
+	}
+	return principal.UserID, true
+}
+
+// RequireUser authenticates the request and checks that the caller was
+// granted scope. On failure it writes a 401 or 403 response and returns false.
+func RequireUser(w http.ResponseWriter, r *http.Request, scope string) (int, bool) {
+	principal, ok := Authenticate(r)
+	if !ok {
+		apierror.Write(w, r, apierror.Unauthorized("Not authenticated"))
+		return 0, false
+	}
+	if !principal.HasScope(scope) {
+		apierror.Write(w, r, apierror.Forbidden("Insufficient scope: "+scope+" required"))
+		return 0, false
+	}
+	return principal.UserID, true
+}
+
+// RequireSession is RequireUser for account management endpoints, which only
+// a browser session may use
+func RequireSession(w http.ResponseWriter, r *http.Request) (int, bool) {
+	principal, ok := Authenticate(r)
+	if !ok {
+		apierror.Write(w, r, apierror.Unauthorized("Not authenticated"))
+		return 0, false
+	}
+	if principal.TokenID != 0 {
+		apierror.Write(w, r, apierror.Forbidden("This endpoint requires a browser session"))
+		return 0, false
+	}
+	return principal.UserID, true
+}
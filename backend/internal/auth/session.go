@@ -1,22 +1,37 @@
 package auth
 
 import (
+	"backend/internal/store"
+	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"log"
 	"os"
+	"time"
 
 	"github.com/gorilla/sessions"
 )
 
-var Store *sessions.CookieStore
+// Store keeps login sessions server-side
+var Store *ServerStore
 
-func InitSessionStore() {
+// flowStore keeps the short-lived OAuth state cookies, which do not need to
+// be listed or revoked
+var flowStore *sessions.CookieStore
+
+// SessionCleanupInterval is how often expired sessions are deleted
+const SessionCleanupInterval = time.Hour
+
+// InitSessionStore sets up Store to keep login sessions in s and starts
+// deleting expired ones every SessionCleanupInterval
+func InitSessionStore(s store.SessionStore) {
 	secret := os.Getenv("SESSION_SECRET")
 	if secret == "" {
 		// Generate a random secret if not provided
 		secret = generateRandomSecret(32)
 	}
-	Store = sessions.NewCookieStore([]byte(secret))
+	flowStore = sessions.NewCookieStore([]byte(secret))
+	Store = NewServerStore(s, []byte(secret))
 	Store.Options = &sessions.Options{
 		Path:     "/",
 		MaxAge:   86400 * 7, // 7 days
@@ -25,6 +40,19 @@ func InitSessionStore() {
 		SameSite: 2,             // SameSite=Lax (2) - allows cookies on redirects
 		Domain:   "",            // Empty - use default (request host)
 	}
+	flowStore.Options = Store.Options
+
+	if _, err := trustedProxies(); err != nil {
+		log.Println("Ignoring X-Forwarded-For:", err)
+	}
+
+	go func() {
+		for range time.Tick(SessionCleanupInterval) {
+			if err := s.DeleteExpired(context.Background()); err != nil {
+				log.Println("Failed to delete expired sessions:", err)
+			}
+		}
+	}()
 }
 
 func generateRandomSecret(length int) string {
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"backend/internal/apierror"
+	"backend/internal/store"
+	"backend/internal/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/sessions"
+)
+
+// RevokeUserSessions ends every session of a user except the one whose ID is
+// keepSessionID (pass "" to end all of them). A non-empty provider limits
+// revocation to sessions that logged in through that provider.
+func RevokeUserSessions(ctx context.Context, s store.SessionStore, userID int, keepSessionID, provider string) (int64, error) {
+	keepHash := ""
+	if keepSessionID != "" {
+		keepHash = hashSessionID(keepSessionID)
+	}
+	return s.RevokeAll(ctx, userID, keepHash, provider)
+}
+
+// CurrentSessionID returns the ID of the browser session making r, or "" if
+// it was not made with a session cookie
+func CurrentSessionID(r *http.Request) string {
+	return currentSession(r).ID
+}
+
+// currentSession loads the browser session of a request that passed
+// RequireSession, for its ID and cookie. Authentication is left to
+// RequireSession.
+func currentSession(r *http.Request) *sessions.Session {
+	session, err := Store.Get(r, GetSessionCookieName())
+	if err != nil {
+		// The cookie was read once already by Authenticator.Middleware
+		session = sessions.NewSession(Store, GetSessionCookieName())
+	}
+	return session
+}
+
+// HandleListSessions lists the current user's active sessions
+func (h *Handler) HandleListSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := RequireSession(w, r)
+	if !ok {
+		return
+	}
+
+	list, err := h.Sessions.List(r.Context(), userID)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	currentHash := hashSessionID(currentSession(r).ID)
+	for i := range list {
+		list[i].Current = list[i].TokenHash == currentHash
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// HandleRevokeSession ends one session of the current user, e.g.
+// DELETE /api/sessions/12. Revoking the current session logs out.
+func (h *Handler) HandleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := RequireSession(w, r)
+	if !ok {
+		return
+	}
+
+	sessionID, ok := utils.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	tokenHash, err := h.Sessions.Revoke(r.Context(), userID, sessionID)
+	if err == store.ErrNotFound {
+		apierror.Write(w, r, apierror.NotFound("Session not found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, fmt.Errorf("revoke session %d: %w", sessionID, err))
+		return
+	}
+
+	if session := currentSession(r); tokenHash == hashSessionID(session.ID) {
+		session.ID = ""
+		session.Options.MaxAge = -1
+		session.Save(r, w)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Session revoked successfully",
+	})
+}
+
+// HandleRevokeOtherSessions ends every session of the current user except
+// the one making the request
+func (h *Handler) HandleRevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := RequireSession(w, r)
+	if !ok {
+		return
+	}
+
+	revoked, err := RevokeUserSessions(r.Context(), h.Sessions, userID, currentSession(r).ID, "")
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{"revoked": revoked})
+}
@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"backend/internal/storage"
+	"backend/internal/store"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+// newSessionTest points Store at an in-memory session store for one test and
+// returns a Handler on in-memory stores
+func newSessionTest(t *testing.T) (*Handler, *Authenticator) {
+	t.Helper()
+	stores := store.NewMemory().Stores()
+
+	previous, previousFlows := Store, flowStore
+	Store = NewServerStore(stores.Sessions, []byte("test-session-key-0123456789abcdef"))
+	flowStore = sessions.NewCookieStore([]byte("test-session-key-0123456789abcdef"))
+	t.Cleanup(func() { Store, flowStore = previous, previousFlows })
+
+	blobs, err := storage.NewLocal(t.TempDir(), "http://api.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewHandler(stores, blobs), &Authenticator{Tokens: stores.Tokens, Sessions: Store}
+}
+
+// login saves a session for userID logged in through provider and returns
+// its cookie
+func login(t *testing.T, userID int, provider string) *http.Cookie {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/auth/dev/callback", nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) Firefox/120.0")
+	session, err := Store.Get(req, GetSessionCookieName())
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Values["user_id"] = userID
+	session.Values["provider"] = provider
+
+	rec := httptest.NewRecorder()
+	if err := session.Save(req, rec); err != nil {
+		t.Fatal(err)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("got %d cookies, want 1", len(cookies))
+	}
+	return cookies[0]
+}
+
+func TestServerStoreLoadsSavedSession(t *testing.T) {
+	newSessionTest(t)
+	cookie := login(t, 7, DevProviderName)
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/me", nil)
+	req.AddCookie(cookie)
+	session, err := Store.Get(req, GetSessionCookieName())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.IsNew || session.Values["user_id"] != 7 {
+		t.Errorf("session = new %v, user_id %v; want the saved session of user 7", session.IsNew, session.Values["user_id"])
+	}
+}
+
+func TestSessionHandlers(t *testing.T) {
+	api, authenticator := newSessionTest(t)
+	current := login(t, 1, DevProviderName)
+	other := login(t, 1, DevProviderName)
+	login(t, 2, DevProviderName)
+
+	serve := func(h http.HandlerFunc, method, target string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		authenticator.Middleware(h).ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(api.HandleListSessions, http.MethodGet, "/api/sessions", current)
+	var list []struct {
+		Device  string `json:"device"`
+		Current bool   `json:"current"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("listed %d sessions, want 2", len(list))
+	}
+	currents := 0
+	for _, s := range list {
+		if s.Current {
+			currents++
+		}
+		if s.Device != "Firefox on macOS" {
+			t.Errorf("device = %q, want %q", s.Device, "Firefox on macOS")
+		}
+	}
+	if currents != 1 {
+		t.Errorf("%d sessions marked current, want 1", currents)
+	}
+
+	rec = serve(api.HandleRevokeOtherSessions, http.MethodDelete, "/api/sessions", current)
+	var revoked map[string]int64
+	if err := json.NewDecoder(rec.Body).Decode(&revoked); err != nil {
+		t.Fatal(err)
+	}
+	if revoked["revoked"] != 1 {
+		t.Errorf("revoked %d sessions, want 1", revoked["revoked"])
+	}
+
+	if rec := serve(api.HandleListSessions, http.MethodGet, "/api/sessions", other); rec.Code != http.StatusUnauthorized {
+		t.Errorf("revoked session: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if rec := serve(api.HandleListSessions, http.MethodGet, "/api/sessions", current); rec.Code != http.StatusOK {
+		t.Errorf("current session: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
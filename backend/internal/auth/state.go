@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"golang.org/x/oauth2"
+)
+
+// OAuthStateTTL is how long a login attempt may take between the redirect to
+// the provider and the callback
+const OAuthStateTTL = 10 * time.Minute
+
+var (
+	ErrStateMissing  = errors.New("oauth state cookie missing")
+	ErrStateMismatch = errors.New("oauth state mismatch")
+	ErrStateExpired  = errors.New("oauth state expired")
+	ErrStateReplayed = errors.New("oauth state already used")
+)
+
+// usedStates remembers states consumed by this process until they expire, so
+// a replayed callback is rejected even if the cookie was captured
+var usedStates = struct {
+	sync.Mutex
+	m map[string]time.Time
+}{m: make(map[string]time.Time)}
+
+// oauthFlow carries what a login attempt was started for across the
+// redirect to the provider
+type oauthFlow struct {
+	// LinkUserID is set when a logged-in user connects another provider
+	LinkUserID int
+	// Merge allows linking an identity owned by another account by merging
+	// that account into LinkUserID
+	Merge bool
+}
+
+func oauthCookieName(provider string) string {
+	return GetSessionCookieName() + "_oauth_" + provider
+}
+
+// beginOAuthFlow generates a per-login state and PKCE verifier, binds them to
+// the browser in a short-lived signed cookie and returns the options to pass
+// to AuthCodeURL
+func beginOAuthFlow(w http.ResponseWriter, r *http.Request, provider string, flow oauthFlow) (string, []oauth2.AuthCodeOption, error) {
+	state := generateRandomSecret(32)
+	verifier := oauth2.GenerateVerifier()
+
+	// A fresh session is used so a stale or foreign cookie cannot break login
+	session := sessions.NewSession(flowStore, oauthCookieName(provider))
+	session.Options = &sessions.Options{
+		Path:     "/",
+		MaxAge:   int(OAuthStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   Store.Options.Secure,
+		SameSite: http.SameSiteLaxMode,
+	}
+	session.IsNew = true
+	session.Values["state"] = state
+	session.Values["verifier"] = verifier
+	session.Values["expires_at"] = time.Now().Add(OAuthStateTTL).Unix()
+	session.Values["link_user_id"] = flow.LinkUserID
+	session.Values["merge"] = flow.Merge
+
+	if err := session.Save(r, w); err != nil {
+		return "", nil, err
+	}
+
+	return state, []oauth2.AuthCodeOption{oauth2.AccessTypeOffline, oauth2.S256ChallengeOption(verifier)}, nil
+}
+
+// finishOAuthFlow checks the state returned by the provider against the
+// cookie set by beginOAuthFlow, consumes it and returns the option carrying
+// the PKCE verifier for the token exchange
+func finishOAuthFlow(w http.ResponseWriter, r *http.Request, provider string) (oauth2.AuthCodeOption, oauthFlow, error) {
+	var flow oauthFlow
+
+	session, err := flowStore.Get(r, oauthCookieName(provider))
+	if err != nil || session.IsNew {
+		return nil, flow, ErrStateMissing
+	}
+
+	expected, _ := session.Values["state"].(string)
+	verifier, _ := session.Values["verifier"].(string)
+	expiresAt, _ := session.Values["expires_at"].(int64)
+	flow.LinkUserID, _ = session.Values["link_user_id"].(int)
+	flow.Merge, _ = session.Values["merge"].(bool)
+
+	// The cookie is single use whatever the outcome
+	session.Options = &sessions.Options{Path: "/", MaxAge: -1}
+	session.Save(r, w)
+
+	state := r.URL.Query().Get("state")
+	if expected == "" || verifier == "" || subtle.ConstantTimeCompare([]byte(state), []byte(expected)) != 1 {
+		return nil, flow, ErrStateMismatch
+	}
+
+	now := time.Now()
+	if now.Unix() > expiresAt {
+		return nil, flow, ErrStateExpired
+	}
+
+	usedStates.Lock()
+	defer usedStates.Unlock()
+	for s, exp := range usedStates.m {
+		if now.After(exp) {
+			delete(usedStates.m, s)
+		}
+	}
+	if _, used := usedStates.m[state]; used {
+		return nil, flow, ErrStateReplayed
+	}
+	usedStates.m[state] = time.Unix(expiresAt, 0)
+
+	return oauth2.VerifierOption(verifier), flow, nil
+}
@@ -0,0 +1,259 @@
+package auth
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// lastSeenInterval limits how often a session's last-seen time is written
+const lastSeenInterval = time.Minute
+
+// ServerStore is a gorilla/sessions store keeping session data in a
+// store.SessionStore. The cookie only carries a signed random ID, so a
+// session can be listed and revoked server-side.
+type ServerStore struct {
+	Sessions store.SessionStore
+	Codecs   []securecookie.Codec
+	Options  *sessions.Options
+}
+
+// NewServerStore creates a store keeping sessions in s and signing session
+// IDs with the given key pairs
+func NewServerStore(s store.SessionStore, keyPairs ...[]byte) *ServerStore {
+	return &ServerStore{
+		Sessions: s,
+		Codecs:   securecookie.CodecsFromPairs(keyPairs...),
+		Options:  &sessions.Options{Path: "/", MaxAge: 86400 * 7},
+	}
+}
+
+// Get returns a session for the given name, cached for the request
+func (s *ServerStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New loads the session referenced by the request cookie, or returns a new
+// empty session when there is none or it was revoked
+func (s *ServerStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	options := *s.Options
+	session.Options = &options
+	session.IsNew = true
+
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+
+	var id string
+	if err := securecookie.DecodeMulti(name, cookie.Value, &id, s.Codecs...); err != nil {
+		return session, nil
+	}
+
+	stored, err := s.Sessions.Get(r.Context(), hashSessionID(id))
+	if err == store.ErrNotFound {
+		return session, nil
+	}
+	if err != nil {
+		return session, err
+	}
+
+	if err := gob.NewDecoder(bytes.NewReader(stored.Data)).Decode(&session.Values); err != nil {
+		return session, err
+	}
+	session.ID = id
+	session.IsNew = false
+
+	if time.Since(stored.LastSeenAt) > lastSeenInterval {
+		if err := s.Sessions.Touch(r.Context(), stored.TokenHash, clientIP(r)); err != nil {
+			log.Println("Failed to update session last-seen time:", err)
+		}
+	}
+
+	return session, nil
+}
+
+// Save writes the session to the store and sets the cookie. A MaxAge of
+// zero or less deletes the session.
+func (s *ServerStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge <= 0 {
+		if session.ID != "" {
+			if err := s.Sessions.Delete(r.Context(), hashSessionID(session.ID)); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(session.Values); err != nil {
+		return err
+	}
+
+	stored := &models.Session{
+		Data:      data.Bytes(),
+		ExpiresAt: time.Now().Add(time.Duration(session.Options.MaxAge) * time.Second),
+	}
+	stored.UserID, _ = session.Values["user_id"].(int)
+	stored.Provider, _ = session.Values["provider"].(string)
+
+	if session.ID == "" {
+		session.ID = strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
+		stored.TokenHash = hashSessionID(session.ID)
+		stored.UserAgent = r.UserAgent()
+		stored.Device = describeDevice(stored.UserAgent)
+		stored.IP = clientIP(r)
+		if err := s.Sessions.Create(r.Context(), stored); err != nil {
+			return err
+		}
+	} else {
+		stored.TokenHash = hashSessionID(session.ID)
+		if err := s.Sessions.Update(r.Context(), stored); err != nil {
+			return err
+		}
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// Regenerate deletes the stored session and clears its ID so the next Save
+// issues a new one, preventing session fixation on login
+func (s *ServerStore) Regenerate(r *http.Request, session *sessions.Session) error {
+	if session.ID != "" {
+		if err := s.Sessions.Delete(r.Context(), hashSessionID(session.ID)); err != nil {
+			return err
+		}
+	}
+	session.ID = ""
+	session.IsNew = true
+	return nil
+}
+
+func hashSessionID(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+// clientIP returns the address of the client. X-Forwarded-For is only
+// honored when the request comes from a trusted proxy; the client is then
+// the last address in the chain that is not itself a trusted proxy.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	proxies, _ := trustedProxies()
+	if !isTrustedProxy(host, proxies) {
+		return host
+	}
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			break
+		}
+		host = hop
+		if !isTrustedProxy(hop, proxies) {
+			break
+		}
+	}
+	return host
+}
+
+// trustedProxies parses TRUSTED_PROXIES, a comma-separated list of IP
+// addresses and CIDR ranges of the reverse proxies in front of the API
+func trustedProxies() ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		cidr := entry
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q", entry)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func isTrustedProxy(addr string, proxies []*net.IPNet) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range proxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// describeDevice derives a short human-readable device label from a user agent
+func describeDevice(userAgent string) string {
+	var browser, os string
+	switch {
+	case strings.Contains(userAgent, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(userAgent, "Firefox/"):
+		browser = "Firefox"
+	case strings.Contains(userAgent, "Chrome/"):
+		browser = "Chrome"
+	case strings.Contains(userAgent, "Safari/"):
+		browser = "Safari"
+	}
+	switch {
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"):
+		os = "iOS"
+	case strings.Contains(userAgent, "Android"):
+		os = "Android"
+	case strings.Contains(userAgent, "Mac OS X"):
+		os = "macOS"
+	case strings.Contains(userAgent, "Windows"):
+		os = "Windows"
+	case strings.Contains(userAgent, "Linux"):
+		os = "Linux"
+	}
+
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser
+	case os != "":
+		return os
+	default:
+		return "Unknown device"
+	}
+}
@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name      string
+		proxies   string
+		remote    string
+		forwarded string
+		want      string
+	}{
+		{"no proxy", "", "203.0.113.7:4321", "", "203.0.113.7"},
+		{"forwarded from untrusted peer", "", "203.0.113.7:4321", "198.51.100.1", "203.0.113.7"},
+		{"forwarded from other peer", "10.0.0.0/8", "203.0.113.7:4321", "198.51.100.1", "203.0.113.7"},
+		{"trusted proxy", "10.0.0.1", "10.0.0.1:80", "198.51.100.1", "198.51.100.1"},
+		{"spoofed entries before the client", "10.0.0.0/8", "10.0.0.1:80", "1.2.3.4, 198.51.100.1, 10.0.0.2", "198.51.100.1"},
+		{"trusted proxy without header", "10.0.0.0/8", "10.0.0.1:80", "", "10.0.0.1"},
+		{"ipv6 proxy", "::1", "[::1]:80", "2001:db8::5", "2001:db8::5"},
+		{"invalid list trusts nobody", "10.0.0.0/8, bogus", "10.0.0.1:80", "198.51.100.1", "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TRUSTED_PROXIES", tt.proxies)
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remote
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := clientIP(req); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
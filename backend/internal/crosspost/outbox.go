@@ -0,0 +1,156 @@
+package crosspost
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"errors"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+// Job statuses
+const (
+	StatusPending   = models.CrosspostPending
+	StatusRunning   = models.CrosspostRunning
+	StatusSucceeded = models.CrosspostSucceeded
+	StatusFailed    = models.CrosspostFailed
+)
+
+const (
+	// MaxAttempts is how many times a job is tried before it is marked failed
+	MaxAttempts = 8
+	// BaseBackoff is the delay before the first retry; it doubles per attempt
+	BaseBackoff = 30 * time.Second
+	// MaxBackoff caps the delay between retries
+	MaxBackoff = time.Hour
+	// LeaseDuration is how long a claimed job stays reserved for a worker.
+	// Jobs of a crashed worker become claimable again after it.
+	LeaseDuration = 5 * time.Minute
+	// PollInterval is how often idle workers look for due jobs
+	PollInterval = 5 * time.Second
+)
+
+// Job is a queued cross-post of an Otogram post to an external service
+type Job = models.CrosspostJob
+
+// wake lets Notify reach idle workers in this process without waiting for
+// the next poll
+var wake = make(chan struct{}, 1)
+
+// Notify wakes an idle worker after a post with a cross-post job is created
+func Notify() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// Describe fills in the fields of a job shown to the author of its post:
+// the retry time while it is pending and the URL of the delivered post
+func Describe(j *Job) {
+	if j.Status != StatusPending {
+		j.NextAttemptAt = nil
+	}
+	if j.RemoteID != nil && *j.RemoteID != "" && j.Provider == "twitter" {
+		j.RemoteURL = "https://x.com/i/web/status/" + *j.RemoteID
+	}
+}
+
+// worker claims jobs from a CrosspostStore and posts them with the tokens
+// of a ConnectionStore
+type worker struct {
+	jobs        store.CrosspostStore
+	connections store.ConnectionStore
+}
+
+// StartWorkers runs n workers processing due jobs until ctx is cancelled.
+// The returned WaitGroup completes once every worker has stopped.
+func StartWorkers(ctx context.Context, n int, jobs store.CrosspostStore, connections store.ConnectionStore) *sync.WaitGroup {
+	w := &worker{jobs: jobs, connections: connections}
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.work(ctx)
+		}()
+	}
+	return &wg
+}
+
+func (w *worker) work(ctx context.Context) {
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Drain every due job before sleeping again
+		for {
+			job, err := w.jobs.Claim(ctx, LeaseDuration)
+			if err == store.ErrNotFound {
+				break
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Println("Failed to claim cross-post job:", err)
+				}
+				break
+			}
+			w.process(ctx, job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-wake:
+		}
+	}
+}
+
+func (w *worker) process(ctx context.Context, job *Job) {
+	var remoteID string
+	var err error
+	switch job.Provider {
+	case "twitter":
+		remoteID, err = PostToTwitter(ctx, w.connections, job.UserID, job.Text)
+	default:
+		err = permanent(errors.New("unsupported provider " + job.Provider))
+	}
+
+	if err == nil {
+		log.Printf("Successfully cross-posted post ID %d to %s", job.PostID, job.Provider)
+		if err := w.jobs.Succeed(ctx, job.ID, remoteID); err != nil {
+			log.Printf("Failed to record cross-post job %d: %v", job.ID, err)
+		}
+		return
+	}
+
+	log.Printf("Cross-post job %d for post ID %d failed (attempt %d): %v", job.ID, job.PostID, job.Attempts, err)
+
+	var jobErr *jobError
+	isPermanent := errors.As(err, &jobErr) && jobErr.permanent
+	if isPermanent || job.Attempts >= MaxAttempts {
+		err = w.jobs.Fail(ctx, job.ID, err.Error())
+	} else {
+		next := time.Now().Add(Backoff(job.Attempts))
+		if jobErr != nil && next.Before(jobErr.retryAfter) {
+			next = jobErr.retryAfter
+		}
+		err = w.jobs.Retry(ctx, job.ID, err.Error(), next)
+	}
+	if err != nil {
+		log.Printf("Failed to record cross-post job %d: %v", job.ID, err)
+	}
+}
+
+// Backoff returns the delay before the retry following the given attempt
+func Backoff(attempt int) time.Duration {
+	delay := time.Duration(float64(BaseBackoff) * math.Pow(2, float64(attempt-1)))
+	if delay > MaxBackoff || delay <= 0 {
+		return MaxBackoff
+	}
+	return delay
+}
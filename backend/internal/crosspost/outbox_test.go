@@ -0,0 +1,59 @@
+package crosspost
+
+import (
+	"backend/internal/models"
+	"backend/internal/store"
+	"context"
+	"testing"
+)
+
+func TestProcessRecordsOutcome(t *testing.T) {
+	tests := []struct {
+		name       string
+		provider   string
+		wantStatus string
+	}{
+		// Nothing can deliver to an unknown service
+		{"unsupported provider", "myspace", StatusFailed},
+		// A missing token may be connected later
+		{"twitter without token", "twitter", StatusPending},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			mem := store.NewMemory()
+			stores := mem.Stores()
+			user := mem.AddUser(models.User{OAuthID: "alice", OAuthProvider: "dev", DisplayName: "Alice"})
+
+			post := &models.Post{UserID: user.ID, Title: "Song", SongID: "a", SongType: "spotify"}
+			text := func(postID int) string { return "Song" }
+			if err := stores.Posts.Create(ctx, post, store.Crosspost{Provider: tt.provider, Text: text}); err != nil {
+				t.Fatal(err)
+			}
+
+			w := &worker{jobs: stores.Crossposts, connections: stores.Connections}
+			job, err := w.jobs.Claim(ctx, LeaseDuration)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.process(ctx, job)
+
+			jobs, err := stores.Crossposts.Jobs(ctx, post.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(jobs) != 1 {
+				t.Fatalf("got %d jobs, want 1", len(jobs))
+			}
+			if jobs[0].Status != tt.wantStatus || jobs[0].Attempts != 1 || jobs[0].LastError == nil {
+				t.Errorf("job = %s after %d attempts (error %v), want %s after 1 attempt with an error",
+					jobs[0].Status, jobs[0].Attempts, jobs[0].LastError, tt.wantStatus)
+			}
+
+			if _, err := w.jobs.Claim(ctx, LeaseDuration); err != store.ErrNotFound {
+				t.Errorf("second Claim() error = %v, want %v", err, store.ErrNotFound)
+			}
+		})
+	}
+}
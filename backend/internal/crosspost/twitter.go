@@ -0,0 +1,120 @@
+package crosspost
+
+import (
+	"backend/internal/auth"
+	"backend/internal/store"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// twitterAPIURL is the Twitter API v2 endpoint for creating tweets
+const twitterAPIURL = "https://api.twitter.com/2/tweets"
+
+// BuildTweetText prepares the tweet text for a post, leaving room for the URL
+func BuildTweetText(comment, postURL string) string {
+	runes := []rune(comment)
+	if len(runes) > 250 {
+		comment = string(runes[:250]) + "..."
+	}
+	return comment + "\n" + postURL
+}
+
+// PostToTwitter posts a tweet on behalf of a user and returns the tweet ID
+func PostToTwitter(ctx context.Context, connections store.ConnectionStore, userID int, text string) (string, error) {
+	// Get OAuth token, refreshing it if it has expired
+	token, err := auth.NewTokenSource(ctx, connections, userID, "twitter").Token()
+	if errors.Is(err, auth.ErrNeedsReauth) {
+		return "", permanent(err)
+	}
+	if err != nil {
+		return "", fmt.Errorf("no Twitter token found: %w", err)
+	}
+
+	jsonBody, err := json.Marshal(map[string]interface{}{
+		"text": text,
+	})
+	if err != nil {
+		return "", permanent(fmt.Errorf("failed to marshal request: %w", err))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", twitterAPIURL, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to post tweet: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		var errorResponse map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&errorResponse)
+		log.Printf("Twitter API error: %v", errorResponse)
+
+		err := fmt.Errorf("twitter API returned status %d", resp.StatusCode)
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests:
+			return "", rateLimited(err, resp.Header.Get("x-rate-limit-reset"))
+		case resp.StatusCode >= 500:
+			return "", err
+		case resp.StatusCode == http.StatusUnauthorized:
+			// The token was revoked on X; only reconnecting can fix it
+			if err := auth.MarkNeedsReauth(ctx, connections, userID, "twitter"); err != nil {
+				log.Printf("Failed to flag Twitter connection of user %d: %v", userID, err)
+			}
+			return "", permanent(fmt.Errorf("%w: %w", err, auth.ErrNeedsReauth))
+		default:
+			return "", permanent(err)
+		}
+	}
+
+	var created struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		// The tweet exists, so retrying would post it twice
+		log.Printf("Failed to decode Twitter response: %v", err)
+	}
+
+	return created.Data.ID, nil
+}
+
+// jobError carries how a failed attempt should be retried
+type jobError struct {
+	err        error
+	permanent  bool
+	retryAfter time.Time
+}
+
+func (e *jobError) Error() string { return e.err.Error() }
+func (e *jobError) Unwrap() error { return e.err }
+
+// permanent marks an error that retrying cannot fix
+func permanent(err error) error {
+	return &jobError{err: err, permanent: true}
+}
+
+// rateLimited marks an error that should be retried once the rate limit
+// window given as a Unix timestamp has reset
+func rateLimited(err error, reset string) error {
+	jobErr := &jobError{err: err}
+	if seconds, convErr := strconv.ParseInt(reset, 10, 64); convErr == nil {
+		jobErr.retryAfter = time.Unix(seconds, 0)
+	}
+	return jobErr
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %d_%s: versions must be consecutive from 1, want %d", m.Version, m.Name, i+1)
+		}
+	}
+}
+
+func TestLoadMigrationsErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+		want  string
+	}{
+		{
+			"missing down",
+			fstest.MapFS{"m/0001_a.up.sql": {Data: []byte("SELECT 1")}},
+			"needs both up and down",
+		},
+		{
+			"bad name",
+			fstest.MapFS{"m/first.up.sql": {Data: []byte("SELECT 1")}},
+			"must be named",
+		},
+		{
+			"unexpected file",
+			fstest.MapFS{"m/README.md": {Data: []byte("")}},
+			"unexpected migration file",
+		},
+		{
+			"conflicting names",
+			fstest.MapFS{
+				"m/0001_a.up.sql":   {Data: []byte("SELECT 1")},
+				"m/0001_b.down.sql": {Data: []byte("SELECT 1")},
+			},
+			"conflicting names",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadMigrations(tt.files, "m")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS replies;
+DROP TABLE IF EXISTS likes;
+DROP TABLE IF EXISTS oauth_tokens;
+DROP TABLE IF EXISTS posts;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,2 @@
+ALTER TABLE posts DROP CONSTRAINT IF EXISTS posts_song_type_check;
+ALTER TABLE users DROP COLUMN IF EXISTS bio;
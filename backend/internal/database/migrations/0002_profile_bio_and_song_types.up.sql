@@ -0,0 +1,6 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS bio TEXT;
+
+-- Older databases only allowed spotify/youtube/other
+ALTER TABLE posts DROP CONSTRAINT IF EXISTS posts_song_type_check;
+ALTER TABLE posts ADD CONSTRAINT posts_song_type_check
+    CHECK (song_type IN ('spotify', 'youtube', 'applemusic', 'other'));
@@ -0,0 +1 @@
+DELETE FROM users WHERE oauth_id = 'demo_user' AND oauth_provider = 'demo';
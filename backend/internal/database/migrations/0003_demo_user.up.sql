@@ -0,0 +1,6 @@
+INSERT INTO users (id, oauth_id, oauth_provider, display_name, profile_image, bio)
+VALUES (1, 'demo_user', 'demo', 'Demo User', 'https://via.placeholder.com/150', '音楽が大好きです！')
+ON CONFLICT DO NOTHING;
+
+-- Keep the sequence past the explicit ID
+SELECT setval('users_id_seq', (SELECT MAX(id) FROM users));
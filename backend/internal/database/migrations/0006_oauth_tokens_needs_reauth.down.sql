@@ -0,0 +1 @@
+ALTER TABLE oauth_tokens DROP COLUMN IF EXISTS needs_reauth;
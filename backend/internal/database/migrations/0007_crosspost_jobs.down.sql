@@ -0,0 +1 @@
+DROP TABLE IF EXISTS crosspost_jobs;
@@ -0,0 +1,16 @@
+-- Login provider accounts linked to a user. users.oauth_id/oauth_provider
+-- keep the identity the account was created with.
+CREATE TABLE IF NOT EXISTS user_identities (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    provider_user_id VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(provider, provider_user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id);
+
+INSERT INTO user_identities (user_id, provider, provider_user_id)
+SELECT id, oauth_provider, oauth_id FROM users
+ON CONFLICT (provider, provider_user_id) DO NOTHING;
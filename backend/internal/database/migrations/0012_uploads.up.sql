@@ -0,0 +1,17 @@
+-- Images stored through the upload endpoint. sha256 is the hash of the
+-- uploaded bytes, so a user re-uploading the same file gets the stored copy;
+-- size is the total of every variant and counts against the user's quota
+CREATE TABLE IF NOT EXISTS uploads (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    sha256 CHAR(64) NOT NULL,
+    key_prefix VARCHAR(100) NOT NULL UNIQUE,
+    variants JSONB NOT NULL,
+    size BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    -- Refreshed by the orphan sweeper while a profile or post links to the upload
+    last_referenced_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, sha256)
+);
+
+CREATE INDEX IF NOT EXISTS idx_uploads_last_referenced_at ON uploads(last_referenced_at);
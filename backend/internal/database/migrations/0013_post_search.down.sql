@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_posts_tags;
+DROP INDEX IF EXISTS idx_posts_comment_trgm;
+DROP INDEX IF EXISTS idx_posts_title_trgm;
+DROP INDEX IF EXISTS idx_posts_search_text_trgm;
+DROP INDEX IF EXISTS idx_posts_search_vector;
+ALTER TABLE posts DROP COLUMN IF EXISTS search_text, DROP COLUMN IF EXISTS search_vector;
+DROP FUNCTION IF EXISTS post_tags_text(TEXT[]);
@@ -0,0 +1,25 @@
+-- Full-text search over posts. The 'simple' configuration does no stemming,
+-- so it treats every language alike; pg_trgm trigrams match substrings of
+-- text without spaces, such as Japanese, which the tsvector cannot split.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- array_to_string is only STABLE, which generated columns do not allow
+CREATE OR REPLACE FUNCTION post_tags_text(tags TEXT[]) RETURNS TEXT
+    LANGUAGE sql IMMUTABLE PARALLEL SAFE
+    AS $$ SELECT COALESCE(array_to_string(tags, ' '), '') $$;
+
+ALTER TABLE posts
+    ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', COALESCE(title, '')), 'A') ||
+        setweight(to_tsvector('simple', post_tags_text(tags)), 'B') ||
+        setweight(to_tsvector('simple', COALESCE(comment, '')), 'C')
+    ) STORED,
+    ADD COLUMN IF NOT EXISTS search_text TEXT GENERATED ALWAYS AS (
+        COALESCE(title, '') || ' ' || post_tags_text(tags) || ' ' || COALESCE(comment, '')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_posts_search_vector ON posts USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_posts_search_text_trgm ON posts USING GIN (search_text gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_posts_title_trgm ON posts USING GIN (title gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_posts_comment_trgm ON posts USING GIN (comment gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_posts_tags ON posts USING GIN (tags);
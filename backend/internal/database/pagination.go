@@ -0,0 +1,124 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultPageLimit is used when a list request does not specify a limit
+	DefaultPageLimit = 20
+	// MaxPageLimit caps the number of rows a single page may return
+	MaxPageLimit = 100
+)
+
+// ErrInvalidCursor is returned when a cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor points at the last row of a page in a list ordered by (created_at, id),
+// or by (rank, id) for search results
+type Cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        int       `json:"i"`
+	Rank      *float64  `json:"r,omitempty"`
+}
+
+// Encode returns the opaque string form of the cursor handed to clients
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a cursor previously produced by Cursor.Encode
+func DecodeCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID <= 0 || c.CreatedAt.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// PageRequest describes which page of a list to fetch
+type PageRequest struct {
+	Limit  int
+	Cursor *Cursor
+}
+
+// Keyset names the (created_at, id) columns a list is ordered by
+type Keyset struct {
+	CreatedAt string
+	ID        string
+	Ascending bool
+}
+
+// PostKeyset orders posts newest first, matching PostOrderBy
+var PostKeyset = Keyset{CreatedAt: "p.created_at", ID: "p.id"}
+
+// Build appends the WHERE, ORDER BY and LIMIT clauses for page to base.
+// whereClause may reference args as $1..$n; the cursor and limit are bound
+// after them. One extra row is requested so callers can tell whether a next
+// page exists.
+func (k Keyset) Build(base, whereClause string, args []interface{}, page PageRequest) (string, []interface{}) {
+	var conditions []string
+	if whereClause != "" {
+		conditions = append(conditions, "("+whereClause+")")
+	}
+
+	direction, op := "DESC", "<"
+	if k.Ascending {
+		direction, op = "ASC", ">"
+	}
+
+	if page.Cursor != nil {
+		conditions = append(conditions, fmt.Sprintf("(%s, %s) %s ($%d, $%d)", k.CreatedAt, k.ID, op, len(args)+1, len(args)+2))
+		args = append(args, page.Cursor.CreatedAt, page.Cursor.ID)
+	}
+
+	query := base
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s, %s %s LIMIT $%d", k.CreatedAt, direction, k.ID, direction, len(args)+1)
+	args = append(args, page.Limit+1)
+
+	return query, args
+}
+
+// BuildPostPageQuery constructs a paginated post query with optional WHERE clause
+func BuildPostPageQuery(whereClause string, args []interface{}, page PageRequest) (string, []interface{}) {
+	return PostKeyset.Build("SELECT "+PostSelectFields+" "+PostFromClause, whereClause, args, page)
+}
+
+// BuildPostSearchQuery constructs a paginated post query ordered by the rank
+// expression, highest first, then by id. rank may reference args and the p
+// and u tables; its value is selected after PostSelectFields and paginated
+// with Cursor.Rank.
+func BuildPostSearchQuery(rank, whereClause string, args []interface{}, page PageRequest) (string, []interface{}) {
+	var conditions []string
+	if whereClause != "" {
+		conditions = append(conditions, "("+whereClause+")")
+	}
+	if page.Cursor != nil && page.Cursor.Rank != nil {
+		conditions = append(conditions, fmt.Sprintf("(s.rank, p.id) < ($%d, $%d)", len(args)+1, len(args)+2))
+		args = append(args, *page.Cursor.Rank, page.Cursor.ID)
+	}
+
+	// A lateral subquery names the rank so WHERE and ORDER BY can use it
+	query := "SELECT " + PostSelectFields + ", s.rank " + PostFromClause +
+		" CROSS JOIN LATERAL (SELECT (" + rank + ")::double precision AS rank) s"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY s.rank DESC, p.id DESC LIMIT $%d", len(args)+1)
+	args = append(args, page.Limit+1)
+
+	return query, args
+}
@@ -12,7 +12,22 @@ import (
 
 var DB *sql.DB
 
+// InitDB connects to the database and applies pending schema migrations
+// unless DB_AUTO_MIGRATE is "false"
 func InitDB() {
+	Connect()
+
+	if os.Getenv("DB_AUTO_MIGRATE") == "false" {
+		log.Println("Skipping schema migrations (DB_AUTO_MIGRATE=false)")
+		return
+	}
+	if err := MigrateUp(DB); err != nil {
+		log.Fatal("Failed to migrate database: ", err)
+	}
+}
+
+// Connect opens DB, retrying while the database starts up
+func Connect() {
 	var err error
 	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
 		os.Getenv("DB_HOST"),
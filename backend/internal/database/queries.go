@@ -16,8 +16,17 @@ const (
 		LEFT JOIN users u ON p.user_id = u.id
 	`
 
+	// UserSelectFields defines the standard fields to select for users in
+	// public lists; provider account IDs are left out
+	UserSelectFields = `
+		u.id, u.display_name, u.profile_image, u.bio, u.created_at,
+		COALESCE((SELECT COUNT(*) FROM follows f WHERE f.followee_id = u.id), 0) as follower_count,
+		COALESCE((SELECT COUNT(*) FROM follows f WHERE f.follower_id = u.id), 0) as following_count,
+		CASE WHEN $1 > 0 THEN COALESCE((SELECT EXISTS(SELECT 1 FROM follows f WHERE f.follower_id = $1 AND f.followee_id = u.id)), false) ELSE false END as followed_by_current_user
+	`
+
 	// PostOrderBy defines the standard ORDER BY clause for posts
-	PostOrderBy = `ORDER BY p.created_at DESC`
+	PostOrderBy = `ORDER BY p.created_at DESC, p.id DESC`
 )
 
 // BuildPostQuery constructs a complete post query with optional WHERE clause
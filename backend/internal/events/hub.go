@@ -0,0 +1,143 @@
+package events
+
+import (
+	"sync"
+)
+
+const (
+	// DefaultBufferSize is how many recent events the hub keeps for
+	// Last-Event-ID resume
+	DefaultBufferSize = 256
+	// subscriberQueueSize is how many events may be pending for one client
+	// before it is considered too slow and disconnected
+	subscriberQueueSize = 64
+)
+
+// Event types published by the handlers
+const (
+	PostCreated  = "post.created"
+	PostUpdated  = "post.updated"
+	PostDeleted  = "post.deleted"
+	PostLiked    = "post.liked"
+	ReplyCreated = "reply.created"
+	Notification = "notification"
+)
+
+// Event is a single message pushed to stream subscribers. Events with a
+// non-zero UserID are private to that user.
+type Event struct {
+	ID     uint64
+	Type   string
+	UserID int
+	Data   interface{}
+}
+
+// Subscription receives the events visible to one user
+type Subscription struct {
+	hub    *Hub
+	userID int
+	ch     chan Event
+}
+
+// Events returns the channel of live events. It is closed when the
+// subscription is closed or the subscriber falls too far behind.
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Close unsubscribes from the hub
+func (s *Subscription) Close() {
+	s.hub.remove(s)
+}
+
+// Hub is an in-process pub/sub hub fanning events out to stream clients
+type Hub struct {
+	mu          sync.Mutex
+	lastID      uint64
+	buffer      []Event
+	bufferSize  int
+	subscribers map[*Subscription]struct{}
+}
+
+// NewHub creates a hub keeping the last bufferSize events for resume
+func NewHub(bufferSize int) *Hub {
+	return &Hub{
+		bufferSize:  bufferSize,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish sends an event to every subscriber allowed to see it. A userID of
+// 0 broadcasts the event to everyone.
+func (h *Hub) Publish(eventType string, userID int, data interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastID++
+	event := Event{ID: h.lastID, Type: eventType, UserID: userID, Data: data}
+
+	h.buffer = append(h.buffer, event)
+	if len(h.buffer) > h.bufferSize {
+		h.buffer = h.buffer[len(h.buffer)-h.bufferSize:]
+	}
+
+	for sub := range h.subscribers {
+		if !visible(event, sub.userID) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			// Drop clients that stopped reading; they can resume with Last-Event-ID
+			h.removeLocked(sub)
+		}
+	}
+}
+
+// Subscribe registers a subscriber for userID (0 for anonymous clients).
+// Events published after lastEventID are returned for replay; complete is
+// false when some of them are no longer buffered and the client should
+// refetch its state instead.
+func (h *Hub) Subscribe(userID int, lastEventID uint64) (sub *Subscription, replay []Event, complete bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub = &Subscription{hub: h, userID: userID, ch: make(chan Event, subscriberQueueSize)}
+	h.subscribers[sub] = struct{}{}
+
+	complete = true
+	if lastEventID > 0 {
+		switch {
+		case lastEventID > h.lastID:
+			// The ID comes from before a restart
+			complete = false
+		case len(h.buffer) > 0 && lastEventID < h.buffer[0].ID-1:
+			complete = false
+		}
+		for _, event := range h.buffer {
+			if event.ID > lastEventID && visible(event, userID) {
+				replay = append(replay, event)
+			}
+		}
+	}
+
+	return sub, replay, complete
+}
+
+func (h *Hub) remove(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeLocked(sub)
+}
+
+func (h *Hub) removeLocked(sub *Subscription) {
+	if _, ok := h.subscribers[sub]; !ok {
+		return
+	}
+	delete(h.subscribers, sub)
+	close(sub.ch)
+}
+
+func visible(event Event, userID int) bool {
+	return event.UserID == 0 || event.UserID == userID
+}
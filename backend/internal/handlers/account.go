@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"backend/internal/apierror"
+	"backend/internal/auth"
+	"backend/internal/store"
+
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// AccountDeletionGracePeriod returns how long a deletion request can be
+// cancelled before the account is purged, from ACCOUNT_DELETION_GRACE_DAYS
+func AccountDeletionGracePeriod() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("ACCOUNT_DELETION_GRACE_DAYS"))
+	if err != nil || days < 0 {
+		days = 14
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// ExportAccount streams a ZIP archive of everything the current user has
+// stored: profile, posts, replies, likes, follows, linked providers (without
+// tokens) and uploaded images
+func (h *Handler) ExportAccount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.RequireSession(w, r)
+	if !ok {
+		return
+	}
+
+	// Collect everything before writing so a store error can still be
+	// reported with a proper status code
+	files, err := h.Accounts.Export(r.Context(), userID)
+	if err != nil {
+		apierror.Write(w, r, fmt.Errorf("export user %d: %w", userID, err))
+		return
+	}
+
+	uploads, err := h.userUploads(r.Context(), userID)
+	if err != nil {
+		apierror.Write(w, r, fmt.Errorf("list uploads for user %d: %w", userID, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="otogram-export-%d.zip"`, userID))
+
+	archive := zip.NewWriter(w)
+	defer archive.Close()
+
+	for _, file := range files {
+		f, err := archive.Create(file.Name)
+		if err != nil {
+			return
+		}
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if file.Name == "profile.json" && len(file.Records) > 0 {
+			encoder.Encode(file.Records[0])
+		} else {
+			encoder.Encode(file.Records)
+		}
+	}
+
+	for _, key := range uploads {
+		if err := h.addBlobToZip(r.Context(), archive, key, "uploads/"+key); err != nil {
+			log.Printf("Failed to add %s to export: %v", key, err)
+			return
+		}
+	}
+}
+
+// RequestAccountDeletion schedules the current user's account for deletion
+// after the grace period and ends their other sessions. Their access tokens
+// stop working until the deletion is cancelled.
+func (h *Handler) RequestAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.RequireSession(w, r)
+	if !ok {
+		return
+	}
+
+	scheduledAt, err := h.Accounts.ScheduleDeletion(r.Context(), userID, AccountDeletionGracePeriod())
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	// Keep the current session so the request can still be cancelled from it
+	if err := h.Sessions.RevokeOtherSessions(r, userID); err != nil {
+		log.Printf("Failed to revoke sessions of user %d: %v", userID, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":               "Account scheduled for deletion",
+		"deletion_scheduled_at": scheduledAt,
+	})
+}
+
+// CancelAccountDeletion withdraws a pending deletion request
+func (h *Handler) CancelAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.RequireSession(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.Accounts.CancelDeletion(r.Context(), userID)
+	if err == store.ErrNotFound {
+		apierror.Write(w, r, apierror.NotFound("No deletion is pending"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Account deletion cancelled",
+	})
+}
+
+// PurgeDueAccounts deletes every account whose grace period has passed
+func (h *Handler) PurgeDueAccounts(ctx context.Context) {
+	userIDs, err := h.Accounts.DueForDeletion(ctx)
+	if err != nil {
+		log.Println("Failed to find accounts due for deletion:", err)
+		return
+	}
+
+	for _, userID := range userIDs {
+		deleted, err := h.purgeAccount(ctx, userID)
+		if err != nil {
+			log.Printf("Failed to delete account %d: %v", userID, err)
+			continue
+		}
+		if deleted {
+			log.Printf("Deleted account %d", userID)
+		}
+	}
+}
+
+// purgeAccount removes a user, everything they created and their uploaded
+// blobs. It reports false if the deletion was cancelled in the meantime.
+func (h *Handler) purgeAccount(ctx context.Context, userID int) (bool, error) {
+	uploads, err := h.userUploads(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	err = h.Accounts.Delete(ctx, userID)
+	if err == store.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	for _, key := range uploads {
+		if err := h.Blobs.Delete(ctx, key); err != nil {
+			log.Printf("Failed to delete upload %s: %v", key, err)
+		}
+	}
+	return true, nil
+}
+
+// userUploads lists the keys of every variant of the images a user uploaded.
+// Files stored before uploads were recorded have no row, so blobs named
+// after the user's ID are included too.
+func (h *Handler) userUploads(ctx context.Context, userID int) ([]string, error) {
+	uploads, err := h.Uploads.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	legacy, err := h.Blobs.List(ctx, strconv.Itoa(userID)+"_")
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var keys []string
+	add := func(key string) {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	for _, u := range uploads {
+		for _, key := range u.Variants {
+			add(key)
+		}
+	}
+	for _, key := range legacy {
+		add(key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// addBlobToZip copies an uploaded blob into the export archive
+func (h *Handler) addBlobToZip(ctx context.Context, archive *zip.Writer, key, name string) error {
+	src, err := h.Blobs.Open(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
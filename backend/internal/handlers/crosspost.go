@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"backend/internal/apierror"
+	"backend/internal/auth"
+	"backend/internal/crosspost"
+	"backend/internal/utils"
+	"encoding/json"
+	"net/http"
+)
+
+// GetCrosspostStatus reports whether a post reached the external services it
+// was cross-posted to. Only the author of the post may see it.
+func (h *Handler) GetCrosspostStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := auth.RequireUser(w, r, auth.ScopeRead)
+	if !ok {
+		return
+	}
+
+	postID, ok := utils.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	if !h.checkPostOwner(w, r, postID, userID) {
+		return
+	}
+
+	jobs, err := h.Crossposts.Jobs(r.Context(), postID)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	for i := range jobs {
+		crosspost.Describe(&jobs[i])
+	}
+
+	json.NewEncoder(w).Encode(jobs)
+}
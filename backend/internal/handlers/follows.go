@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"backend/internal/apierror"
+	"backend/internal/auth"
+	"backend/internal/database"
+	"backend/internal/models"
+	"backend/internal/store"
+	"backend/internal/utils"
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// FollowUser makes the current user follow the user in the path
+func (h *Handler) FollowUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := auth.RequireUser(w, r, auth.ScopeFollowsWrite)
+	if !ok {
+		return
+	}
+
+	targetID, ok := utils.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	if targetID == userID {
+		apierror.Write(w, r, apierror.BadRequest("Cannot follow yourself"))
+		return
+	}
+
+	if !h.checkUserExists(w, r, targetID) {
+		return
+	}
+
+	inserted, err := h.Follows.Follow(r.Context(), userID, targetID)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	// Only notify on a new follow, not when the request is repeated
+	if inserted {
+		h.Notifier.NotifyFollow(userID, targetID)
+	}
+
+	json.NewEncoder(w).Encode(map[string]bool{"following": true})
+}
+
+// UnfollowUser makes the current user stop following the user in the path
+func (h *Handler) UnfollowUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := auth.RequireUser(w, r, auth.ScopeFollowsWrite)
+	if !ok {
+		return
+	}
+
+	targetID, ok := utils.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.Follows.Unfollow(r.Context(), userID, targetID); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	h.Notifier.RemoveFollowNotification(userID, targetID)
+
+	json.NewEncoder(w).Encode(map[string]bool{"following": false})
+}
+
+// GetFollowers lists the users following the user in the path
+func (h *Handler) GetFollowers(w http.ResponseWriter, r *http.Request) {
+	h.listFollows(w, r, h.Follows.Followers)
+}
+
+// GetFollowing lists the users followed by the user in the path
+func (h *Handler) GetFollowing(w http.ResponseWriter, r *http.Request) {
+	h.listFollows(w, r, h.Follows.Following)
+}
+
+func (h *Handler) listFollows(w http.ResponseWriter, r *http.Request, list func(ctx context.Context, viewerID, userID int, page database.PageRequest) ([]models.User, error)) {
+	w.Header().Set("Content-Type", "application/json")
+
+	currentUserID, _ := auth.CurrentUserID(r)
+
+	targetID, ok := utils.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	page, err := utils.ParsePageRequest(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	if !h.checkUserExists(w, r, targetID) {
+		return
+	}
+
+	users, err := list(r.Context(), currentUserID, targetID, page)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(utils.BuildPage(users, page, utils.FollowCursor))
+}
+
+// checkUserExists writes a 404 response and returns false unless the user
+// exists
+func (h *Handler) checkUserExists(w http.ResponseWriter, r *http.Request, userID int) bool {
+	_, err := h.Users.Get(r.Context(), userID)
+	if err == store.ErrNotFound {
+		apierror.Write(w, r, apierror.NotFound("User not found"))
+		return false
+	}
+	if err != nil {
+		apierror.Write(w, r, err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/events"
+	"backend/internal/storage"
+	"backend/internal/store"
+	"net/http"
+)
+
+// Notifier tells users about likes and replies to their posts and about new
+// followers
+type Notifier interface {
+	NotifyPostOwner(actorID, postID int, verb string, replyID *int)
+	RemovePostNotification(actorID, postID int, verb string)
+	NotifyFollow(actorID, userID int)
+	RemoveFollowNotification(actorID, userID int)
+}
+
+// SessionRevoker ends the browser sessions of a user
+type SessionRevoker interface {
+	// RevokeOtherSessions ends every session of userID except the one
+	// making r
+	RevokeOtherSessions(r *http.Request, userID int) error
+}
+
+// Handler serves the API endpoints that read and write through the stores
+type Handler struct {
+	Posts         store.PostStore
+	Users         store.UserStore
+	Likes         store.LikeStore
+	Replies       store.ReplyStore
+	Uploads       store.UploadStore
+	Follows       store.FollowStore
+	Notifications store.NotificationStore
+	Connections   store.ConnectionStore
+	Crossposts    store.CrosspostStore
+	Accounts      store.AccountStore
+	Blobs         storage.BlobStore
+	Events        *events.Hub
+	Notifier      Notifier
+	Sessions      SessionRevoker
+}
+
+// NewHandler returns a Handler using stores and keeping uploads in blobs,
+// recording notifications in stores.Notifications and publishing feed events
+// and notifications to a new hub
+func NewHandler(stores *store.Stores, blobs storage.BlobStore) *Handler {
+	hub := events.NewHub(events.DefaultBufferSize)
+	return &Handler{
+		Posts:         stores.Posts,
+		Users:         stores.Users,
+		Likes:         stores.Likes,
+		Replies:       stores.Replies,
+		Uploads:       stores.Uploads,
+		Follows:       stores.Follows,
+		Notifications: stores.Notifications,
+		Connections:   stores.Connections,
+		Crossposts:    stores.Crossposts,
+		Accounts:      stores.Accounts,
+		Blobs:         blobs,
+		Events:        hub,
+		Notifier:      &storeNotifier{notifications: stores.Notifications, users: stores.Users, events: hub},
+		Sessions:      authSessions{sessions: stores.Sessions},
+	}
+}
+
+// authSessions revokes the sessions kept in a SessionStore
+type authSessions struct {
+	sessions store.SessionStore
+}
+
+func (a authSessions) RevokeOtherSessions(r *http.Request, userID int) error {
+	_, err := auth.RevokeUserSessions(r.Context(), a.sessions, userID, auth.CurrentSessionID(r), "")
+	return err
+}
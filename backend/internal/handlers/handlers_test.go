@@ -0,0 +1,1489 @@
+package handlers_test
+
+import (
+	"archive/zip"
+	"backend/internal/apierror"
+	"backend/internal/auth"
+	"backend/internal/crosspost"
+	"backend/internal/database"
+	"backend/internal/events"
+	"backend/internal/handlers"
+	"backend/internal/models"
+	"backend/internal/router"
+	"backend/internal/storage"
+	"backend/internal/store"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// recordingNotifier records notifications instead of writing them
+type recordingNotifier struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (n *recordingNotifier) NotifyPostOwner(actorID, postID int, verb string, replyID *int) {
+	n.record("notify", verb)
+}
+
+func (n *recordingNotifier) RemovePostNotification(actorID, postID int, verb string) {
+	n.record("remove", verb)
+}
+
+func (n *recordingNotifier) NotifyFollow(actorID, userID int) {
+	n.record("notify", handlers.VerbFollow)
+}
+
+func (n *recordingNotifier) RemoveFollowNotification(actorID, userID int) {
+	n.record("remove", handlers.VerbFollow)
+}
+
+func (n *recordingNotifier) record(action, verb string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.events = append(n.events, action+" "+verb)
+}
+
+// recordingSessions records which users had their other sessions revoked
+type recordingSessions struct {
+	revoked []int
+}
+
+func (s *recordingSessions) RevokeOtherSessions(r *http.Request, userID int) error {
+	s.revoked = append(s.revoked, userID)
+	return nil
+}
+
+// fixture is a fresh in-memory world for one test case:
+//
+//	user 1 alice, user 2 bob (alice follows bob)
+//	post 1 by alice tagged rock, with a reply by bob
+//	post 2 by bob tagged jazz, liked by alice
+type fixture struct {
+	mem           *store.Memory
+	stores        *store.Stores
+	api           *handlers.Handler
+	authAPI       *auth.Handler
+	notifier      *recordingNotifier
+	revoker       *recordingSessions
+	sessions      *sessions.CookieStore
+	authenticator *auth.Authenticator
+	blobs         *storage.Local
+	server        http.Handler
+	tokens        map[string]string
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	ctx := context.Background()
+
+	mem := store.NewMemory()
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mem.Now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+
+	f := &fixture{
+		mem:      mem,
+		stores:   mem.Stores(),
+		notifier: &recordingNotifier{},
+		revoker:  &recordingSessions{},
+		sessions: sessions.NewCookieStore([]byte("test-session-key-0123456789abcdef")),
+		tokens:   make(map[string]string),
+	}
+	blobs, err := storage.NewLocal(t.TempDir(), "http://api.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.blobs = blobs
+	f.api = handlers.NewHandler(f.stores, blobs)
+	f.api.Notifier = f.notifier
+	f.api.Sessions = f.revoker
+	f.authAPI = auth.NewHandler(f.stores, blobs)
+	f.authenticator = &auth.Authenticator{Tokens: f.stores.Tokens, Sessions: f.sessions}
+	f.server = f.authenticator.Middleware(router.New(router.Routes(f.api, f.authAPI)))
+
+	alice := mem.AddUser(models.User{OAuthID: "alice", OAuthProvider: "dev", DisplayName: "Alice"})
+	bob := mem.AddUser(models.User{OAuthID: "bob", OAuthProvider: "dev", DisplayName: "Bob"})
+	mem.Follow(alice.ID, bob.ID)
+
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(f.stores.Posts.Create(ctx, &models.Post{UserID: alice.ID, Title: "Song A", SongID: "a", SongType: "spotify", Comment: "loud guitars", Tags: []string{"rock"}}))
+	must(f.stores.Posts.Create(ctx, &models.Post{UserID: bob.ID, Title: "Song B", SongID: "b", SongType: "youtube", Comment: "chill vibes", Tags: []string{"jazz"}}))
+	must(f.stores.Replies.Create(ctx, &models.Reply{UserID: bob.ID, PostID: 1, Content: "great pick"}))
+	must(f.stores.Likes.Like(ctx, alice.ID, 2))
+
+	expires := time.Now().Add(time.Hour)
+	issue := func(name string, userID int, scopes ...string) {
+		token, err := auth.IssueAccessToken(ctx, f.stores.Tokens, userID, name, scopes, expires)
+		must(err)
+		f.tokens[name] = token.Token
+	}
+	issue("alice", alice.ID, auth.AllScopes...)
+	issue("alice:read", alice.ID, auth.ScopeRead)
+	issue("bob", bob.ID, auth.AllScopes...)
+
+	return f
+}
+
+// authorize authenticates req as a named token, with a browser session
+// cookie for "session:1", or with the raw bearer token after "bearer:"
+func (f *fixture) authorize(t *testing.T, req *http.Request, as string) {
+	t.Helper()
+	switch {
+	case as == "":
+	case strings.HasPrefix(as, "bearer:"):
+		req.Header.Set("Authorization", "Bearer "+strings.TrimPrefix(as, "bearer:"))
+	case as == "session:1":
+		rec := httptest.NewRecorder()
+		session, _ := f.sessions.New(req, auth.GetSessionCookieName())
+		session.Values["user_id"] = 1
+		if err := session.Save(req, rec); err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range rec.Result().Cookies() {
+			req.AddCookie(c)
+		}
+	default:
+		token, ok := f.tokens[as]
+		if !ok {
+			t.Fatalf("unknown principal %q", as)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// serve sends req through the route table as the server does
+func (f *fixture) serve(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	f.server.ServeHTTP(rec, req)
+	return rec
+}
+
+// decodePage decodes a paginated response
+func decodePage[T any](t *testing.T, body []byte) models.Page[T] {
+	t.Helper()
+	var page models.Page[T]
+	if err := json.Unmarshal(body, &page); err != nil {
+		t.Fatalf("decode page: %v (%s)", err, body)
+	}
+	return page
+}
+
+func decode[T any](t *testing.T, body []byte) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(body, &v); err != nil {
+		t.Fatalf("decode: %v (%s)", err, body)
+	}
+	return v
+}
+
+// errorEnvelope is the JSON body written by apierror.Write
+type errorEnvelope struct {
+	Error struct {
+		Code    apierror.Code         `json:"code"`
+		Message string                `json:"message"`
+		Fields  []apierror.FieldError `json:"fields"`
+	} `json:"error"`
+}
+
+func postIDs(posts []models.Post) []int {
+	ids := []int{}
+	for _, p := range posts {
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestHandlers(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		as     string
+		want   int
+		allow  string
+		code   apierror.Code
+		check  func(t *testing.T, f *fixture, body []byte)
+	}{
+		// Posts
+		{
+			name:   "list posts newest first",
+			method: "GET", path: "/api/posts", want: http.StatusOK,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				page := decodePage[models.Post](t, body)
+				if ids := postIDs(page.Items); !equalInts(ids, []int{2, 1}) {
+					t.Errorf("ids = %v, want [2 1]", ids)
+				}
+				if page.NextCursor != nil {
+					t.Errorf("next_cursor = %v, want nil", *page.NextCursor)
+				}
+			},
+		},
+		{
+			name:   "list posts shows viewer likes",
+			method: "GET", path: "/api/posts", as: "alice", want: http.StatusOK,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				post := decodePage[models.Post](t, body).Items[0]
+				if post.ID != 2 || !post.LikedByCurrentUser || post.LikeCount != 1 {
+					t.Errorf("post = %+v, want post 2 liked by current user", post)
+				}
+			},
+		},
+		{
+			name:   "list posts by user",
+			method: "GET", path: "/api/posts?user_id=1", want: http.StatusOK,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				if ids := postIDs(decodePage[models.Post](t, body).Items); !equalInts(ids, []int{1}) {
+					t.Errorf("ids = %v, want [1]", ids)
+				}
+			},
+		},
+		{
+			name:   "list posts paginates",
+			method: "GET", path: "/api/posts?limit=1", want: http.StatusOK,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				page := decodePage[models.Post](t, body)
+				if len(page.Items) != 1 || page.NextCursor == nil {
+					t.Fatalf("page = %+v, want one item and a next cursor", page)
+				}
+
+				req := httptest.NewRequest("GET", "/api/posts?limit=1&cursor="+*page.NextCursor, nil)
+				next := decodePage[models.Post](t, f.serve(req).Body.Bytes())
+				if ids := postIDs(next.Items); !equalInts(ids, []int{1}) || next.NextCursor != nil {
+					t.Errorf("second page ids = %v, next = %v, want [1] and no cursor", ids, next.NextCursor)
+				}
+			},
+		},
+		{
+			name:   "list posts rejects invalid user_id",
+			method: "GET", path: "/api/posts?user_id=abc", want: http.StatusBadRequest,
+		},
+		{
+			name:   "list posts rejects invalid limit",
+			method: "GET", path: "/api/posts?limit=0", want: http.StatusBadRequest, code: apierror.CodeValidation,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				e := decode[errorEnvelope](t, body).Error
+				if len(e.Fields) != 1 || e.Fields[0].Field != "limit" {
+					t.Errorf("fields = %+v, want limit", e.Fields)
+				}
+			},
+		},
+		{
+			name:   "list posts rejects invalid cursor",
+			method: "GET", path: "/api/posts?cursor=nope", want: http.StatusBadRequest,
+		},
+		{
+			name:   "get post",
+			method: "GET", path: "/api/posts/1", want: http.StatusOK,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				post := decode[models.Post](t, body)
+				if post.Title != "Song A" || post.User == nil || post.User.DisplayName != "Alice" || post.ReplyCount != 1 {
+					t.Errorf("post = %+v", post)
+				}
+				if post.Replies != nil {
+					t.Error("replies embedded without include=replies")
+				}
+			},
+		},
+		{
+			name:   "get post with replies",
+			method: "GET", path: "/api/posts/1?include=replies", want: http.StatusOK,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				post := decode[models.Post](t, body)
+				if post.Replies == nil || len(post.Replies.Items) != 1 || post.Replies.Items[0].Content != "great pick" {
+					t.Errorf("replies = %+v", post.Replies)
+				}
+			},
+		},
+		{
+			name:   "get post rejects invalid replies_limit",
+			method: "GET", path: "/api/posts/1?include=replies&replies_limit=1000", want: http.StatusBadRequest,
+		},
+		{
+			name:   "get missing post",
+			method: "GET", path: "/api/posts/99", want: http.StatusNotFound,
+		},
+		{
+			name:   "get post with invalid id",
+			method: "GET", path: "/api/posts/abc", want: http.StatusNotFound, code: apierror.CodeNotFound,
+		},
+		{
+			name:   "unsupported method on posts",
+			method: "DELETE", path: "/api/posts", as: "alice", want: http.StatusMethodNotAllowed, allow: "GET, HEAD, POST", code: apierror.CodeMethodNotAllowed,
+		},
+		{
+			name:   "unsupported method on a post",
+			method: "POST", path: "/api/posts/1", as: "alice", want: http.StatusMethodNotAllowed, allow: "DELETE, GET, HEAD, PATCH, PUT",
+		},
+		{
+			name:   "create post requires authentication",
+			method: "POST", path: "/api/posts", body: `{"title":"x","song_id":"x","song_type":"other"}`,
+			want: http.StatusUnauthorized, code: apierror.CodeUnauthorized,
+		},
+		{
+			name:   "create post requires posts:write",
+			method: "POST", path: "/api/posts", body: `{"title":"x","song_id":"x","song_type":"other"}`,
+			as: "alice:read", want: http.StatusForbidden,
+		},
+		{
+			name:   "create post rejects too many tags",
+			method: "POST", path: "/api/posts", as: "alice", want: http.StatusBadRequest,
+			body: `{"title":"x","song_id":"x","song_type":"other","tags":["1","2","3","4","5","6","7","8","9","10","11"]}`,
+		},
+		{
+			name:   "create post rejects invalid JSON",
+			method: "POST", path: "/api/posts", body: `{`, as: "alice", want: http.StatusBadRequest,
+		},
+		{
+			name:   "create post",
+			method: "POST", path: "/api/posts", as: "alice", want: http.StatusOK,
+			body: `{"title":"New","song_id":"n","song_type":"other","tags":["pop"]}`,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				post := decode[models.Post](t, body)
+				if post.ID != 3 || post.UserID != 1 {
+					t.Errorf("post = %+v, want id 3 by user 1", post)
+				}
+				if len(f.mem.Crossposts()) != 0 {
+					t.Error("cross-post queued without post_to_twitter")
+				}
+			},
+		},
+		{
+			name:   "create post queues cross-post",
+			method: "POST", path: "/api/posts", as: "alice", want: http.StatusOK,
+			body: `{"title":"New","song_id":"n","song_type":"other","comment":"listen","post_to_twitter":true}`,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				jobs := f.mem.Crossposts()
+				if len(jobs) != 1 || jobs[0].Provider != "twitter" || jobs[0].PostID != 3 {
+					t.Fatalf("jobs = %+v", jobs)
+				}
+				if !strings.Contains(jobs[0].Text, "listen") || !strings.Contains(jobs[0].Text, "/?post_id=3") {
+					t.Errorf("text = %q", jobs[0].Text)
+				}
+			},
+		},
+		{
+			name:   "update post",
+			method: "PATCH", path: "/api/posts/1", body: `{"title":"Renamed"}`, as: "alice", want: http.StatusOK,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				post := decode[models.Post](t, body)
+				if post.Title != "Renamed" || post.Comment != "loud guitars" || len(post.Tags) != 1 {
+					t.Errorf("post = %+v, want only the title changed", post)
+				}
+			},
+		},
+		{
+			name:   "update post clears tags",
+			method: "PUT", path: "/api/posts/1", body: `{"tags":[]}`, as: "alice", want: http.StatusOK,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				if post := decode[models.Post](t, body); len(post.Tags) != 0 {
+					t.Errorf("tags = %v, want none", post.Tags)
+				}
+			},
+		},
+		{
+			name:   "update post of another user",
+			method: "PATCH", path: "/api/posts/1", body: `{"title":"Mine"}`, as: "bob", want: http.StatusForbidden,
+		},
+		{
+			name:   "update missing post",
+			method: "PATCH", path: "/api/posts/99", body: `{"title":"x"}`, as: "alice", want: http.StatusNotFound,
+		},
+		{
+			name:   "update post rejects too many tags",
+			method: "PATCH", path: "/api/posts/1", as: "alice", want: http.StatusBadRequest,
+			body: `{"tags":["1","2","3","4","5","6","7","8","9","10","11"]}`,
+		},
+		{
+			name:   "delete post",
+			method: "DELETE", path: "/api/posts/1", as: "alice", want: http.StatusOK,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				if _, err := f.stores.Posts.Get(context.Background(), 0, 1); err != store.ErrNotFound {
+					t.Errorf("post still exists: err = %v", err)
+				}
+			},
+		},
+		{
+			name:   "delete post of another user",
+			method: "DELETE", path: "/api/posts/1", as: "bob", want: http.StatusForbidden,
+		},
+		{
+			name:   "delete post requires authentication",
+			method: "DELETE", path: "/api/posts/1", want: http.StatusUnauthorized,
+		},
+
+		// Likes
+		{
+			name:   "like post",
+			method: "POST", path: "/api/posts/1/like", as: "bob", want: http.StatusOK,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				if got := decode[map[string]bool](t, body); !got["liked"] {
+					t.Errorf("liked = false, want true")
+				}
+				if strings.Join(f.notifier.events, ",") != "notify like" {
+					t.Errorf("notifications = %v", f.notifier.events)
+				}
+			},
+		},
+		{
+			name:   "unlike post",
+			method: "POST", path: "/api/posts/2/like", as: "alice", want: http.StatusOK,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				if got := decode[map[string]bool](t, body); got["liked"] {
+					t.Errorf("liked = true, want false")
+				}
+				if n, _ := f.stores.Likes.Count(context.Background(), 2); n != 0 {
+					t.Errorf("like count = %d, want 0", n)
+				}
+				if strings.Join(f.notifier.events, ",") != "remove like" {
+					t.Errorf("notifications = %v", f.notifier.events)
+				}
+			},
+		},
+		{
+			name:   "like requires likes:write",
+			method: "POST", path: "/api/posts/1/like", as: "alice:read", want: http.StatusForbidden,
+		},
+		{
+			name:   "like requires POST",
+			method: "GET", path: "/api/posts/1/like", as: "alice", want: http.StatusMethodNotAllowed, allow: "POST",
+		},
+		{
+			name:   "like post with invalid id",
+			method: "POST", path: "/api/posts/abc/like", as: "alice", want: http.StatusNotFound,
+		},
+		{
+			name:   "like missing post",
+			method: "POST", path: "/api/posts/99/like", as: "alice", want: http.StatusNotFound, code: apierror.CodeNotFound,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				if len(f.notifier.events) != 0 {
+					t.Errorf("notifications = %v", f.notifier.events)
+				}
+			},
+		},
+
+		// Replies
+		{
+			name:   "create reply",
+			method: "POST", path: "/api/posts/1/reply", body: `{"content":"thanks"}`, as: "alice", want: http.StatusOK,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				reply := decode[models.Reply](t, body)
+				if reply.PostID != 1 || reply.UserID != 1 || reply.User == nil || reply.User.DisplayName != "Alice" {
+					t.Errorf("reply = %+v", reply)
+				}
+				if strings.Join(f.notifier.events, ",") != "notify reply" {
+					t.Errorf("notifications = %v", f.notifier.events)
+				}
+			},
+		},
+		{
+			name:   "create reply requires content",
+			method: "POST", path: "/api/posts/1/reply", body: `{"content":""}`, as: "alice", want: http.StatusBadRequest,
+		},
+		{
+			name:   "create reply requires authentication",
+			method: "POST", path: "/api/posts/1/reply", body: `{"content":"hi"}`, want: http.StatusUnauthorized,
+		},
+		{
+			name:   "create reply on missing post",
+			method: "POST", path: "/api/posts/99/reply", body: `{"content":"hi"}`, as: "alice", want: http.StatusNotFound, code: apierror.CodeNotFound,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				if len(f.notifier.events) != 0 {
+					t.Errorf("notifications = %v", f.notifier.events)
+				}
+			},
+		},
+		{
+			name:   "list replies",
+			method: "GET", path: "/api/posts/1/replies", want: http.StatusOK,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				page := decodePage[models.Reply](t, body)
+				if len(page.Items) != 1 || page.Items[0].User == nil || page.Items[0].User.DisplayName != "Bob" {
+					t.Errorf("replies = %+v", page.Items)
+				}
+			},
+		},
+
+		// Search
+		{
+			name:   "search posts requires q",
+			method: "GET", path: "/api/search/posts", want: http.StatusBadRequest,
+		},
+		{
+			name:   "search posts by comment",
+			method: "GET", path: "/api/search/posts?q=CHILL", want: http.StatusOK,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				if ids := postIDs(decodePage[models.Post](t, body).Items); !equalInts(ids, []int{2}) {
+					t.Errorf("ids = %v, want [2]", ids)
+				}
+			},
+		},
+		{
+			name:   "search posts by tag",
+			method: "GET", path: "/api/search/posts?q=rock&type=tag", want: http.StatusOK,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				if ids := postIDs(decodePage[models.Post](t, body).Items); !equalInts(ids, []int{1}) {
+					t.Errorf("ids = %v, want [1]", ids)
+				}
+			},
+		},
+		{
+			name:   "search users",
+			method: "GET", path: "/api/search/users?q=bo", as: "alice", want: http.StatusOK,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				users := decodePage[models.User](t, body).Items
+				if len(users) != 1 || users[0].DisplayName != "Bob" || !users[0].FollowedByCurrentUser || users[0].FollowerCount != 1 {
+					t.Errorf("users = %+v", users)
+				}
+				if len(users) == 1 && users[0].OAuthID != "" {
+					t.Errorf("oauth_id = %q, want it left out of public lists", users[0].OAuthID)
+				}
+			},
+		},
+
+		// Timeline
+		{
+			name:   "timeline lists followed users' posts",
+			method: "GET", path: "/api/timeline", as: "alice", want: http.StatusOK,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				if ids := postIDs(decodePage[models.Post](t, body).Items); !equalInts(ids, []int{2}) {
+					t.Errorf("ids = %v, want [2]", ids)
+				}
+			},
+		},
+		{
+			name:   "timeline requires authentication",
+			method: "GET", path: "/api/timeline", want: http.StatusUnauthorized,
+		},
+
+		// Follows
+		{
+			name:   "follow user",
+			method: "POST", path: "/api/users/1/follow", as: "bob", want: http.StatusOK,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				if got := decode[map[string]bool](t, body); !got["following"] {
+					t.Error("following = false, want true")
+				}
+				if strings.Join(f.notifier.events, ",") != "notify follow" {
+					t.Errorf("notifications = %v", f.notifier.events)
+				}
+				followers, _ := f.stores.Follows.Followers(context.Background(), 0, 1, database.PageRequest{Limit: 10})
+				if len(followers) != 1 || followers[0].ID != 2 {
+					t.Errorf("followers of alice = %+v", followers)
+				}
+			},
+		},
+		{
+			name:   "follow again does not notify",
+			method: "POST", path: "/api/users/2/follow", as: "alice", want: http.StatusOK,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				if len(f.notifier.events) != 0 {
+					t.Errorf("notifications = %v", f.notifier.events)
+				}
+			},
+		},
+		{
+			name:   "follow yourself",
+			method: "POST", path: "/api/users/1/follow", as: "alice", want: http.StatusBadRequest,
+		},
+		{
+			name:   "follow missing user",
+			method: "POST", path: "/api/users/99/follow", as: "alice", want: http.StatusNotFound, code: apierror.CodeNotFound,
+		},
+		{
+			name:   "follow requires follows:write",
+			method: "POST", path: "/api/users/2/follow", as: "alice:read", want: http.StatusForbidden,
+		},
+		{
+			name:   "unfollow user",
+			method: "DELETE", path: "/api/users/2/follow", as: "alice", want: http.StatusOK,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				if got := decode[map[string]bool](t, body); got["following"] {
+					t.Error("following = true, want false")
+				}
+				if strings.Join(f.notifier.events, ",") != "remove follow" {
+					t.Errorf("notifications = %v", f.notifier.events)
+				}
+				following, _ := f.stores.Follows.Following(context.Background(), 0, 1, database.PageRequest{Limit: 10})
+				if len(following) != 0 {
+					t.Errorf("alice still follows %+v", following)
+				}
+			},
+		},
+		{
+			name:   "list followers",
+			method: "GET", path: "/api/users/2/followers", want: http.StatusOK,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				users := decodePage[models.User](t, body).Items
+				if len(users) != 1 || users[0].DisplayName != "Alice" || users[0].FollowedAt == nil || users[0].FollowingCount != 1 {
+					t.Errorf("followers = %+v", users)
+				}
+				if strings.Contains(string(body), `"oauth_id":"alice"`) {
+					t.Errorf("followers include the provider account ID: %s", body)
+				}
+			},
+		},
+		{
+			name:   "list following as viewer",
+			method: "GET", path: "/api/users/1/following", as: "alice", want: http.StatusOK,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				users := decodePage[models.User](t, body).Items
+				if len(users) != 1 || users[0].DisplayName != "Bob" || !users[0].FollowedByCurrentUser {
+					t.Errorf("following = %+v", users)
+				}
+			},
+		},
+		{
+			name:   "list followers of missing user",
+			method: "GET", path: "/api/users/99/followers", want: http.StatusNotFound, code: apierror.CodeNotFound,
+		},
+
+		// Cross-posting
+		{
+			name:   "crosspost status of post without jobs",
+			method: "GET", path: "/api/posts/1/crosspost", as: "alice", want: http.StatusOK,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				if strings.TrimSpace(string(body)) != "[]" {
+					t.Errorf("jobs = %s, want []", body)
+				}
+			},
+		},
+		{
+			name:   "crosspost status is only shown to the author",
+			method: "GET", path: "/api/posts/1/crosspost", as: "bob", want: http.StatusForbidden,
+		},
+		{
+			name:   "twitter not connected",
+			method: "GET", path: "/api/twitter/check", as: "alice", want: http.StatusOK,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				if got := decode[map[string]bool](t, body); got["connected"] || got["needs_reauth"] {
+					t.Errorf("status = %v", got)
+				}
+			},
+		},
+
+		// Account
+		{
+			name:   "request account deletion",
+			method: "DELETE", path: "/api/me", as: "session:1", want: http.StatusAccepted,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				user, _ := f.stores.Users.Get(context.Background(), 1)
+				if user.DeletionScheduledAt == nil {
+					t.Error("deletion not scheduled")
+				}
+				if !equalInts(f.revoker.revoked, []int{1}) {
+					t.Errorf("revoked sessions of %v, want [1]", f.revoker.revoked)
+				}
+			},
+		},
+		{
+			name:   "account deletion requires a browser session",
+			method: "DELETE", path: "/api/me", as: "alice", want: http.StatusForbidden,
+		},
+		{
+			name:   "cancel account deletion without a pending one",
+			method: "POST", path: "/api/me/cancel-deletion", as: "session:1", want: http.StatusNotFound, code: apierror.CodeNotFound,
+		},
+
+		// Current user and profile
+		{
+			name:   "get current user",
+			method: "GET", path: "/auth/me", as: "alice:read", want: http.StatusOK,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				if user := decode[models.User](t, body); user.ID != 1 || user.DisplayName != "Alice" {
+					t.Errorf("user = %+v", user)
+				}
+			},
+		},
+		{
+			name:   "get current user requires authentication",
+			method: "GET", path: "/auth/me", want: http.StatusUnauthorized,
+		},
+		{
+			name:   "invalid bearer token is not authenticated",
+			method: "GET", path: "/auth/me", as: "bearer:otg_invalid", want: http.StatusUnauthorized,
+		},
+		{
+			name:   "update profile",
+			method: "POST", path: "/auth/profile", body: `{"display_name":"Alice B","bio":"hi"}`, as: "alice", want: http.StatusOK,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				if user := decode[models.User](t, body); user.DisplayName != "Alice B" || user.Bio != "hi" {
+					t.Errorf("user = %+v", user)
+				}
+			},
+		},
+		{
+			name:   "update profile requires display name",
+			method: "POST", path: "/auth/profile", body: `{"display_name":""}`, as: "alice", want: http.StatusBadRequest,
+		},
+		{
+			name:   "update profile requires profile:write",
+			method: "POST", path: "/auth/profile", body: `{"display_name":"x"}`, as: "alice:read", want: http.StatusForbidden,
+		},
+
+		// Personal access tokens
+		{
+			name:   "list tokens",
+			method: "GET", path: "/api/tokens", as: "session:1", want: http.StatusOK,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				tokens := decode[[]models.AccessToken](t, body)
+				if len(tokens) != 2 {
+					t.Fatalf("got %d tokens, want 2", len(tokens))
+				}
+				for _, token := range tokens {
+					if token.Token != "" {
+						t.Error("listed token includes its secret")
+					}
+				}
+			},
+		},
+		{
+			name:   "token endpoints require a browser session",
+			method: "GET", path: "/api/tokens", as: "alice", want: http.StatusForbidden,
+		},
+		{
+			name:   "create token",
+			method: "POST", path: "/api/tokens", body: `{"name":"bot","scopes":["read"]}`, as: "session:1", want: http.StatusCreated,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				token := decode[models.AccessToken](t, body)
+				if !strings.HasPrefix(token.Token, auth.AccessTokenPrefix) || !strings.HasPrefix(token.Token, token.Prefix) {
+					t.Errorf("token = %+v", token)
+				}
+
+				req := httptest.NewRequest("GET", "/auth/me", nil)
+				req.Header.Set("Authorization", "Bearer "+token.Token)
+				if rec := f.serve(req); rec.Code != http.StatusOK {
+					t.Errorf("new token: status = %d, want %d", rec.Code, http.StatusOK)
+				}
+			},
+		},
+		{
+			name:   "create token rejects unknown scope",
+			method: "POST", path: "/api/tokens", body: `{"name":"bot","scopes":["admin"]}`, as: "session:1", want: http.StatusBadRequest,
+		},
+		{
+			name:   "revoke token",
+			method: "DELETE", path: "/api/tokens/1", as: "session:1", want: http.StatusOK,
+			check: func(t *testing.T, f *fixture, body []byte) {
+				req := httptest.NewRequest("GET", "/auth/me", nil)
+				f.authorize(t, req, "alice")
+				if rec := f.serve(req); rec.Code != http.StatusUnauthorized {
+					t.Errorf("revoked token: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+				}
+			},
+		},
+		{
+			name:   "revoke token of another user",
+			method: "DELETE", path: "/api/tokens/3", as: "session:1", want: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			f.authorize(t, req, tt.as)
+
+			rec := f.serve(req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d (body: %s)", rec.Code, tt.want, strings.TrimSpace(rec.Body.String()))
+			}
+			if allow := rec.Header().Get("Allow"); allow != tt.allow {
+				t.Errorf("Allow = %q, want %q", allow, tt.allow)
+			}
+			if tt.code != "" {
+				e := decode[errorEnvelope](t, rec.Body.Bytes()).Error
+				if e.Code != tt.code || e.Message == "" {
+					t.Errorf("error = %+v, want code %q with a message", e, tt.code)
+				}
+			}
+			if tt.check != nil {
+				tt.check(t, f, rec.Body.Bytes())
+			}
+		})
+	}
+}
+
+func TestSearchPosts(t *testing.T) {
+	newSearchFixture := func(t *testing.T) *fixture {
+		f := newFixture(t)
+		for _, p := range []models.Post{
+			{UserID: 1, Title: "Ballad", SongID: "c", SongType: "other", Comment: "a <night> drive song", Tags: []string{"slow"}},
+			{UserID: 2, Title: "Night Drive", SongID: "d", SongType: "other", Comment: "late synth", Tags: []string{"synth"}},
+			{UserID: 2, Title: "夜の歌", SongID: "e", SongType: "other", Comment: "この音楽が好き", Tags: []string{"jpop"}},
+		} {
+			if err := f.stores.Posts.Create(context.Background(), &p); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return f
+	}
+	search := func(t *testing.T, f *fixture, query string) models.Page[models.Post] {
+		t.Helper()
+		rec := f.serve(httptest.NewRequest("GET", "/api/search/posts?"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d (body: %s)", rec.Code, rec.Body)
+		}
+		return decodePage[models.Post](t, rec.Body.Bytes())
+	}
+
+	t.Run("ranks title matches first with snippets", func(t *testing.T) {
+		f := newSearchFixture(t)
+		page := search(t, f, "q=night+drive")
+		if ids := postIDs(page.Items); !equalInts(ids, []int{4, 3}) {
+			t.Fatalf("ids = %v, want [4 3]", ids)
+		}
+		if got, want := page.Items[1].Snippet, "a &lt;<mark>night</mark>&gt; <mark>drive</mark> song"; got != want {
+			t.Errorf("comment snippet = %q, want %q", got, want)
+		}
+		if got, want := page.Items[0].Snippet, "<mark>Night</mark> <mark>Drive</mark>"; got != want {
+			t.Errorf("title snippet = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("matches japanese substrings", func(t *testing.T) {
+		f := newSearchFixture(t)
+		page := search(t, f, "q="+url.QueryEscape("音楽"))
+		if ids := postIDs(page.Items); !equalInts(ids, []int{5}) || page.Items[0].Snippet != "この<mark>音楽</mark>が好き" {
+			t.Errorf("items = %+v", page.Items)
+		}
+	})
+
+	t.Run("paginates by rank", func(t *testing.T) {
+		f := newSearchFixture(t)
+		first := search(t, f, "q=night&limit=1")
+		if ids := postIDs(first.Items); !equalInts(ids, []int{4}) || first.NextCursor == nil {
+			t.Fatalf("first page = %+v", first)
+		}
+		second := search(t, f, "q=night&limit=1&cursor="+*first.NextCursor)
+		if ids := postIDs(second.Items); !equalInts(ids, []int{3}) || second.NextCursor != nil {
+			t.Errorf("second page ids = %v, next = %v, want [3] and no cursor", ids, second.NextCursor)
+		}
+	})
+
+	t.Run("structured query", func(t *testing.T) {
+		f := newSearchFixture(t)
+		for query, want := range map[string][]int{
+			"night from:bob -tag:slow":        {4},
+			"from:ALICE type:other":           {3},
+			`"drive song" after:2024-01-01`:   {3},
+			"before:2024-01-01":               {},
+			"tag:rock":                        {1},
+			"-tag:rock -tag:jazz -type:other": {},
+			"title:夜 -x":                      {5},
+		} {
+			if ids := postIDs(search(t, f, "q="+url.QueryEscape(query)).Items); !equalInts(ids, want) {
+				t.Errorf("%s: ids = %v, want %v", query, ids, want)
+			}
+		}
+	})
+
+	t.Run("reports malformed queries", func(t *testing.T) {
+		f := newSearchFixture(t)
+		rec := f.serve(httptest.NewRequest("GET", "/api/search/posts?q="+url.QueryEscape(`rock year:2024`), nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+		}
+		e := decode[errorEnvelope](t, rec.Body.Bytes()).Error
+		if e.Code != apierror.CodeValidation || len(e.Fields) != 1 || e.Fields[0].Field != "q" || !strings.Contains(e.Message, `at character 6: unknown filter "year:"`) {
+			t.Errorf("error = %+v", e)
+		}
+	})
+
+	t.Run("rejects chronological cursors and unknown boosts", func(t *testing.T) {
+		f := newSearchFixture(t)
+		posts := decodePage[models.Post](t, f.serve(httptest.NewRequest("GET", "/api/posts?limit=1", nil)).Body.Bytes())
+		for _, query := range []string{"q=night&cursor=" + *posts.NextCursor, "q=night&boost=old"} {
+			rec := f.serve(httptest.NewRequest("GET", "/api/search/posts?"+query, nil))
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("%s: status = %d, want %d", query, rec.Code, http.StatusBadRequest)
+			}
+		}
+		if page := search(t, f, "q=night&boost=recent"); len(page.Items) != 2 {
+			t.Errorf("boost=recent items = %v, want 2", postIDs(page.Items))
+		}
+	})
+}
+
+func TestUploadImage(t *testing.T) {
+	upload := func(f *fixture, as, filename string, data []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile("image", filename)
+		part.Write(data)
+		form.Close()
+
+		req := httptest.NewRequest("POST", "/api/upload/image", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		f.authorize(t, req, as)
+		return f.serve(req)
+	}
+
+	var pngData bytes.Buffer
+	png.Encode(&pngData, image.NewNRGBA(image.Rect(0, 0, 300, 100)))
+
+	t.Run("stores every variant", func(t *testing.T) {
+		f := newFixture(t)
+		rec := upload(f, "alice", "avatar.png", pngData.Bytes())
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d (body: %s)", rec.Code, rec.Body)
+		}
+
+		got := decode[struct {
+			URL  string            `json:"url"`
+			URLs map[string]string `json:"urls"`
+		}](t, rec.Body.Bytes())
+		if len(got.URLs) != 3 || got.URL != got.URLs["1024"] {
+			t.Fatalf("response = %+v", got)
+		}
+
+		keys, _ := f.blobs.List(context.Background(), "1_")
+		if len(keys) != 3 {
+			t.Fatalf("stored keys = %v, want 3 of user 1", keys)
+		}
+		for size, url := range got.URLs {
+			if !strings.HasPrefix(url, "http://api.test/uploads/1_") || !strings.HasSuffix(url, "_"+size+".png") {
+				t.Errorf("url %s = %s", size, url)
+			}
+		}
+
+		req := httptest.NewRequest("GET", strings.TrimPrefix(got.URLs["64"], "http://api.test"), nil)
+		served := f.serve(req)
+		if served.Code != http.StatusOK || served.Header().Get("Content-Type") != "image/png" || served.Header().Get("X-Content-Type-Options") != "nosniff" {
+			t.Errorf("serving upload: status %d, headers %v", served.Code, served.Header())
+		}
+	})
+
+	t.Run("rejects html labelled as an image", func(t *testing.T) {
+		f := newFixture(t)
+		rec := upload(f, "alice", "avatar.png", []byte("<html><script>alert(1)</script></html>"))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+		}
+		if keys, _ := f.blobs.List(context.Background(), ""); len(keys) != 0 {
+			t.Errorf("stored %v", keys)
+		}
+	})
+
+	t.Run("requires authentication", func(t *testing.T) {
+		f := newFixture(t)
+		if rec := upload(f, "", "avatar.png", pngData.Bytes()); rec.Code != http.StatusUnauthorized {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("same file is stored once", func(t *testing.T) {
+		f := newFixture(t)
+		first := upload(f, "alice", "avatar.png", pngData.Bytes())
+		second := upload(f, "alice", "copy.png", pngData.Bytes())
+		if second.Code != http.StatusOK || second.Body.String() != first.Body.String() {
+			t.Fatalf("second upload: status %d, body %s, want %s", second.Code, second.Body, first.Body)
+		}
+		if keys, _ := f.blobs.List(context.Background(), "1_"); len(keys) != 3 {
+			t.Errorf("stored keys = %v, want 3", keys)
+		}
+
+		// Other users get their own copy
+		upload(f, "bob", "avatar.png", pngData.Bytes())
+		if keys, _ := f.blobs.List(context.Background(), "2_"); len(keys) != 3 {
+			t.Errorf("stored keys of bob = %v, want 3", keys)
+		}
+	})
+
+	t.Run("quota", func(t *testing.T) {
+		f := newFixture(t)
+		t.Setenv("UPLOAD_QUOTA_MB", "0")
+		rec := upload(f, "alice", "avatar.png", pngData.Bytes())
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("status = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+		}
+		if e := decode[errorEnvelope](t, rec.Body.Bytes()).Error; e.Code != apierror.CodeQuotaExceeded {
+			t.Errorf("code = %q, want %q", e.Code, apierror.CodeQuotaExceeded)
+		}
+		if keys, _ := f.blobs.List(context.Background(), ""); len(keys) != 0 {
+			t.Errorf("stored %v", keys)
+		}
+	})
+
+	t.Run("orphans are swept after the grace period", func(t *testing.T) {
+		f := newFixture(t)
+		ctx := context.Background()
+		other := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+		other.Pix[3] = 255
+		var otherData bytes.Buffer
+		png.Encode(&otherData, other)
+
+		avatar := decode[struct {
+			URL string `json:"url"`
+		}](t, upload(f, "alice", "avatar.png", pngData.Bytes()).Body.Bytes())
+		upload(f, "alice", "unused.png", otherData.Bytes())
+		if err := f.stores.Users.UpdateProfile(ctx, 1, "Alice", avatar.URL, ""); err != nil {
+			t.Fatal(err)
+		}
+
+		t.Setenv("UPLOAD_ORPHAN_GRACE_HOURS", "1")
+		f.api.SweepOrphanUploads(ctx)
+		if keys, _ := f.blobs.List(ctx, "1_"); len(keys) != 6 {
+			t.Fatalf("within the grace period: stored keys = %v, want 6", keys)
+		}
+
+		t.Setenv("UPLOAD_ORPHAN_GRACE_HOURS", "0")
+		f.api.SweepOrphanUploads(ctx)
+		keys, _ := f.blobs.List(ctx, "1_")
+		if len(keys) != 3 {
+			t.Fatalf("after the grace period: stored keys = %v, want the 3 of the avatar", keys)
+		}
+		if prefix := strings.TrimSuffix(strings.TrimPrefix(avatar.URL, "http://api.test/uploads/"), "_1024.png"); !strings.HasPrefix(keys[0], prefix) {
+			t.Errorf("kept %v, want the avatar %s", keys, avatar.URL)
+		}
+
+		// Replacing the avatar orphans the old one
+		if err := f.stores.Users.UpdateProfile(ctx, 1, "Alice", "", ""); err != nil {
+			t.Fatal(err)
+		}
+		f.api.SweepOrphanUploads(ctx)
+		if keys, _ := f.blobs.List(ctx, "1_"); len(keys) != 0 {
+			t.Errorf("after replacing the avatar: stored keys = %v", keys)
+		}
+	})
+
+	t.Run("uploads served from S3_PUBLIC_URL are not orphans", func(t *testing.T) {
+		f := newFixture(t)
+		ctx := context.Background()
+		avatar := decode[struct {
+			URL string `json:"url"`
+		}](t, upload(f, "alice", "avatar.png", pngData.Bytes()).Body.Bytes())
+		cdnURL := strings.Replace(avatar.URL, "http://api.test/uploads/", "https://cdn.example.com/", 1)
+		if err := f.stores.Users.UpdateProfile(ctx, 1, "Alice", cdnURL, ""); err != nil {
+			t.Fatal(err)
+		}
+
+		t.Setenv("UPLOAD_ORPHAN_GRACE_HOURS", "0")
+		f.api.SweepOrphanUploads(ctx)
+		if keys, _ := f.blobs.List(ctx, "1_"); len(keys) != 3 {
+			t.Errorf("stored keys = %v, want the 3 of the avatar at %s", keys, cdnURL)
+		}
+	})
+
+	t.Run("uploads directory is not listed", func(t *testing.T) {
+		f := newFixture(t)
+		upload(f, "alice", "avatar.png", pngData.Bytes())
+		if rec := f.serve(httptest.NewRequest("GET", "/uploads/", nil)); rec.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+		}
+	})
+}
+
+func TestNotifications(t *testing.T) {
+	do := func(t *testing.T, f *fixture, method, path, body, as string) []byte {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		f.authorize(t, req, as)
+		rec := f.serve(req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s %s: status = %d (body: %s)", method, path, rec.Code, rec.Body)
+		}
+		return rec.Body.Bytes()
+	}
+	type notifications struct {
+		models.Page[models.Notification]
+		UnreadCount int `json:"unread_count"`
+	}
+	newNotificationFixture := func(t *testing.T) *fixture {
+		f := newFixture(t)
+		// Record notifications in the store rather than f.notifier
+		api := handlers.NewHandler(f.stores, f.blobs)
+		f.api.Notifier, f.api.Events = api.Notifier, api.Events
+		return f
+	}
+
+	t.Run("likes, replies and follows notify", func(t *testing.T) {
+		f := newNotificationFixture(t)
+		do(t, f, "POST", "/api/posts/1/like", "", "bob")
+		do(t, f, "POST", "/api/posts/1/reply", `{"content":"nice"}`, "bob")
+		do(t, f, "POST", "/api/users/1/follow", "", "bob")
+		// Acting on your own post notifies nobody
+		do(t, f, "POST", "/api/posts/1/like", "", "alice")
+
+		got := decode[notifications](t, do(t, f, "GET", "/api/notifications", "", "alice"))
+		var verbs []string
+		for _, n := range got.Items {
+			verbs = append(verbs, n.Verb)
+			if n.UserID != 1 || n.Actor == nil || n.Actor.DisplayName != "Bob" || n.Read {
+				t.Errorf("notification = %+v", n)
+			}
+		}
+		if strings.Join(verbs, ",") != "follow,reply,like" || got.UnreadCount != 3 {
+			t.Errorf("verbs = %v, unread = %d", verbs, got.UnreadCount)
+		}
+		if got.Items[1].ReplyID == nil || got.Items[1].PostID == nil || *got.Items[1].PostID != 1 {
+			t.Errorf("reply notification = %+v", got.Items[1])
+		}
+	})
+
+	t.Run("withdrawn likes and follows remove their notification", func(t *testing.T) {
+		f := newNotificationFixture(t)
+		do(t, f, "POST", "/api/posts/1/like", "", "bob")
+		do(t, f, "POST", "/api/users/1/follow", "", "bob")
+		do(t, f, "POST", "/api/posts/1/like", "", "bob")
+		do(t, f, "DELETE", "/api/users/1/follow", "", "bob")
+
+		if got := decode[notifications](t, do(t, f, "GET", "/api/notifications", "", "alice")); len(got.Items) != 0 || got.UnreadCount != 0 {
+			t.Errorf("notifications = %+v", got)
+		}
+	})
+
+	t.Run("mark read", func(t *testing.T) {
+		f := newNotificationFixture(t)
+		do(t, f, "POST", "/api/posts/1/like", "", "bob")
+		do(t, f, "POST", "/api/users/1/follow", "", "bob")
+
+		got := decode[map[string]int](t, do(t, f, "POST", "/api/notifications/read", `{"ids":[1]}`, "alice"))
+		if got["unread_count"] != 1 {
+			t.Errorf("unread_count = %d, want 1", got["unread_count"])
+		}
+		unread := decode[notifications](t, do(t, f, "GET", "/api/notifications?unread=true", "", "alice"))
+		if len(unread.Items) != 1 || unread.Items[0].ID != 2 {
+			t.Errorf("unread = %+v", unread.Items)
+		}
+
+		// Other users' notifications are left alone
+		do(t, f, "POST", "/api/notifications/read", `{"all":true}`, "bob")
+		if got := decode[notifications](t, do(t, f, "GET", "/api/notifications", "", "alice")); got.UnreadCount != 1 {
+			t.Errorf("unread after bob marked all read = %d, want 1", got.UnreadCount)
+		}
+
+		got = decode[map[string]int](t, do(t, f, "POST", "/api/notifications/read", `{"all":true}`, "alice"))
+		if got["unread_count"] != 0 {
+			t.Errorf("unread_count = %d, want 0", got["unread_count"])
+		}
+	})
+
+	t.Run("mark read requires ids or all", func(t *testing.T) {
+		f := newNotificationFixture(t)
+		req := httptest.NewRequest("POST", "/api/notifications/read", strings.NewReader(`{}`))
+		f.authorize(t, req, "alice")
+		if rec := f.serve(req); rec.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+		}
+	})
+}
+
+func TestAccountDeletion(t *testing.T) {
+	do := func(t *testing.T, f *fixture, method, path string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, nil)
+		f.authorize(t, req, "session:1")
+		return f.serve(req)
+	}
+	ctx := context.Background()
+	// Uploads are found through the uploads table, and files stored before
+	// it existed, such as 1_legacy.png, by the owner's ID. 12_other.png is
+	// another user's.
+	addUploads := func(t *testing.T, f *fixture) {
+		t.Helper()
+		for _, key := range []string{"1_abc_64.png", "1_abc_320.png", "1_legacy.png", "12_other.png"} {
+			if err := f.blobs.Put(ctx, key, strings.NewReader("png"), 3, "image/png"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		upload := &models.Upload{UserID: 1, SHA256: "abc", KeyPrefix: "1_abc", Size: 6,
+			Variants: map[string]string{"64": "1_abc_64.png", "320": "1_abc_320.png"}}
+		if err := f.stores.Uploads.Create(ctx, upload, 1<<20); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("purged after the grace period", func(t *testing.T) {
+		f := newFixture(t)
+		addUploads(t, f)
+		t.Setenv("ACCOUNT_DELETION_GRACE_DAYS", "1")
+		if rec := do(t, f, "DELETE", "/api/me"); rec.Code != http.StatusAccepted {
+			t.Fatalf("status = %d (body: %s)", rec.Code, rec.Body)
+		}
+
+		f.api.PurgeDueAccounts(ctx)
+		if _, err := f.stores.Users.Get(ctx, 1); err != nil {
+			t.Fatalf("purged within the grace period: %v", err)
+		}
+
+		f.mem.Now = func() time.Time { return time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC) }
+		f.api.PurgeDueAccounts(ctx)
+		if _, err := f.stores.Users.Get(ctx, 1); err != store.ErrNotFound {
+			t.Fatalf("get purged user: err = %v, want not found", err)
+		}
+		if _, err := f.stores.Posts.Get(ctx, 0, 1); err != store.ErrNotFound {
+			t.Errorf("post of purged user: err = %v, want not found", err)
+		}
+		if n, _ := f.stores.Likes.Count(ctx, 2); n != 0 {
+			t.Errorf("likes of purged user remain: %d", n)
+		}
+		if keys, _ := f.blobs.List(ctx, "1_"); len(keys) != 0 {
+			t.Errorf("uploads of purged user remain: %v", keys)
+		}
+		if keys, _ := f.blobs.List(ctx, "12_"); len(keys) != 1 {
+			t.Errorf("uploads of another user = %v, want 12_other.png", keys)
+		}
+		if uploads, _ := f.stores.Uploads.List(ctx, 1); len(uploads) != 0 {
+			t.Errorf("upload records of purged user remain: %+v", uploads)
+		}
+		if _, err := f.stores.Users.Get(ctx, 2); err != nil {
+			t.Errorf("other user: %v", err)
+		}
+	})
+
+	t.Run("cancelled deletion is not purged", func(t *testing.T) {
+		f := newFixture(t)
+		t.Setenv("ACCOUNT_DELETION_GRACE_DAYS", "0")
+		do(t, f, "DELETE", "/api/me")
+		if rec := do(t, f, "POST", "/api/me/cancel-deletion"); rec.Code != http.StatusOK {
+			t.Fatalf("cancel: status = %d (body: %s)", rec.Code, rec.Body)
+		}
+
+		f.api.PurgeDueAccounts(ctx)
+		user, err := f.stores.Users.Get(ctx, 1)
+		if err != nil || user.DeletionScheduledAt != nil {
+			t.Errorf("user = %+v, err = %v", user, err)
+		}
+	})
+
+	t.Run("access tokens are suspended while deletion is pending", func(t *testing.T) {
+		f := newFixture(t)
+		withToken := func() int {
+			req := httptest.NewRequest("GET", "/auth/me", nil)
+			f.authorize(t, req, "alice")
+			return f.serve(req).Code
+		}
+		do(t, f, "DELETE", "/api/me")
+		if code := withToken(); code != http.StatusUnauthorized {
+			t.Errorf("pending deletion: status = %d, want %d", code, http.StatusUnauthorized)
+		}
+
+		do(t, f, "POST", "/api/me/cancel-deletion")
+		if code := withToken(); code != http.StatusOK {
+			t.Errorf("cancelled deletion: status = %d, want %d", code, http.StatusOK)
+		}
+	})
+
+	t.Run("repeated request keeps the first date", func(t *testing.T) {
+		f := newFixture(t)
+		type scheduled struct {
+			DeletionScheduledAt time.Time `json:"deletion_scheduled_at"`
+		}
+		first := decode[scheduled](t, do(t, f, "DELETE", "/api/me").Body.Bytes())
+		second := decode[scheduled](t, do(t, f, "DELETE", "/api/me").Body.Bytes())
+		if first.DeletionScheduledAt.IsZero() || !first.DeletionScheduledAt.Equal(second.DeletionScheduledAt) {
+			t.Errorf("rescheduled from %v to %v", first.DeletionScheduledAt, second.DeletionScheduledAt)
+		}
+	})
+
+	t.Run("export", func(t *testing.T) {
+		f := newFixture(t)
+		addUploads(t, f)
+		rec := do(t, f, "GET", "/api/me/export")
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/zip" {
+			t.Fatalf("status = %d, headers %v", rec.Code, rec.Header())
+		}
+
+		archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files := make(map[string]string)
+		for _, file := range archive.File {
+			r, _ := file.Open()
+			data, _ := io.ReadAll(r)
+			r.Close()
+			files[file.Name] = string(data)
+		}
+
+		profile := decode[map[string]interface{}](t, []byte(files["profile.json"]))
+		if profile["display_name"] != "Alice" {
+			t.Errorf("profile.json = %s", files["profile.json"])
+		}
+		posts := decode[[]map[string]interface{}](t, []byte(files["posts.json"]))
+		if len(posts) != 1 || posts[0]["title"] != "Song A" {
+			t.Errorf("posts.json = %s", files["posts.json"])
+		}
+		for name, want := range map[string]int{"likes.json": 1, "following.json": 1, "followers.json": 0, "replies.json": 0, "connections.json": 0} {
+			if records := decode[[]map[string]interface{}](t, []byte(files[name])); len(records) != want {
+				t.Errorf("%s = %s, want %d records", name, files[name], want)
+			}
+		}
+		for _, key := range []string{"1_abc_64.png", "1_abc_320.png", "1_legacy.png"} {
+			if files["uploads/"+key] != "png" {
+				t.Errorf("%s missing from the export", key)
+			}
+		}
+		if _, ok := files["uploads/12_other.png"]; ok {
+			t.Errorf("exported another user's upload")
+		}
+	})
+}
+
+func TestTwitter(t *testing.T) {
+	do := func(t *testing.T, f *fixture, method, path, body string) []byte {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		f.authorize(t, req, "alice")
+		rec := f.serve(req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s %s: status = %d (body: %s)", method, path, rec.Code, rec.Body)
+		}
+		return rec.Body.Bytes()
+	}
+
+	t.Run("connect and disconnect", func(t *testing.T) {
+		f := newFixture(t)
+		f.mem.Connect(1, "twitter")
+		if got := decode[map[string]bool](t, do(t, f, "GET", "/api/twitter/check", "")); !got["connected"] || got["needs_reauth"] {
+			t.Errorf("connected: status = %v", got)
+		}
+
+		do(t, f, "POST", "/api/twitter/disconnect", "")
+		if got := decode[map[string]bool](t, do(t, f, "GET", "/api/twitter/check", "")); got["connected"] {
+			t.Errorf("disconnected: status = %v", got)
+		}
+	})
+
+	t.Run("crosspost status", func(t *testing.T) {
+		f := newFixture(t)
+		post := decode[models.Post](t, do(t, f, "POST", "/api/posts", `{"title":"New","song_id":"n","song_type":"other","post_to_twitter":true}`))
+		jobs := decode[[]models.CrosspostJob](t, do(t, f, "GET", fmt.Sprintf("/api/posts/%d/crosspost", post.ID), ""))
+		if len(jobs) != 1 || jobs[0].Provider != "twitter" || jobs[0].Status != crosspost.StatusPending || jobs[0].NextAttemptAt == nil {
+			t.Errorf("jobs = %+v", jobs)
+		}
+	})
+}
+
+func TestStream(t *testing.T) {
+	// stream connects as as, resuming after the first event, and returns the
+	// types of the events replayed up to the "done" marker
+	stream := func(t *testing.T, f *fixture, as string) []string {
+		t.Helper()
+		server := httptest.NewServer(f.server)
+		defer server.Close()
+
+		req := httptest.NewRequest("GET", server.URL+"/api/stream", nil)
+		req.RequestURI = ""
+		req.Header.Set("Last-Event-ID", "1")
+		f.authorize(t, req, as)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d", resp.StatusCode)
+		}
+
+		var types []string
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			eventType, ok := strings.CutPrefix(scanner.Text(), "event: ")
+			if !ok {
+				continue
+			}
+			if eventType == "done" {
+				return types
+			}
+			types = append(types, eventType)
+		}
+		t.Fatalf("stream ended before the done marker: %v (events: %v)", scanner.Err(), types)
+		return nil
+	}
+	newStreamFixture := func(t *testing.T) *fixture {
+		f := newFixture(t)
+		f.api.Events.Publish(events.PostCreated, 0, nil)
+		f.api.Events.Publish(events.PostLiked, 0, nil)
+		f.api.Events.Publish(events.Notification, 1, nil)
+		f.api.Events.Publish("done", 0, nil)
+		return f
+	}
+
+	tests := []struct {
+		name string
+		as   string
+		want []string
+	}{
+		{"anonymous", "", []string{events.PostLiked}},
+		{"read scope", "alice:read", []string{events.PostLiked, events.Notification}},
+		{"other user", "bob", []string{events.PostLiked}},
+		{"without read scope", "alice:profile", []string{events.PostLiked}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newStreamFixture(t)
+			token, err := auth.IssueAccessToken(context.Background(), f.stores.Tokens, 1, "alice:profile", []string{auth.ScopeProfileWrite}, time.Now().Add(time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.tokens["alice:profile"] = token.Token
+
+			if got := stream(t, f, tt.as); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("events = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("handlers publish to the injected hub", func(t *testing.T) {
+		f := newFixture(t)
+		sub, _, _ := f.api.Events.Subscribe(0, 0)
+		defer sub.Close()
+		req := httptest.NewRequest("POST", "/api/posts/2/like", nil)
+		f.authorize(t, req, "bob")
+		if rec := f.serve(req); rec.Code != http.StatusOK {
+			t.Fatalf("like: status = %d (body: %s)", rec.Code, rec.Body)
+		}
+		select {
+		case event := <-sub.Events():
+			if event.Type != events.PostLiked {
+				t.Errorf("event type = %q, want %q", event.Type, events.PostLiked)
+			}
+		default:
+			t.Error("no event published")
+		}
+	})
+}
@@ -1,46 +1,61 @@
 package handlers
 
 import (
-	"backend/internal/database"
+	"backend/internal/apierror"
+	"backend/internal/auth"
+	"backend/internal/events"
 	"backend/internal/utils"
 	"encoding/json"
 	"net/http"
 )
 
-func ToggleLike(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) ToggleLike(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	userID, ok := utils.GetCurrentUserID(r)
+	userID, ok := auth.RequireUser(w, r, auth.ScopeLikesWrite)
 	if !ok {
-		http.Error(w, "Not authenticated", http.StatusUnauthorized)
 		return
 	}
 
-	postID, err := utils.ExtractIDFromPath(r.URL.Path, 3)
-	if err != nil {
-		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+	postID, ok := utils.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+	if !h.checkPostExists(w, r, postID) {
 		return
 	}
 
 	// Check if already liked
-	var exists bool
-	err = database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM likes WHERE user_id = $1 AND post_id = $2)", userID, postID).Scan(&exists)
+	exists, err := h.Likes.Liked(r.Context(), userID, postID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 
 	if exists {
-		_, err = database.DB.Exec("DELETE FROM likes WHERE user_id = $1 AND post_id = $2", userID, postID)
+		err = h.Likes.Unlike(r.Context(), userID, postID)
 	} else {
-		_, err = database.DB.Exec("INSERT INTO likes (user_id, post_id) VALUES ($1, $2)", userID, postID)
+		err = h.Likes.Like(r.Context(), userID, postID)
 	}
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 
+	if exists {
+		h.Notifier.RemovePostNotification(userID, postID, VerbLike)
+	} else {
+		h.Notifier.NotifyPostOwner(userID, postID, VerbLike, nil)
+	}
+
+	if likeCount, err := h.Likes.Count(r.Context(), postID); err == nil {
+		h.Events.Publish(events.PostLiked, 0, map[string]int{
+			"post_id":    postID,
+			"like_count": likeCount,
+		})
+	}
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]bool{"liked": !exists})
 }
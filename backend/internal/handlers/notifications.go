@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"backend/internal/apierror"
+	"backend/internal/auth"
+	"backend/internal/database"
+	"backend/internal/events"
+	"backend/internal/models"
+	"backend/internal/store"
+	"backend/internal/utils"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+const (
+	VerbLike   = "like"
+	VerbReply  = "reply"
+	VerbFollow = "follow"
+)
+
+// storeNotifier records notifications in a NotificationStore and pushes new
+// ones to the recipient's event streams
+type storeNotifier struct {
+	notifications store.NotificationStore
+	users         store.UserStore
+	events        *events.Hub
+}
+
+// NotifyPostOwner notifies the author of a post about an action on it.
+// Nothing is recorded when the actor is the author.
+func (n *storeNotifier) NotifyPostOwner(actorID, postID int, verb string, replyID *int) {
+	notification := models.Notification{ActorID: actorID, Verb: verb, PostID: &postID, ReplyID: replyID}
+	created, err := n.notifications.Create(context.Background(), &notification)
+	if err != nil {
+		log.Printf("Failed to create %s notification for post %d: %v", verb, postID, err)
+		return
+	}
+	if created {
+		n.publish(notification)
+	}
+}
+
+// NotifyFollow notifies a user that they gained a follower
+func (n *storeNotifier) NotifyFollow(actorID, userID int) {
+	if actorID == userID {
+		return
+	}
+	notification := models.Notification{UserID: userID, ActorID: actorID, Verb: VerbFollow}
+	if _, err := n.notifications.Create(context.Background(), &notification); err != nil {
+		log.Printf("Failed to create follow notification for user %d: %v", userID, err)
+		return
+	}
+	n.publish(notification)
+}
+
+// publish pushes a new notification, with the actor and the recipient's
+// unread count, to the recipient's event streams
+func (n *storeNotifier) publish(notification models.Notification) {
+	ctx := context.Background()
+	if actor, err := n.users.Get(ctx, notification.ActorID); err == nil {
+		notification.Actor = &models.User{ID: actor.ID, DisplayName: actor.DisplayName, ProfileImage: actor.ProfileImage}
+	}
+
+	unread, err := n.notifications.UnreadCount(ctx, notification.UserID)
+	if err != nil {
+		log.Printf("Failed to count unread notifications for user %d: %v", notification.UserID, err)
+	}
+
+	n.events.Publish(events.Notification, notification.UserID, struct {
+		models.Notification
+		UnreadCount int `json:"unread_count"`
+	}{notification, unread})
+}
+
+// RemovePostNotification deletes the notification created by
+// NotifyPostOwner, e.g. when a like is withdrawn
+func (n *storeNotifier) RemovePostNotification(actorID, postID int, verb string) {
+	if err := n.notifications.DeleteForPost(context.Background(), actorID, postID, verb); err != nil {
+		log.Printf("Failed to remove %s notification for post %d: %v", verb, postID, err)
+	}
+}
+
+// RemoveFollowNotification deletes the notification created by NotifyFollow
+func (n *storeNotifier) RemoveFollowNotification(actorID, userID int) {
+	if err := n.notifications.DeleteForUser(context.Background(), actorID, userID, VerbFollow); err != nil {
+		log.Printf("Failed to remove follow notification for user %d: %v", userID, err)
+	}
+}
+
+// GetNotifications lists the current user's notifications, newest first,
+// together with the number of unread ones
+func (h *Handler) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := auth.RequireUser(w, r, auth.ScopeRead)
+	if !ok {
+		return
+	}
+
+	page, err := utils.ParsePageRequest(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+	notifications, err := h.Notifications.List(r.Context(), userID, unreadOnly, page)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	unread, err := h.Notifications.UnreadCount(r.Context(), userID)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(struct {
+		models.Page[models.Notification]
+		UnreadCount int `json:"unread_count"`
+	}{
+		Page: utils.BuildPage(notifications, page, func(n models.Notification) database.Cursor {
+			return database.Cursor{CreatedAt: n.CreatedAt, ID: n.ID}
+		}),
+		UnreadCount: unread,
+	})
+}
+
+// MarkNotificationsRead marks the given notifications, or all of them when
+// "all" is set, as read
+func (h *Handler) MarkNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := auth.RequireUser(w, r, auth.ScopeNotificationsWrite)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		IDs []int64 `json:"ids"`
+		All bool    `json:"all"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, r, apierror.BadRequest("Invalid request body"))
+		return
+	}
+
+	var err error
+	switch {
+	case req.All:
+		err = h.Notifications.MarkAllRead(r.Context(), userID)
+	case len(req.IDs) > 0:
+		err = h.Notifications.MarkRead(r.Context(), userID, req.IDs)
+	default:
+		apierror.Write(w, r, apierror.Validation(
+			apierror.FieldError{Field: "ids", Message: "Either ids or all is required"},
+			apierror.FieldError{Field: "all", Message: "Either ids or all is required"},
+		))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	unread, err := h.Notifications.UnreadCount(r.Context(), userID)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]int{"unread_count": unread})
+}
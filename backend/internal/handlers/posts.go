@@ -1,10 +1,13 @@
 package handlers
 
 import (
-	"database/sql"
+	"backend/internal/apierror"
 	"backend/internal/auth"
+	"backend/internal/crosspost"
 	"backend/internal/database"
+	"backend/internal/events"
 	"backend/internal/models"
+	"backend/internal/store"
 	"backend/internal/utils"
 	"encoding/json"
 	"log"
@@ -13,41 +16,42 @@ import (
 	"strconv"
 )
 
-func GetPosts(w http.ResponseWriter, r *http.Request) {
+// MaxTags is the maximum number of tags a single post may carry
+const MaxTags = 10
+
+func (h *Handler) GetPosts(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	currentUserID, _ := utils.GetCurrentUserID(r)
+	currentUserID, _ := auth.CurrentUserID(r)
 
-	var (
-		rows *sql.Rows
-		err  error
-	)
+	page, err := utils.ParsePageRequest(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	var filter store.PostFilter
 
 	userIDParam := r.URL.Query().Get("user_id")
 	if userIDParam != "" {
 		userID, convErr := strconv.Atoi(userIDParam)
 		if convErr != nil {
-			http.Error(w, "invalid user_id", http.StatusBadRequest)
+			apierror.Write(w, r, apierror.Invalid("user_id", "Invalid user_id"))
 			return
 		}
-		query := database.BuildPostQuery("p.user_id = $2")
-		rows, err = database.DB.Query(query, currentUserID, userID)
-	} else {
-		query := database.BuildPostQuery("")
-		rows, err = database.DB.Query(query, currentUserID)
+		filter.UserID = userID
 	}
 
+	posts, err := h.Posts.List(r.Context(), currentUserID, filter, page)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
-	defer rows.Close()
 
-	posts := utils.ScanPostRows(rows)
-	json.NewEncoder(w).Encode(posts)
+	json.NewEncoder(w).Encode(utils.BuildPage(posts, page, utils.PostCursor))
 }
 
-func CreatePost(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) CreatePost(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Parse request body
@@ -57,60 +61,227 @@ func CreatePost(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierror.Write(w, r, apierror.BadRequest("Invalid request body"))
+		return
+	}
+
+	userID, ok := auth.RequireUser(w, r, auth.ScopePostsWrite)
+	if !ok {
+		return
+	}
+
+	// Validation
+	if len(request.Tags) > MaxTags {
+		apierror.Write(w, r, apierror.Invalid("tags", "Too many tags (max 10)"))
+		return
+	}
+
+	request.Post.UserID = userID
+
+	// Queue the cross-post together with the post so it cannot be lost
+	var crossposts []store.Crosspost
+	if request.PostToTwitter {
+		frontendURL := os.Getenv("FRONTEND_URL")
+		if frontendURL == "" {
+			frontendURL = "http://127.0.0.1:3000"
+		}
+
+		crossposts = append(crossposts, store.Crosspost{
+			Provider: "twitter",
+			Text: func(postID int) string {
+				postURL := frontendURL + "/?post_id=" + strconv.Itoa(postID)
+				return crosspost.BuildTweetText(request.Comment, postURL)
+			},
+		})
+	}
+
+	// Insert post into database
+	if err := h.Posts.Create(r.Context(), &request.Post, crossposts...); err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
 
-	// Get user from session
-	session, err := auth.Store.Get(r, auth.GetSessionCookieName())
+	if request.PostToTwitter {
+		crosspost.Notify()
+	}
+
+	if post, err := h.Posts.Get(r.Context(), 0, request.Post.ID); err == nil {
+		h.Events.Publish(events.PostCreated, 0, post)
+	} else {
+		log.Printf("Failed to load post %d for publishing: %v", request.Post.ID, err)
+	}
+
+	json.NewEncoder(w).Encode(request.Post)
+}
+
+// GetPost returns a single post, matching the ?post_id= permalinks shared
+// on Twitter. Pass include=replies to embed the first page of replies.
+func (h *Handler) GetPost(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	currentUserID, _ := auth.CurrentUserID(r)
+
+	postID, ok := utils.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	post, err := h.Posts.Get(r.Context(), currentUserID, postID)
+	if err == store.ErrNotFound {
+		apierror.Write(w, r, apierror.NotFound("Post not found"))
+		return
+	}
 	if err != nil {
-		log.Println("Session error:", err)
-		http.Error(w, "Invalid session", http.StatusUnauthorized)
+		apierror.Write(w, r, err)
 		return
 	}
 
-	userID, ok := session.Values["user_id"].(int)
+	if r.URL.Query().Get("include") == "replies" {
+		page := database.PageRequest{Limit: database.DefaultPageLimit}
+		if limitParam := r.URL.Query().Get("replies_limit"); limitParam != "" {
+			page.Limit, err = strconv.Atoi(limitParam)
+			if err != nil || page.Limit < 1 || page.Limit > database.MaxPageLimit {
+				apierror.Write(w, r, apierror.Invalid("replies_limit", "replies_limit must be between 1 and "+strconv.Itoa(database.MaxPageLimit)))
+				return
+			}
+		}
+
+		replies, err := h.Replies.List(r.Context(), postID, page)
+		if err != nil {
+			apierror.Write(w, r, err)
+			return
+		}
+		repliesPage := utils.BuildPage(replies, page, utils.ReplyCursor)
+		post.Replies = &repliesPage
+	}
+
+	json.NewEncoder(w).Encode(post)
+}
+
+// UpdatePost edits a post owned by the current user. Fields omitted from the
+// request body are left unchanged, so PUT and PATCH behave the same way.
+func (h *Handler) UpdatePost(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := auth.RequireUser(w, r, auth.ScopePostsWrite)
 	if !ok {
-		log.Println("No user_id in session")
-		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	postID, ok := utils.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Title    *string   `json:"title"`
+		SongID   *string   `json:"song_id"`
+		SongType *string   `json:"song_type"`
+		Comment  *string   `json:"comment"`
+		Tags     *[]string `json:"tags"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, r, apierror.BadRequest("Invalid request body"))
 		return
 	}
 
 	// Validation
-	if len(request.Tags) > 10 {
-		http.Error(w, "Too many tags (max 10)", http.StatusBadRequest)
+	if req.Tags != nil && len(*req.Tags) > MaxTags {
+		apierror.Write(w, r, apierror.Invalid("tags", "Too many tags (max 10)"))
 		return
 	}
 
-	// Insert post into database
-	err = database.DB.QueryRow(`
-		INSERT INTO posts (user_id, title, song_id, song_type, comment, tags)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id, created_at
-	`, userID, request.Title, request.SongID, request.SongType, request.Comment, request.Tags).Scan(&request.Post.ID, &request.Post.CreatedAt)
+	if !h.checkPostOwner(w, r, postID, userID) {
+		return
+	}
 
+	err := h.Posts.Update(r.Context(), postID, store.PostUpdate{
+		Title:    req.Title,
+		SongID:   req.SongID,
+		SongType: req.SongType,
+		Comment:  req.Comment,
+		Tags:     req.Tags,
+	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
 
-	// Post to Twitter if requested
-	if request.PostToTwitter {
-		frontendURL := os.Getenv("FRONTEND_URL")
-		if frontendURL == "" {
-			frontendURL = "http://127.0.0.1:3000"
-		}
-		postURL := frontendURL + "/?post_id=" + strconv.Itoa(request.Post.ID)
-		
-		go func() {
-			if err := PostToTwitter(userID, request.Comment, postURL); err != nil {
-				log.Printf("Failed to post to Twitter: %v", err)
-			} else {
-				log.Printf("Successfully posted to Twitter for post ID %d", request.Post.ID)
-			}
-		}()
+	post, err := h.Posts.Get(r.Context(), userID, postID)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
 	}
 
-	request.Post.UserID = userID
-	json.NewEncoder(w).Encode(request.Post)
+	// liked_by_current_user is per viewer, so it is not broadcast
+	broadcast := *post
+	broadcast.LikedByCurrentUser = false
+	h.Events.Publish(events.PostUpdated, 0, broadcast)
+
+	json.NewEncoder(w).Encode(post)
+}
+
+// DeletePost removes a post owned by the current user. Likes and replies are
+// removed by the ON DELETE CASCADE constraints on their tables.
+func (h *Handler) DeletePost(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := auth.RequireUser(w, r, auth.ScopePostsWrite)
+	if !ok {
+		return
+	}
+
+	postID, ok := utils.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	if !h.checkPostOwner(w, r, postID, userID) {
+		return
+	}
+
+	if err := h.Posts.Delete(r.Context(), postID); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	h.Events.Publish(events.PostDeleted, 0, map[string]int{"id": postID})
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Post deleted successfully",
+	})
+}
+
+// checkPostOwner writes a 404 or 403 response and returns false unless the
+// post exists and belongs to userID
+func (h *Handler) checkPostOwner(w http.ResponseWriter, r *http.Request, postID, userID int) bool {
+	ownerID, err := h.Posts.OwnerID(r.Context(), postID)
+	if err == store.ErrNotFound {
+		apierror.Write(w, r, apierror.NotFound("Post not found"))
+		return false
+	}
+	if err != nil {
+		apierror.Write(w, r, err)
+		return false
+	}
+	if ownerID != userID {
+		apierror.Write(w, r, apierror.Forbidden("Only the author can change this post"))
+		return false
+	}
+	return true
+}
+
+// checkPostExists writes a 404 response and returns false unless the post
+// exists
+func (h *Handler) checkPostExists(w http.ResponseWriter, r *http.Request, postID int) bool {
+	_, err := h.Posts.OwnerID(r.Context(), postID)
+	if err == store.ErrNotFound {
+		apierror.Write(w, r, apierror.NotFound("Post not found"))
+		return false
+	}
+	if err != nil {
+		apierror.Write(w, r, err)
+		return false
+	}
+	return true
 }
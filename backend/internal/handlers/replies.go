@@ -1,25 +1,28 @@
 package handlers
 
 import (
-	"backend/internal/database"
+	"backend/internal/apierror"
+	"backend/internal/auth"
+	"backend/internal/events"
 	"backend/internal/models"
 	"backend/internal/utils"
 	"encoding/json"
 	"net/http"
 )
 
-func CreateReply(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) CreateReply(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	userID, ok := utils.GetCurrentUserID(r)
+	userID, ok := auth.RequireUser(w, r, auth.ScopeRepliesWrite)
 	if !ok {
-		http.Error(w, "Not authenticated", http.StatusUnauthorized)
 		return
 	}
 
-	postID, err := utils.ExtractIDFromPath(r.URL.Path, 3)
-	if err != nil {
-		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+	postID, ok := utils.PathID(w, r, "id")
+	if !ok {
+		return
+	}
+	if !h.checkPostExists(w, r, postID) {
 		return
 	}
 
@@ -27,74 +30,52 @@ func CreateReply(w http.ResponseWriter, r *http.Request) {
 		Content string `json:"content"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierror.Write(w, r, apierror.BadRequest("Invalid request body"))
 		return
 	}
 
 	if req.Content == "" {
-		http.Error(w, "Content is required", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.Invalid("content", "Content is required"))
 		return
 	}
 
-	var reply models.Reply
-	err = database.DB.QueryRow(`
-		INSERT INTO replies (user_id, post_id, content)
-		VALUES ($1, $2, $3)
-		RETURNING id, created_at
-	`, userID, postID, req.Content).Scan(&reply.ID, &reply.CreatedAt)
-
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	reply := models.Reply{UserID: userID, PostID: postID, Content: req.Content}
+	if err := h.Replies.Create(r.Context(), &reply); err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
 
-	reply.UserID = userID
-	reply.PostID = postID
-	reply.Content = req.Content
+	h.Notifier.NotifyPostOwner(userID, postID, VerbReply, &reply.ID)
 	
 	// Fetch user details for the response
-	var user models.User
-	err = database.DB.QueryRow("SELECT id, display_name, profile_image FROM users WHERE id = $1", userID).Scan(&user.ID, &user.DisplayName, &user.ProfileImage)
-	if err == nil {
-		reply.User = &user
+	if user, err := h.Users.Get(r.Context(), userID); err == nil {
+		reply.User = &models.User{ID: user.ID, DisplayName: user.DisplayName, ProfileImage: user.ProfileImage}
 	}
 
+	h.Events.Publish(events.ReplyCreated, 0, reply)
+
 	json.NewEncoder(w).Encode(reply)
 }
 
-func GetReplies(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetReplies(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	postID, err := utils.ExtractIDFromPath(r.URL.Path, 3)
-	if err != nil {
-		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+	postID, ok := utils.PathID(w, r, "id")
+	if !ok {
 		return
 	}
 
-	rows, err := database.DB.Query(`
-		SELECT r.id, r.user_id, r.post_id, r.content, r.created_at,
-		       u.id, u.display_name, u.profile_image
-		FROM replies r
-		JOIN users u ON r.user_id = u.id
-		WHERE r.post_id = $1
-		ORDER BY r.created_at ASC
-	`, postID)
+	page, err := utils.ParsePageRequest(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
-	defer rows.Close()
 
-	var replies []models.Reply
-	for rows.Next() {
-		var r models.Reply
-		var u models.User
-		if err := rows.Scan(&r.ID, &r.UserID, &r.PostID, &r.Content, &r.CreatedAt, &u.ID, &u.DisplayName, &u.ProfileImage); err != nil {
-			continue
-		}
-		r.User = &u
-		replies = append(replies, r)
+	replies, err := h.Replies.List(r.Context(), postID, page)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
 	}
 
-	json.NewEncoder(w).Encode(replies)
+	json.NewEncoder(w).Encode(utils.BuildPage(replies, page, utils.ReplyCursor))
 }
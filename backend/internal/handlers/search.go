@@ -1,91 +1,98 @@
 package handlers
 
 import (
-	"backend/internal/database"
-	"backend/internal/models"
+	"backend/internal/apierror"
+	"backend/internal/auth"
+	"backend/internal/search"
+	"backend/internal/store"
 	"backend/internal/utils"
-	"database/sql"
 	"encoding/json"
-	"log"
 	"net/http"
 )
 
-func SearchPosts(w http.ResponseWriter, r *http.Request) {
+// SearchPosts lists the posts matching q by relevance, each with a
+// highlighted snippet. q uses the syntax of search.Parse, such as
+// `tag:citypop from:alice -tag:remix "exact phrase"`. The older type
+// parameter instead matches q as typed in the "title", "comment" or "tag"
+// field. boost=recent favors newer posts.
+func (h *Handler) SearchPosts(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	query := r.URL.Query().Get("q")
 	if query == "" {
-		http.Error(w, "Query parameter 'q' is required", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.Invalid("q", "Query parameter 'q' is required"))
 		return
 	}
 
-	currentUserID, _ := utils.GetCurrentUserID(r)
-	searchType := r.URL.Query().Get("type")
+	currentUserID, _ := auth.CurrentUserID(r)
 
-	var whereClause string
-	switch searchType {
-	case "title":
-		whereClause = "p.title ILIKE '%' || $2 || '%'"
-	case "comment":
-		whereClause = "p.comment ILIKE '%' || $2 || '%'"
-	case "tag":
-		whereClause = "$2 = ANY(p.tags)"
-	default: // "all" or empty
-		whereClause = "p.comment ILIKE '%' || $2 || '%' OR p.title ILIKE '%' || $2 || '%' OR $2 = ANY(p.tags)"
+	page, err := utils.ParsePageRequest(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	// Results are ordered by rank, so a cursor from a chronological list
+	// cannot continue them
+	if page.Cursor != nil && page.Cursor.Rank == nil {
+		apierror.Write(w, r, apierror.Invalid("cursor", "Invalid cursor"))
+		return
 	}
 
-	sqlQuery := database.BuildPostQuery(whereClause)
-	rows, err := database.DB.Query(sqlQuery, currentUserID, query)
+	var filter store.PostFilter
+	switch field := r.URL.Query().Get("type"); field {
+	case search.FieldTitle, search.FieldComment, search.FieldTag:
+		// The older type parameter searches one field for q as typed
+		filter.Search = search.FieldQuery(field, query)
+	default:
+		parsed, err := search.Parse(query)
+		if err != nil {
+			apierror.Write(w, r, apierror.Invalid("q", "Invalid search query "+err.Error()))
+			return
+		}
+		filter.Search = parsed
+	}
+	switch r.URL.Query().Get("boost") {
+	case "":
+	case "recent":
+		filter.BoostRecent = true
+	default:
+		apierror.Write(w, r, apierror.Invalid("boost", "boost must be \"recent\" or empty"))
+		return
+	}
+
+	posts, err := h.Posts.List(r.Context(), currentUserID, filter, page)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
-	defer rows.Close()
 
-	posts := utils.ScanPostRows(rows)
-	json.NewEncoder(w).Encode(posts)
+	result := utils.BuildPage(posts, page, utils.RankedPostCursor)
+	terms := filter.Search.Highlights()
+	for i := range result.Items {
+		p := &result.Items[i]
+		p.Snippet = search.Snippet(terms, p.Comment, p.Title)
+	}
+	json.NewEncoder(w).Encode(result)
 }
 
-func SearchUsers(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) SearchUsers(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	query := r.URL.Query().Get("q")
 
-	var (
-		rows *sql.Rows
-		err  error
-	)
+	currentUserID, _ := auth.CurrentUserID(r)
 
-	if query == "" {
-		rows, err = database.DB.Query(`
-			SELECT id, oauth_id, display_name, profile_image, bio, created_at
-			FROM users
-			ORDER BY display_name ASC
-		`)
-	} else {
-		rows, err = database.DB.Query(`
-			SELECT id, oauth_id, display_name, profile_image, bio, created_at
-			FROM users
-			WHERE display_name ILIKE '%' || $1 || '%'
-			ORDER BY created_at DESC
-		`, query)
-	}
+	page, err := utils.ParsePageRequest(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.Write(w, r, err)
 		return
 	}
-	defer rows.Close()
 
-	var users []models.User
-	for rows.Next() {
-		var u models.User
-		err := rows.Scan(&u.ID, &u.OAuthID, &u.DisplayName, &u.ProfileImage, &u.Bio, &u.CreatedAt)
-		if err != nil {
-			log.Println("Error scanning row:", err)
-			continue
-		}
-		users = append(users, u)
+	users, err := h.Users.Search(r.Context(), currentUserID, query, page)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
 	}
 
-	json.NewEncoder(w).Encode(users)
+	json.NewEncoder(w).Encode(utils.BuildPage(users, page, utils.UserCursor))
 }
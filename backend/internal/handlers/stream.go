@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"backend/internal/apierror"
+	"backend/internal/auth"
+	"backend/internal/events"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HeartbeatInterval is how often an idle stream sends a comment line so
+// proxies keep the connection open
+const HeartbeatInterval = 15 * time.Second
+
+// Stream pushes feed events, and the notifications of a caller granted the
+// read scope, as Server-Sent Events. Clients resume with the Last-Event-ID header (or the
+// last_event_id query parameter); a "resync" event tells them that events
+// were missed and they should refetch.
+func (h *Handler) Stream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		apierror.Write(w, r, errors.New("streaming not supported"))
+		return
+	}
+
+	// Callers without the read scope only get the public feed events
+	var userID int
+	if principal, ok := auth.Authenticate(r); ok && principal.HasScope(auth.ScopeRead) {
+		userID = principal.UserID
+	}
+
+	lastEventParam := r.Header.Get("Last-Event-ID")
+	if lastEventParam == "" {
+		lastEventParam = r.URL.Query().Get("last_event_id")
+	}
+	var lastEventID uint64
+	if lastEventParam != "" {
+		id, err := strconv.ParseUint(lastEventParam, 10, 64)
+		if err != nil {
+			apierror.Write(w, r, apierror.Invalid("last_event_id", "Invalid Last-Event-ID"))
+			return
+		}
+		lastEventID = id
+	}
+
+	sub, replay, complete := h.Events.Subscribe(userID, lastEventID)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if !complete {
+		fmt.Fprint(w, "event: resync\ndata: {}\n\n")
+	}
+	for _, event := range replay {
+		if err := writeEvent(w, event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(HeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.Events():
+			if !ok {
+				// The hub dropped us for falling behind
+				return
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event events.Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		log.Printf("Failed to marshal %s event: %v", event.Type, err)
+		return nil
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
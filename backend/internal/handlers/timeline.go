@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"backend/internal/apierror"
+	"backend/internal/auth"
+	"backend/internal/store"
+	"backend/internal/utils"
+	"encoding/json"
+	"net/http"
+)
+
+// GetTimeline returns the posts of the users the current user follows
+func (h *Handler) GetTimeline(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := auth.RequireUser(w, r, auth.ScopeRead)
+	if !ok {
+		return
+	}
+
+	page, err := utils.ParsePageRequest(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	posts, err := h.Posts.List(r.Context(), userID, store.PostFilter{FollowedBy: userID}, page)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(utils.BuildPage(posts, page, utils.PostCursor))
+}
@@ -1,101 +1,214 @@
 package handlers
 
 import (
+	"backend/internal/apierror"
 	"backend/internal/auth"
+	"backend/internal/imaging"
+	"backend/internal/models"
+	"backend/internal/store"
+	"bytes"
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
-	"path/filepath"
-	"strings"
+	"strconv"
+	"time"
 )
 
-const (
-	MaxUploadSize = 5 * 1024 * 1024 // 5MB
-	UploadDir     = "./uploads"
-)
+const MaxUploadSize = 5 * 1024 * 1024 // 5MB
 
-func init() {
-	// Create uploads directory if it doesn't exist
-	if err := os.MkdirAll(UploadDir, 0755); err != nil {
-		log.Printf("Failed to create uploads directory: %v", err)
+// UploadQuota returns how many bytes of images each user may store, from
+// UPLOAD_QUOTA_MB
+func UploadQuota() int64 {
+	mb, err := strconv.ParseInt(os.Getenv("UPLOAD_QUOTA_MB"), 10, 64)
+	if err != nil || mb < 0 {
+		mb = 50
 	}
+	return mb * 1024 * 1024
 }
 
-func UploadImage(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// Check authentication
-	session, err := auth.Store.Get(r, auth.GetSessionCookieName())
-	if err != nil {
-		http.Error(w, "Invalid session", http.StatusUnauthorized)
-		return
+// UploadOrphanGracePeriod returns how long an upload may go unreferenced
+// before it is deleted, from UPLOAD_ORPHAN_GRACE_HOURS. It leaves time to
+// save a profile or post after uploading its image.
+func UploadOrphanGracePeriod() time.Duration {
+	hours, err := strconv.Atoi(os.Getenv("UPLOAD_ORPHAN_GRACE_HOURS"))
+	if err != nil || hours < 0 {
+		hours = 24
 	}
+	return time.Duration(hours) * time.Hour
+}
 
-	userID, ok := session.Values["user_id"].(int)
+// UploadImage accepts a JPEG, PNG, WebP or GIF in the "image" form field
+// and stores a re-encoded, metadata-free copy in every size of
+// imaging.Sizes. It returns {"url": largest, "urls": {"64": ..., ...}}.
+// Uploading the same file again returns the stored copy, and new files
+// must fit in the user's UploadQuota.
+func (h *Handler) UploadImage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.RequireUser(w, r, auth.ScopeProfileWrite)
 	if !ok {
-		http.Error(w, "Not authenticated", http.StatusUnauthorized)
 		return
 	}
 
-	// Parse multipart form
+	// Leave room for the multipart framing around the file
+	r.Body = http.MaxBytesReader(w, r.Body, MaxUploadSize+64*1024)
 	if err := r.ParseMultipartForm(MaxUploadSize); err != nil {
-		http.Error(w, "File too large or invalid", http.StatusBadRequest)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			apierror.Write(w, r, apierror.TooLarge("File too large (max 5MB)"))
+			return
+		}
+		apierror.Write(w, r, apierror.BadRequest("Invalid multipart form"))
 		return
 	}
 
-	file, header, err := r.FormFile("image")
+	file, _, err := r.FormFile("image")
 	if err != nil {
-		http.Error(w, "Failed to get file", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.Invalid("image", "Image file is required"))
 		return
 	}
 	defer file.Close()
 
-	// Validate file type
-	contentType := header.Header.Get("Content-Type")
-	if !strings.HasPrefix(contentType, "image/") {
-		http.Error(w, "Only image files are allowed", http.StatusBadRequest)
+	data, err := io.ReadAll(io.LimitReader(file, MaxUploadSize+1))
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	if len(data) > MaxUploadSize {
+		apierror.Write(w, r, apierror.TooLarge("File too large (max 5MB)"))
 		return
 	}
 
-	// Generate unique filename
-	ext := filepath.Ext(header.Filename)
-	randomBytes := make([]byte, 16)
-	rand.Read(randomBytes)
-	filename := fmt.Sprintf("%d_%s%s", userID, hex.EncodeToString(randomBytes), ext)
-	filepath := filepath.Join(UploadDir, filename)
+	// Identical bytes from the same user are stored once
+	hash := sha256.Sum256(data)
+	sum := hex.EncodeToString(hash[:])
+	if existing, err := h.Uploads.Reuse(r.Context(), userID, sum); err == nil {
+		h.writeUpload(w, existing)
+		return
+	} else if !errors.Is(err, store.ErrNotFound) {
+		apierror.Write(w, r, fmt.Errorf("find upload %s: %w", sum, err))
+		return
+	}
 
-	// Save file
-	dst, err := os.Create(filepath)
+	// Reject users already at their quota before decoding anything;
+	// Create checks again with the actual size
+	quota := UploadQuota()
+	usage, err := h.Uploads.Usage(r.Context(), userID)
 	if err != nil {
-		log.Printf("Failed to create file: %v", err)
-		http.Error(w, "Failed to save file", http.StatusInternalServerError)
+		apierror.Write(w, r, fmt.Errorf("upload usage of user %d: %w", userID, err))
+		return
+	}
+	if usage >= quota {
+		apierror.Write(w, r, quotaExceeded(quota))
 		return
 	}
-	defer dst.Close()
 
-	if _, err := io.Copy(dst, file); err != nil {
-		log.Printf("Failed to copy file: %v", err)
-		http.Error(w, "Failed to save file", http.StatusInternalServerError)
+	// The client's Content-Type and file name are ignored; the format is
+	// sniffed from the bytes and the output is always re-encoded
+	variants, err := imaging.Process(data)
+	switch {
+	case errors.Is(err, imaging.ErrUnsupportedFormat):
+		apierror.Write(w, r, apierror.Invalid("image", "Only JPEG, PNG, WebP and GIF images are allowed"))
+		return
+	case errors.Is(err, imaging.ErrTooManyPixels):
+		apierror.Write(w, r, apierror.Invalid("image", fmt.Sprintf("Image is too large (max %d pixels)", imaging.MaxPixels)))
+		return
+	case errors.Is(err, imaging.ErrInvalidImage):
+		apierror.Write(w, r, apierror.Invalid("image", "Image could not be decoded"))
+		return
+	case err != nil:
+		apierror.Write(w, r, fmt.Errorf("process image: %w", err))
 		return
 	}
 
-	// Return URL
-	baseURL := os.Getenv("BACKEND_URL")
-	if baseURL == "" {
-		baseURL = "http://127.0.0.1:8080"
+	// Keys stay random rather than derived from the hash so the URL of a
+	// known file cannot be guessed
+	randomBytes := make([]byte, 16)
+	rand.Read(randomBytes)
+	upload := &models.Upload{
+		UserID:    userID,
+		SHA256:    sum,
+		KeyPrefix: fmt.Sprintf("%d_%s", userID, hex.EncodeToString(randomBytes)),
+		Variants:  make(map[string]string, len(variants)),
+	}
+	for _, v := range variants {
+		key := fmt.Sprintf("%s_%d%s", upload.KeyPrefix, v.Size, v.Ext)
+		if err := h.Blobs.Put(r.Context(), key, bytes.NewReader(v.Data), int64(len(v.Data)), v.ContentType); err != nil {
+			h.deleteBlobs(r.Context(), upload.Variants)
+			apierror.Write(w, r, fmt.Errorf("store %s: %w", key, err))
+			return
+		}
+		upload.Variants[strconv.Itoa(v.Size)] = key
+		upload.Size += int64(len(v.Data))
+	}
+
+	err = h.Uploads.Create(r.Context(), upload, quota)
+	if err == nil {
+		h.writeUpload(w, upload)
+		return
+	}
+	h.deleteBlobs(r.Context(), upload.Variants)
+	switch {
+	case errors.Is(err, store.ErrQuotaExceeded):
+		apierror.Write(w, r, quotaExceeded(quota))
+	case errors.Is(err, store.ErrDuplicate):
+		// The same file was stored by a concurrent request
+		existing, err := h.Uploads.Reuse(r.Context(), userID, sum)
+		if err != nil {
+			apierror.Write(w, r, fmt.Errorf("reuse upload %s: %w", sum, err))
+			return
+		}
+		h.writeUpload(w, existing)
+	default:
+		apierror.Write(w, r, fmt.Errorf("record upload: %w", err))
 	}
-	imageURL := fmt.Sprintf("%s/uploads/%s", baseURL, filename)
+}
 
+// writeUpload responds with the URLs of an upload's variants
+func (h *Handler) writeUpload(w http.ResponseWriter, upload *models.Upload) {
+	urls := make(map[string]string, len(upload.Variants))
+	for size, key := range upload.Variants {
+		urls[size] = h.Blobs.URL(key)
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"url": imageURL,
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"url":  urls[strconv.Itoa(imaging.Sizes[len(imaging.Sizes)-1])],
+		"urls": urls,
 	})
 }
+
+// deleteBlobs removes the stored variants of an upload
+func (h *Handler) deleteBlobs(ctx context.Context, variants map[string]string) {
+	for _, key := range variants {
+		if err := h.Blobs.Delete(ctx, key); err != nil {
+			log.Printf("Failed to delete upload %s: %v", key, err)
+		}
+	}
+}
+
+func quotaExceeded(quota int64) *apierror.Error {
+	return apierror.QuotaExceeded(fmt.Sprintf("Upload storage quota exceeded (max %dMB)", quota/(1024*1024)))
+}
+
+// SweepOrphanUploads deletes the uploads no profile or post has linked to
+// for longer than UploadOrphanGracePeriod, such as replaced avatars and
+// images that were uploaded but never saved. Files stored before uploads
+// were recorded are not swept; they are deleted with their owner's account.
+func (h *Handler) SweepOrphanUploads(ctx context.Context) {
+	deleted, err := h.Uploads.Sweep(ctx, UploadOrphanGracePeriod())
+	if err != nil {
+		log.Println("Failed to sweep orphaned uploads:", err)
+	}
+	for _, upload := range deleted {
+		h.deleteBlobs(ctx, upload.Variants)
+	}
+	if len(deleted) > 0 {
+		log.Printf("Deleted %d orphaned uploads", len(deleted))
+	}
+}
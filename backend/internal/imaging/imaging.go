@@ -0,0 +1,217 @@
+// Package imaging validates uploaded images and re-encodes them into the
+// resized variants Otogram serves. Re-encoding from decoded pixels drops
+// every piece of metadata (EXIF GPS position, camera serials, comments)
+// and anything appended to the file.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+const (
+	// MaxPixels rejects images whose decoded size would exhaust memory,
+	// e.g. a few KB PNG declaring 50000x50000 pixels
+	MaxPixels = 40_000_000
+	// JPEGQuality is used when re-encoding photos
+	JPEGQuality = 85
+)
+
+// Sizes are the longest-side lengths of the variants made for every upload
+var Sizes = []int{64, 256, 1024}
+
+var (
+	// ErrUnsupportedFormat is returned for anything but JPEG, PNG, WebP and GIF
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	// ErrTooManyPixels is returned for images larger than MaxPixels
+	ErrTooManyPixels = errors.New("image dimensions too large")
+	// ErrInvalidImage is returned when an image cannot be decoded
+	ErrInvalidImage = errors.New("invalid image")
+)
+
+// Format is an allowed input format
+type Format string
+
+const (
+	JPEG Format = "jpeg"
+	PNG  Format = "png"
+	WebP Format = "webp"
+	GIF  Format = "gif"
+)
+
+// Sniff detects the format from the file's magic bytes, ignoring whatever
+// the client claims in Content-Type or the file name
+func Sniff(data []byte) (Format, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xff\xd8\xff")):
+		return JPEG, nil
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return PNG, nil
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return GIF, nil
+	case len(data) >= 12 && bytes.HasPrefix(data, []byte("RIFF")) && string(data[8:12]) == "WEBP":
+		return WebP, nil
+	}
+	return "", ErrUnsupportedFormat
+}
+
+// Image is a decoded upload
+type Image struct {
+	Format Format
+	// Width and Height are the displayed size, after EXIF orientation
+	Width, Height int
+
+	img         image.Image
+	orientation int
+}
+
+// Decode validates and decodes an upload. Dimensions are checked from the
+// header before any pixel data is decoded. Only the first frame of an
+// animated GIF is kept.
+func Decode(data []byte) (*Image, error) {
+	format, err := Sniff(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var decodeConfig func([]byte) (image.Config, error)
+	var decode func([]byte) (image.Image, error)
+	switch format {
+	case JPEG:
+		decodeConfig = func(b []byte) (image.Config, error) { return jpeg.DecodeConfig(bytes.NewReader(b)) }
+		decode = func(b []byte) (image.Image, error) { return jpeg.Decode(bytes.NewReader(b)) }
+	case PNG:
+		decodeConfig = func(b []byte) (image.Config, error) { return png.DecodeConfig(bytes.NewReader(b)) }
+		decode = func(b []byte) (image.Image, error) { return png.Decode(bytes.NewReader(b)) }
+	case GIF:
+		decodeConfig = func(b []byte) (image.Config, error) { return gif.DecodeConfig(bytes.NewReader(b)) }
+		decode = func(b []byte) (image.Image, error) { return gif.Decode(bytes.NewReader(b)) }
+	case WebP:
+		decodeConfig = func(b []byte) (image.Config, error) { return webp.DecodeConfig(bytes.NewReader(b)) }
+		decode = func(b []byte) (image.Image, error) { return webp.Decode(bytes.NewReader(b)) }
+	}
+
+	config, err := decodeConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, ErrInvalidImage
+	}
+	if int64(config.Width)*int64(config.Height) > MaxPixels {
+		return nil, ErrTooManyPixels
+	}
+
+	img, err := decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	im := &Image{Format: format, img: img, orientation: 1}
+	if format == JPEG {
+		im.orientation = jpegOrientation(data)
+	}
+	im.Width, im.Height = img.Bounds().Dx(), img.Bounds().Dy()
+	if im.orientation >= 5 {
+		im.Width, im.Height = im.Height, im.Width
+	}
+	return im, nil
+}
+
+// Variant is one re-encoded size of an upload
+type Variant struct {
+	Size          int
+	Width, Height int
+	ContentType   string
+	Ext           string
+	Data          []byte
+}
+
+// Variant scales the image so its longest side is at most size, applies
+// the EXIF orientation and re-encodes it. Images are never upscaled.
+func (im *Image) Variant(size int) (Variant, error) {
+	w, h := fit(im.Width, im.Height, size)
+
+	// Scale in stored orientation, then rotate the much smaller result
+	sw, sh := w, h
+	if im.orientation >= 5 {
+		sw, sh = h, w
+	}
+	scaled := image.NewNRGBA(image.Rect(0, 0, sw, sh))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), im.img, im.img.Bounds(), draw.Src, nil)
+	out := orient(scaled, im.orientation)
+
+	v := Variant{Size: size, Width: w, Height: h}
+	var buf bytes.Buffer
+	if im.encodesAsJPEG() {
+		v.ContentType, v.Ext = "image/jpeg", ".jpg"
+		if err := jpeg.Encode(&buf, out, &jpeg.Options{Quality: JPEGQuality}); err != nil {
+			return Variant{}, err
+		}
+	} else {
+		v.ContentType, v.Ext = "image/png", ".png"
+		if err := png.Encode(&buf, out); err != nil {
+			return Variant{}, err
+		}
+	}
+	v.Data = buf.Bytes()
+	return v, nil
+}
+
+// encodesAsJPEG keeps photos lossy and everything that may carry
+// transparency or sharp edges (PNG, GIF, WebP with alpha) lossless
+func (im *Image) encodesAsJPEG() bool {
+	switch im.Format {
+	case JPEG:
+		return true
+	case WebP:
+		opaque, ok := im.img.(interface{ Opaque() bool })
+		return ok && opaque.Opaque()
+	}
+	return false
+}
+
+// Process decodes an upload and renders every size in Sizes
+func Process(data []byte) ([]Variant, error) {
+	im, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	variants := make([]Variant, 0, len(Sizes))
+	for _, size := range Sizes {
+		v, err := im.Variant(size)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, v)
+	}
+	return variants, nil
+}
+
+// fit returns the size of a w x h image scaled down so neither side
+// exceeds max, keeping the aspect ratio
+func fit(w, h, max int) (int, int) {
+	if w <= max && h <= max {
+		return w, h
+	}
+	if w >= h {
+		return max, maxInt(1, h*max/w)
+	}
+	return maxInt(1, w*max/h), max
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,191 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func testImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// exifJPEG returns a JPEG carrying an EXIF block with the given orientation
+// and a fake GPS marker that must not survive re-encoding
+func exifJPEG(t *testing.T, img image.Image, orientation uint16) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	plain := buf.Bytes()
+
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 1)           // one IFD entry
+	tiff = append(tiff, 0x01, 0x12, 0x00, 0x03, 0, 0, 0, 1) // orientation, SHORT, count 1
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation) // value
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)                   // padding, next IFD
+	tiff = append(tiff, []byte("GPSLatitude 35.6812N")...)  // payload to look for
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+
+	out := append([]byte{}, plain[:2]...)
+	out = append(out, 0xff, 0xe1)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(segment)+2))
+	out = append(out, segment...)
+	return append(out, plain[2:]...)
+}
+
+func TestSniff(t *testing.T) {
+	var gifBuf bytes.Buffer
+	gif.Encode(&gifBuf, testImage(4, 4), nil)
+
+	tests := []struct {
+		name string
+		data []byte
+		want Format
+		err  error
+	}{
+		{"png", encodePNG(t, testImage(4, 4)), PNG, nil},
+		{"gif", gifBuf.Bytes(), GIF, nil},
+		{"jpeg", exifJPEG(t, testImage(4, 4), 1), JPEG, nil},
+		{"webp", []byte("RIFF\x10\x00\x00\x00WEBPVP8 "), WebP, nil},
+		{"html labelled as png", []byte("<html><script>alert(1)</script></html>"), "", ErrUnsupportedFormat},
+		{"svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"/>`), "", ErrUnsupportedFormat},
+		{"empty", nil, "", ErrUnsupportedFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Sniff(tt.data)
+			if got != tt.want || err != tt.err {
+				t.Errorf("Sniff = %q, %v; want %q, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestDecodeRejectsPixelBomb(t *testing.T) {
+	data := encodePNG(t, testImage(1, 1))
+
+	// Rewrite the IHDR dimensions to 50000x50000 and fix its checksum
+	binary.BigEndian.PutUint32(data[16:], 50000)
+	binary.BigEndian.PutUint32(data[20:], 50000)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+
+	if _, err := Decode(data); !errors.Is(err, ErrTooManyPixels) {
+		t.Errorf("err = %v, want %v", err, ErrTooManyPixels)
+	}
+}
+
+func TestDecodeRejectsTruncatedImage(t *testing.T) {
+	data := encodePNG(t, testImage(16, 16))
+	if _, err := Decode(data[:len(data)/2]); !errors.Is(err, ErrInvalidImage) {
+		t.Errorf("err = %v, want %v", err, ErrInvalidImage)
+	}
+}
+
+func TestProcessStripsMetadataAndAppliesOrientation(t *testing.T) {
+	// Stored landscape, displayed portrait after rotating 90 degrees
+	data := exifJPEG(t, testImage(300, 200), 6)
+	if !bytes.Contains(data, []byte("GPSLatitude")) {
+		t.Fatal("fixture lacks EXIF data")
+	}
+
+	variants, err := Process(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[int][2]int{64: {42, 64}, 256: {170, 256}, 1024: {200, 300}}
+	if len(variants) != len(want) {
+		t.Fatalf("got %d variants, want %d", len(variants), len(want))
+	}
+	for _, v := range variants {
+		if bytes.Contains(v.Data, []byte("Exif")) || bytes.Contains(v.Data, []byte("GPSLatitude")) {
+			t.Errorf("%d: metadata survived re-encoding", v.Size)
+		}
+		if v.ContentType != "image/jpeg" || v.Ext != ".jpg" {
+			t.Errorf("%d: type = %s %s, want image/jpeg .jpg", v.Size, v.ContentType, v.Ext)
+		}
+
+		img, err := jpeg.Decode(bytes.NewReader(v.Data))
+		if err != nil {
+			t.Fatalf("%d: %v", v.Size, err)
+		}
+		got := [2]int{img.Bounds().Dx(), img.Bounds().Dy()}
+		if got != want[v.Size] || got != [2]int{v.Width, v.Height} {
+			t.Errorf("%d: size = %v (reported %dx%d), want %v", v.Size, got, v.Width, v.Height, want[v.Size])
+		}
+	}
+}
+
+func TestProcessKeepsTransparencyAsPNG(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+	img.Set(0, 0, color.NRGBA{255, 0, 0, 255})
+
+	variants, err := Process(encodePNG(t, img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range variants {
+		if v.ContentType != "image/png" || v.Width != 10 || v.Height != 10 {
+			t.Errorf("%d: %s %dx%d, want image/png 10x10", v.Size, v.ContentType, v.Width, v.Height)
+		}
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// A 2x1 image: red on the left, blue on the right
+	src := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	red, blue := color.NRGBA{255, 0, 0, 255}, color.NRGBA{0, 0, 255, 255}
+	src.Set(0, 0, red)
+	src.Set(1, 0, blue)
+
+	tests := []struct {
+		orientation int
+		w, h        int
+		first       color.NRGBA // pixel at (0, 0)
+	}{
+		{1, 2, 1, red},
+		{2, 2, 1, blue},
+		{3, 2, 1, blue},
+		{4, 2, 1, red},
+		{5, 1, 2, red},
+		{6, 1, 2, red},
+		{7, 1, 2, blue},
+		{8, 1, 2, blue},
+	}
+
+	for _, tt := range tests {
+		got := orient(src, tt.orientation)
+		if got.Bounds().Dx() != tt.w || got.Bounds().Dy() != tt.h {
+			t.Errorf("%d: size = %v, want %dx%d", tt.orientation, got.Bounds().Size(), tt.w, tt.h)
+			continue
+		}
+		if c := got.NRGBAAt(0, 0); c != tt.first {
+			t.Errorf("%d: first pixel = %v, want %v", tt.orientation, c, tt.first)
+		}
+	}
+}
@@ -7,13 +7,18 @@ import (
 )
 
 type User struct {
-	ID            int       `json:"id"`
-	OAuthID       string    `json:"oauth_id"`
-	OAuthProvider string    `json:"oauth_provider"`
-	DisplayName   string    `json:"display_name"`
-	ProfileImage  string    `json:"profile_image"`
-	Bio           string    `json:"bio"`
-	CreatedAt     time.Time `json:"created_at"`
+	ID                    int        `json:"id"`
+	OAuthID               string     `json:"oauth_id"`
+	OAuthProvider         string     `json:"oauth_provider"`
+	DisplayName           string     `json:"display_name"`
+	ProfileImage          string     `json:"profile_image"`
+	Bio                   string     `json:"bio"`
+	CreatedAt             time.Time  `json:"created_at"`
+	FollowerCount         int        `json:"follower_count"`
+	FollowingCount        int        `json:"following_count"`
+	FollowedByCurrentUser bool       `json:"followed_by_current_user"`
+	FollowedAt            *time.Time `json:"followed_at,omitempty"` // Set in follower/following lists
+	DeletionScheduledAt   *time.Time `json:"deletion_scheduled_at,omitempty"`
 }
 
 type Post struct {
@@ -29,6 +34,11 @@ type Post struct {
 	LikeCount          int            `json:"like_count"`
 	ReplyCount         int            `json:"reply_count"`
 	LikedByCurrentUser bool           `json:"liked_by_current_user"`
+	Replies            *Page[Reply]   `json:"replies,omitempty"`
+	// Rank and Snippet are set on search results. Snippet is HTML-escaped
+	// text with the matched terms wrapped in <mark>.
+	Rank    float64 `json:"-"`
+	Snippet string  `json:"snippet,omitempty"`
 }
 
 type Reply struct {
@@ -39,3 +49,128 @@ type Reply struct {
 	CreatedAt time.Time `json:"created_at"`
 	User      *User     `json:"user,omitempty"`
 }
+
+type Notification struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	ActorID   int        `json:"actor_id"`
+	Verb      string     `json:"verb"` // 'like', 'reply' or 'follow'
+	PostID    *int       `json:"post_id,omitempty"`
+	ReplyID   *int       `json:"reply_id,omitempty"`
+	Read      bool       `json:"read"`
+	ReadAt    *time.Time `json:"read_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	Actor     *User      `json:"actor,omitempty"`
+}
+
+// AccessToken is a personal access token as listed to its owner. The secret
+// itself is only returned once, when the token is created.
+type AccessToken struct {
+	ID         int            `json:"id"`
+	UserID     int            `json:"-"`
+	Name       string         `json:"name"`
+	Prefix     string         `json:"prefix"`
+	Scopes     pq.StringArray `json:"scopes"`
+	ExpiresAt  time.Time      `json:"expires_at"`
+	LastUsedAt *time.Time     `json:"last_used_at"`
+	CreatedAt  time.Time      `json:"created_at"`
+	Token      string         `json:"token,omitempty"`
+}
+
+// Upload is an image stored through the upload endpoint. Variants maps each
+// size to its blob key, which all start with KeyPrefix; Size is their total
+// in bytes and counts against the owner's quota.
+type Upload struct {
+	ID               int               `json:"id"`
+	UserID           int               `json:"-"`
+	SHA256           string            `json:"sha256"`
+	KeyPrefix        string            `json:"-"`
+	Variants         map[string]string `json:"-"`
+	Size             int64             `json:"size"`
+	CreatedAt        time.Time         `json:"created_at"`
+	LastReferencedAt time.Time         `json:"last_referenced_at"`
+}
+
+// Connection is an external account a user connected for cross-posting,
+// without its OAuth tokens
+type Connection struct {
+	UserID      int       `json:"-"`
+	Provider    string    `json:"provider"`
+	NeedsReauth bool      `json:"needs_reauth"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// OAuthToken is a user's token for calling a provider's API on their
+// behalf, e.g. to cross-post to X
+type OAuthToken struct {
+	ID           int
+	UserID       int
+	Provider     string
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+	NeedsReauth  bool
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// Identity is a login provider account linked to an Otogram user
+type Identity struct {
+	ID             int       `json:"id"`
+	UserID         int       `json:"user_id"`
+	Provider       string    `json:"provider"`
+	ProviderUserID string    `json:"provider_user_id"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Session is a server-side login session of one browser or device. Only the
+// hash of the ID in the session cookie is stored.
+type Session struct {
+	ID         int       `json:"id"`
+	TokenHash  string    `json:"-"`
+	UserID     int       `json:"-"`
+	Provider   string    `json:"provider"`
+	Data       []byte    `json:"-"`
+	Device     string    `json:"device"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// Current is set on the session making the request
+	Current bool `json:"current"`
+}
+
+// Cross-post job statuses
+const (
+	CrosspostPending   = "pending"
+	CrosspostRunning   = "running"
+	CrosspostSucceeded = "succeeded"
+	CrosspostFailed    = "failed"
+)
+
+// CrosspostJob is a queued cross-post of an Otogram post to an external
+// service
+type CrosspostJob struct {
+	ID            int        `json:"id"`
+	PostID        int        `json:"post_id"`
+	UserID        int        `json:"user_id"`
+	Provider      string     `json:"provider"`
+	Text          string     `json:"-"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	LastError     *string    `json:"last_error,omitempty"`
+	RemoteID      *string    `json:"remote_id,omitempty"`
+	RemoteURL     string     `json:"remote_url,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// Page is the response envelope for paginated lists. NextCursor is nil on
+// the last page.
+type Page[T any] struct {
+	Items      []T     `json:"items"`
+	NextCursor *string `json:"next_cursor"`
+}
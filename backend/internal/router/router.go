@@ -0,0 +1,166 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+
+	"backend/internal/apierror"
+	"backend/internal/auth"
+	"backend/internal/handlers"
+)
+
+// Route binds a method and path to a handler. Path may contain wildcards
+// such as {id}, which handlers read with r.PathValue.
+type Route struct {
+	Method  string
+	Path    string
+	Handler http.Handler
+}
+
+// Pattern returns the ServeMux pattern of the route, e.g. "POST /api/posts/{id}/like"
+func (rt Route) Pattern() string {
+	return rt.Method + " " + rt.Path
+}
+
+// Routes returns every route served by the API
+func Routes(api *handlers.Handler, authAPI *auth.Handler) []Route {
+	h := func(method, path string, fn http.HandlerFunc) Route {
+		return Route{Method: method, Path: path, Handler: fn}
+	}
+
+	routes := []Route{
+		// Auth routes, with /auth/{provider} and /auth/{provider}/callback
+		// for every login provider
+		h("GET", "/auth/{provider}", authAPI.HandleOAuthLogin),
+		h("POST", "/auth/{provider}", authAPI.HandleOAuthLogin),
+		h("GET", "/auth/{provider}/callback", authAPI.HandleOAuthCallback),
+		h("POST", "/auth/logout", auth.HandleLogout),
+		h("GET", "/auth/me", authAPI.HandleGetCurrentUser),
+		h("POST", "/auth/profile", authAPI.HandleUpdateProfile),
+		h("GET", "/auth/identities", authAPI.HandleGetIdentities),
+		h("DELETE", "/auth/identities/{id}", authAPI.HandleUnlinkIdentity),
+
+		// Session management routes
+		h("GET", "/api/sessions", authAPI.HandleListSessions),
+		h("DELETE", "/api/sessions", authAPI.HandleRevokeOtherSessions),
+		h("DELETE", "/api/sessions/{id}", authAPI.HandleRevokeSession),
+
+		// Personal access token routes
+		h("GET", "/api/tokens", authAPI.HandleListAccessTokens),
+		h("POST", "/api/tokens", authAPI.HandleCreateAccessToken),
+		h("DELETE", "/api/tokens/{id}", authAPI.HandleRevokeAccessToken),
+
+		// Account routes
+		h("DELETE", "/api/me", api.RequestAccountDeletion),
+		h("GET", "/api/me/export", api.ExportAccount),
+		h("POST", "/api/me/cancel-deletion", api.CancelAccountDeletion),
+
+		// Upload routes
+		h("POST", "/api/upload/image", api.UploadImage),
+		{Method: "GET", Path: "/uploads/", Handler: uploadHeaders(http.StripPrefix("/uploads/", api.Blobs))},
+
+		// Twitter integration routes
+		h("GET", "/api/twitter/check", api.CheckTwitterConnection),
+		h("POST", "/api/twitter/disconnect", api.DisconnectTwitter),
+
+		// Post routes
+		h("GET", "/api/posts", api.GetPosts),
+		h("POST", "/api/posts", api.CreatePost),
+		h("GET", "/api/posts/{id}", api.GetPost),
+		h("PUT", "/api/posts/{id}", api.UpdatePost),
+		h("PATCH", "/api/posts/{id}", api.UpdatePost),
+		h("DELETE", "/api/posts/{id}", api.DeletePost),
+		h("POST", "/api/posts/{id}/like", api.ToggleLike),
+		h("POST", "/api/posts/{id}/reply", api.CreateReply),
+		h("GET", "/api/posts/{id}/replies", api.GetReplies),
+		h("GET", "/api/posts/{id}/crosspost", api.GetCrosspostStatus),
+
+		// User routes
+		h("POST", "/api/users/{id}/follow", api.FollowUser),
+		h("DELETE", "/api/users/{id}/follow", api.UnfollowUser),
+		h("GET", "/api/users/{id}/followers", api.GetFollowers),
+		h("GET", "/api/users/{id}/following", api.GetFollowing),
+
+		h("GET", "/api/timeline", api.GetTimeline),
+
+		// Notification routes
+		h("GET", "/api/notifications", api.GetNotifications),
+		h("POST", "/api/notifications/read", api.MarkNotificationsRead),
+
+		// Server-Sent Events stream for feed updates and notifications
+		h("GET", "/api/stream", api.Stream),
+
+		h("GET", "/api/search/posts", api.SearchPosts),
+		h("GET", "/api/search/users", api.SearchUsers),
+
+		h("GET", "/health", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "OK")
+		}),
+	}
+
+	if auth.DevLoginEnabled() {
+		routes = append(routes,
+			h("GET", "/auth/dev", authAPI.HandleDevLogin),
+			h("POST", "/auth/dev/callback", authAPI.HandleDevCallback),
+		)
+	}
+
+	return routes
+}
+
+// uploadHeaders stops browsers from running anything served from /uploads/,
+// including files stored before uploads were re-encoded
+func uploadHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// New registers routes on a ServeMux. A request whose path matches a route
+// but not its method gets 405 Method Not Allowed with an Allow header
+// listing the methods the path supports. Like every other error, 404 and
+// 405 responses use the apierror JSON envelope.
+func New(routes []Route) http.Handler {
+	mux := http.NewServeMux()
+	for _, rt := range routes {
+		mux.Handle(rt.Pattern(), rt.Handler)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern == "" {
+			// ServeMux answers unmatched requests itself in plain text
+			w = &unmatchedWriter{ResponseWriter: w, r: r}
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// unmatchedWriter replaces the plain-text 404 and 405 bodies of ServeMux
+// with JSON errors, keeping the status and the Allow header
+type unmatchedWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	wroteHeader bool
+}
+
+func (u *unmatchedWriter) WriteHeader(status int) {
+	if u.wroteHeader {
+		return
+	}
+	u.wroteHeader = true
+
+	err := apierror.NotFound("Not found")
+	if status == http.StatusMethodNotAllowed {
+		err = apierror.New(status, apierror.CodeMethodNotAllowed, "Method not allowed")
+	}
+	apierror.Write(u.ResponseWriter, u.r, err)
+}
+
+func (u *unmatchedWriter) Write(b []byte) (int, error) {
+	if !u.wroteHeader {
+		u.WriteHeader(http.StatusNotFound)
+	}
+	return len(b), nil
+}
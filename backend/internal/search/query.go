@@ -0,0 +1,263 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// MaxClauses caps the number of words, phrases and filters in a query
+const MaxClauses = 20
+
+// DateLayout is the format of after: and before: dates, which are UTC days
+const DateLayout = "2006-01-02"
+
+// Fields a clause can restrict. FieldText matches the title, tags and
+// comment together.
+const (
+	FieldText    = ""
+	FieldTitle   = "title"
+	FieldComment = "comment"
+	FieldTag     = "tag"
+	FieldFrom    = "from"
+	FieldType    = "type"
+	FieldAfter   = "after"
+	FieldBefore  = "before"
+)
+
+// qualifiers lists the filters a query may use as name:value
+var qualifiers = []string{FieldTag, FieldFrom, FieldType, FieldAfter, FieldBefore, FieldTitle, FieldComment}
+
+// SongTypes are the values accepted by type:
+var SongTypes = []string{"spotify", "youtube", "applemusic", "other"}
+
+// Clause is one word, phrase or filter of a query
+type Clause struct {
+	Field string
+	// Value is the word, phrase, tag, author display name or song type
+	Value string
+	// Phrase is set when Value was quoted and must match as written
+	Phrase bool
+	// Negated clauses exclude the posts they match
+	Negated bool
+	// Date is the start of the day given to after: or before:
+	Date time.Time
+}
+
+// Query is a parsed post search. A post matches when it matches every
+// clause that is not negated and none that are.
+type Query struct {
+	Clauses []Clause
+}
+
+// SyntaxError reports why a query could not be parsed. Pos counts
+// characters from 1.
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("at character %d: %s", e.Pos, e.Msg)
+}
+
+// Parse reads a query made of space-separated clauses:
+//
+//	word              posts containing word in the title, tags or comment
+//	"exact phrase"    posts containing the phrase as written
+//	tag:citypop       posts tagged citypop
+//	from:alice        posts by the user displayed as alice (any case)
+//	type:spotify      posts of a song type: spotify, youtube, applemusic, other
+//	after:2026-01-01  posts created on or after the day (UTC)
+//	before:2026-02-01 posts created before the day (UTC)
+//	title:word        posts with word in the title; comment: likewise
+//
+// Values may be quoted, as in from:"DJ Alice". A leading "-" negates any
+// clause. Unknown name: prefixes are errors; quote the word to search for
+// text containing a colon. URLs are searched as text.
+func Parse(query string) (*Query, error) {
+	p := parser{input: []rune(query)}
+	q := &Query{}
+	for {
+		p.skipSpace()
+		if p.done() {
+			break
+		}
+		if len(q.Clauses) == MaxClauses {
+			return nil, p.errorf(p.pos, "too many terms (max %d)", MaxClauses)
+		}
+		clause, err := p.clause()
+		if err != nil {
+			return nil, err
+		}
+		q.Clauses = append(q.Clauses, clause)
+	}
+	if len(q.Clauses) == 0 {
+		return nil, &SyntaxError{Pos: 1, Msg: "query is empty"}
+	}
+	return q, nil
+}
+
+// FieldQuery returns a query matching value in a single field as typed,
+// without parsing it
+func FieldQuery(field, value string) *Query {
+	return &Query{Clauses: []Clause{{Field: field, Value: value, Phrase: true}}}
+}
+
+// Text returns the words and phrases the query looks for, joined by
+// spaces, for ranking results
+func (q *Query) Text() string {
+	return strings.Join(q.Highlights(), " ")
+}
+
+// Highlights returns the words and phrases to mark in result snippets
+func (q *Query) Highlights() []string {
+	var terms []string
+	for _, c := range q.Clauses {
+		if c.Negated {
+			continue
+		}
+		switch c.Field {
+		case FieldText, FieldTitle, FieldComment:
+			terms = append(terms, c.Value)
+		}
+	}
+	return terms
+}
+
+type parser struct {
+	input []rune
+	pos   int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *parser) skipSpace() {
+	for !p.done() && unicode.IsSpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
+
+func (p *parser) errorf(pos int, format string, args ...interface{}) *SyntaxError {
+	return &SyntaxError{Pos: pos + 1, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) clause() (Clause, error) {
+	var c Clause
+	start := p.pos
+	if p.input[p.pos] == '-' {
+		c.Negated = true
+		p.pos++
+		if p.done() || unicode.IsSpace(p.input[p.pos]) {
+			return c, p.errorf(start, `"-" must be followed by a word, phrase or filter`)
+		}
+	}
+
+	if p.input[p.pos] == '"' {
+		value, err := p.quoted()
+		if err != nil {
+			return c, err
+		}
+		c.Value, c.Phrase = value, true
+		return c, nil
+	}
+
+	wordStart := p.pos
+	word := p.word()
+	colon := strings.IndexRune(word, ':')
+	// URLs such as https://... are searched as text
+	if colon <= 0 || !isName(word[:colon]) || strings.HasPrefix(word[colon+1:], "//") {
+		c.Value = word
+		return c, nil
+	}
+
+	name := strings.ToLower(word[:colon])
+	if !isQualifier(name) {
+		return c, p.errorf(wordStart, "unknown filter %q; use one of %s, or quote %q to search for it",
+			name+":", strings.Join(qualifiers, ", "), word)
+	}
+	c.Field = name
+
+	valueStart := wordStart + len(name) + 1
+	c.Value = word[colon+1:]
+	if c.Value == "" && !p.done() && p.input[p.pos] == '"' {
+		value, err := p.quoted()
+		if err != nil {
+			return c, err
+		}
+		c.Value, c.Phrase = value, true
+	}
+	if c.Value == "" {
+		return c, p.errorf(wordStart, "%s: needs a value", name)
+	}
+	return c, p.validate(&c, valueStart)
+}
+
+// word reads up to the next space or quote
+func (p *parser) word() string {
+	start := p.pos
+	for !p.done() && !unicode.IsSpace(p.input[p.pos]) && p.input[p.pos] != '"' {
+		p.pos++
+	}
+	return string(p.input[start:p.pos])
+}
+
+// quoted reads a double-quoted string starting at the opening quote
+func (p *parser) quoted() (string, error) {
+	start := p.pos
+	p.pos++
+	for !p.done() && p.input[p.pos] != '"' {
+		p.pos++
+	}
+	if p.done() {
+		return "", p.errorf(start, "unterminated quote")
+	}
+	value := strings.TrimSpace(string(p.input[start+1 : p.pos]))
+	p.pos++
+	if value == "" {
+		return "", p.errorf(start, "empty quotes")
+	}
+	return value, nil
+}
+
+// validate checks and normalizes the value of a filter
+func (p *parser) validate(c *Clause, pos int) error {
+	switch c.Field {
+	case FieldType:
+		c.Value = strings.ToLower(c.Value)
+		for _, t := range SongTypes {
+			if c.Value == t {
+				return nil
+			}
+		}
+		return p.errorf(pos, "type: must be one of %s", strings.Join(SongTypes, ", "))
+	case FieldAfter, FieldBefore:
+		date, err := time.Parse(DateLayout, c.Value)
+		if err != nil {
+			return p.errorf(pos, "%s: expects a date like 2026-01-01, got %q", c.Field, c.Value)
+		}
+		c.Date = date
+	}
+	return nil
+}
+
+func isName(s string) bool {
+	for _, r := range s {
+		if r > unicode.MaxASCII || !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isQualifier(name string) bool {
+	for _, q := range qualifiers {
+		if name == q {
+			return true
+		}
+	}
+	return false
+}
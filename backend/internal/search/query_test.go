@@ -0,0 +1,161 @@
+package search
+
+import (
+	"backend/internal/database"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.Parse(DateLayout, s)
+		return d
+	}
+
+	tests := []struct {
+		query string
+		want  []Clause
+	}{
+		{"guitar", []Clause{{Value: "guitar"}}},
+		{"  night   drive ", []Clause{{Value: "night"}, {Value: "drive"}}},
+		{`"exact phrase"`, []Clause{{Value: "exact phrase", Phrase: true}}},
+		{
+			`tag:citypop from:alice type:spotify after:2026-01-01 -tag:remix "exact phrase"`,
+			[]Clause{
+				{Field: FieldTag, Value: "citypop"},
+				{Field: FieldFrom, Value: "alice"},
+				{Field: FieldType, Value: "spotify"},
+				{Field: FieldAfter, Value: "2026-01-01", Date: day("2026-01-01")},
+				{Field: FieldTag, Value: "remix", Negated: true},
+				{Value: "exact phrase", Phrase: true},
+			},
+		},
+		{"before:2026-02-01", []Clause{{Field: FieldBefore, Value: "2026-02-01", Date: day("2026-02-01")}}},
+		{`from:"DJ Alice"`, []Clause{{Field: FieldFrom, Value: "DJ Alice", Phrase: true}}},
+		{`-"bad take" -loud`, []Clause{{Value: "bad take", Phrase: true, Negated: true}, {Value: "loud", Negated: true}}},
+		{"TAG:Rock Type:YouTube", []Clause{{Field: FieldTag, Value: "Rock"}, {Field: FieldType, Value: "youtube"}}},
+		{"title:night comment:synth", []Clause{{Field: FieldTitle, Value: "night"}, {Field: FieldComment, Value: "synth"}}},
+		{"tag:a:b", []Clause{{Field: FieldTag, Value: "a:b"}}},
+		{`"Re:Zero"`, []Clause{{Value: "Re:Zero", Phrase: true}}},
+		{"12:30 :smile:", []Clause{{Value: "12:30"}, {Value: ":smile:"}}},
+		{"https://open.spotify.com/track/1", []Clause{{Value: "https://open.spotify.com/track/1"}}},
+		{"夜の音楽 tag:シティポップ", []Clause{{Value: "夜の音楽"}, {Field: FieldTag, Value: "シティポップ"}}},
+		{"a-b", []Clause{{Value: "a-b"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := Parse(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(q.Clauses, tt.want) {
+				t.Errorf("clauses =\n%+v\nwant\n%+v", q.Clauses, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		pos   int
+		want  string
+	}{
+		{"", 1, "query is empty"},
+		{"   ", 1, "query is empty"},
+		{`rock "city pop`, 6, "unterminated quote"},
+		{`""`, 1, "empty quotes"},
+		{"rock - pop", 6, `"-" must be followed`},
+		{"rock -", 6, `"-" must be followed`},
+		{"tag:", 1, "tag: needs a value"},
+		{"jazz from: alice", 6, "from: needs a value"},
+		{`tag:"`, 5, "unterminated quote"},
+		{"year:2024", 1, `unknown filter "year:"`},
+		{"Re:Zero", 1, `quote "Re:Zero"`},
+		{"type:cassette", 6, "type: must be one of spotify, youtube, applemusic, other"},
+		{"after:yesterday", 7, `after: expects a date like 2026-01-01, got "yesterday"`},
+		{"before:2026-13-01", 8, "before: expects a date"},
+		{strings.Repeat("a ", MaxClauses+1), MaxClauses*2 + 1, "too many terms"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := Parse(tt.query)
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("err = %v, want a *SyntaxError", err)
+			}
+			if syntaxErr.Pos != tt.pos || !strings.Contains(syntaxErr.Msg, tt.want) {
+				t.Errorf("err = %v, want %q at character %d", err, tt.want, tt.pos)
+			}
+		})
+	}
+}
+
+func TestQueryText(t *testing.T) {
+	q, err := Parse(`night "slow jam" -loud tag:rock title:drive -comment:cover`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := q.Highlights(), []string{"night", "slow jam", "drive"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Highlights() = %q, want %q", got, want)
+	}
+	if got, want := q.Text(), "night slow jam drive"; got != want {
+		t.Errorf("Text() = %q, want %q", got, want)
+	}
+}
+
+func TestWhere(t *testing.T) {
+	tests := []struct {
+		query string
+		where string
+		args  []interface{}
+	}{
+		{
+			"night",
+			"(p.search_vector @@ plainto_tsquery('simple', $2) OR p.search_text ILIKE $3)",
+			[]interface{}{"night", "%night%"},
+		},
+		{
+			`"100% pure_joy" -tag:remix`,
+			`p.search_text ILIKE $2 AND NOT COALESCE(p.tags @> ARRAY[$3]::text[], false)`,
+			[]interface{}{`%100\% pure\_joy%`, "remix"},
+		},
+		{
+			"from:Alice type:spotify after:2026-01-01 before:2026-02-01",
+			"lower(u.display_name) = lower($2) AND p.song_type = $3 AND p.created_at >= $4 AND p.created_at < $5",
+			[]interface{}{"Alice", "spotify", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			`title:night -comment:"cover"`,
+			"p.title ILIKE $2 AND NOT COALESCE(p.comment ILIKE $3, false)",
+			[]interface{}{"%night%", "%cover%"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := Parse(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// $1 is the viewer ID of database.PostSelectFields
+			var args []interface{}
+			where := q.Where(func(v interface{}) string {
+				args = append(args, v)
+				return "$" + strconv.Itoa(len(args)+1)
+			})
+			if where != tt.where {
+				t.Errorf("where =\n%s\nwant\n%s", where, tt.where)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args = %#v, want %#v", args, tt.args)
+			}
+			if query := database.BuildPostQuery(where); !strings.Contains(query, "WHERE "+tt.where+" ORDER BY") {
+				t.Errorf("BuildPostQuery(where) = %s", query)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// Package search parses post search queries, turns them into SQL
+// conditions and highlights what they matched in the results.
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// SnippetLength is the maximum number of characters of text in a snippet
+const SnippetLength = 120
+
+// Snippet returns an excerpt of the first of texts containing a term, or of
+// the first non-empty text when none does. The excerpt is HTML-escaped with
+// every case-insensitive occurrence of a term wrapped in <mark>, is cut to
+// SnippetLength characters around the first match, and is marked with "…"
+// where it was cut.
+func Snippet(terms []string, texts ...string) string {
+	var text []rune
+	var matches [][2]int
+	for _, t := range texts {
+		runes := []rune(strings.Join(strings.Fields(t), " "))
+		if len(runes) == 0 {
+			continue
+		}
+		found := findTerms(runes, terms)
+		if text == nil || len(found) > 0 {
+			text, matches = runes, found
+		}
+		if len(found) > 0 {
+			break
+		}
+	}
+	if text == nil {
+		return ""
+	}
+
+	start, end := 0, len(text)
+	if end > SnippetLength {
+		if len(matches) > 0 {
+			start = max(0, matches[0][0]-SnippetLength/4)
+		}
+		end = min(len(text), start+SnippetLength)
+		start = max(0, end-SnippetLength)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	pos := start
+	for _, m := range matches {
+		from, to := max(m[0], start), min(m[1], end)
+		if from >= to {
+			continue
+		}
+		b.WriteString(html.EscapeString(string(text[pos:from])))
+		b.WriteString("<mark>" + html.EscapeString(string(text[from:to])) + "</mark>")
+		pos = to
+	}
+	b.WriteString(html.EscapeString(string(text[pos:end])))
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// findTerms returns the sorted, non-overlapping [start, end) rune ranges of
+// text where a term occurs, ignoring case
+func findTerms(text []rune, terms []string) [][2]int {
+	folded := fold(text)
+	marked := make([]bool, len(text))
+	for _, term := range terms {
+		t := fold([]rune(term))
+		if len(t) == 0 {
+			continue
+		}
+		for i := 0; i+len(t) <= len(folded); i++ {
+			if equalRunes(folded[i:i+len(t)], t) {
+				for j := i; j < i+len(t); j++ {
+					marked[j] = true
+				}
+			}
+		}
+	}
+
+	var ranges [][2]int
+	for i := 0; i < len(marked); i++ {
+		if !marked[i] {
+			continue
+		}
+		j := i
+		for j < len(marked) && marked[j] {
+			j++
+		}
+		ranges = append(ranges, [2]int{i, j})
+		i = j
+	}
+	return ranges
+}
+
+func fold(runes []rune) []rune {
+	folded := make([]rune, len(runes))
+	for i, r := range runes {
+		folded[i] = unicode.ToLower(r)
+	}
+	return folded
+}
+
+func equalRunes(a, b []rune) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
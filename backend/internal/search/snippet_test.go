@@ -0,0 +1,65 @@
+package search
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSnippet(t *testing.T) {
+	long := strings.Repeat("a", 100) + " needle " + strings.Repeat("b", 100)
+
+	tests := []struct {
+		name  string
+		terms []string
+		texts []string
+		want  string
+	}{
+		{
+			"highlights every occurrence ignoring case",
+			[]string{"rock"}, []string{"Rock and ROCK"},
+			"<mark>Rock</mark> and <mark>ROCK</mark>",
+		},
+		{
+			"japanese substring",
+			[]string{"音楽"}, []string{"この音楽が好き"},
+			"この<mark>音楽</mark>が好き",
+		},
+		{
+			"overlapping terms are merged",
+			[]string{"night", "ghtdr"}, []string{"nightdrive"},
+			"<mark>nightdr</mark>ive",
+		},
+		{
+			"escapes html",
+			[]string{"b"}, []string{"<b>bold</b>"},
+			"&lt;<mark>b</mark>&gt;<mark>b</mark>old&lt;/<mark>b</mark>&gt;",
+		},
+		{
+			"uses the first text with a match",
+			[]string{"title"}, []string{"comment", "the title"},
+			"the <mark>title</mark>",
+		},
+		{
+			"falls back to the first non-empty text",
+			[]string{"missing"}, []string{"", "a   comment\nhere", "title"},
+			"a comment here",
+		},
+		{
+			"cuts around the first match",
+			[]string{"needle"}, []string{long},
+			"…" + strings.Repeat("a", 29) + " <mark>needle</mark> " + strings.Repeat("b", 83) + "…",
+		},
+		{
+			"nothing to show",
+			[]string{"x"}, []string{"", " "},
+			"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Snippet(tt.terms, tt.texts...); got != tt.want {
+				t.Errorf("Snippet() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package search
+
+import (
+	"strings"
+)
+
+// Where returns the SQL condition matching q over the p (posts) and u
+// (users) tables of database.PostFromClause, for use with
+// database.BuildPostQuery or database.BuildPostSearchQuery. Every value is
+// passed through bind, which adds it to the query arguments and returns its
+// placeholder.
+func (q *Query) Where(bind func(v interface{}) string) string {
+	conditions := make([]string, 0, len(q.Clauses))
+	for _, c := range q.Clauses {
+		condition := c.where(bind)
+		if c.Negated {
+			// A NULL comment or tag list must not hide the post
+			condition = "NOT COALESCE(" + condition + ", false)"
+		}
+		conditions = append(conditions, condition)
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+func (c Clause) where(bind func(v interface{}) string) string {
+	switch c.Field {
+	case FieldTitle:
+		return "p.title ILIKE " + bind(LikePattern(c.Value))
+	case FieldComment:
+		return "p.comment ILIKE " + bind(LikePattern(c.Value))
+	case FieldTag:
+		return "p.tags @> ARRAY[" + bind(c.Value) + "]::text[]"
+	case FieldFrom:
+		return "lower(u.display_name) = lower(" + bind(c.Value) + ")"
+	case FieldType:
+		return "p.song_type = " + bind(c.Value)
+	case FieldAfter:
+		return "p.created_at >= " + bind(c.Date)
+	case FieldBefore:
+		return "p.created_at < " + bind(c.Date)
+	}
+	if c.Phrase {
+		return "p.search_text ILIKE " + bind(LikePattern(c.Value))
+	}
+	// Whole words use the full-text index; substrings of unspaced text
+	// such as Japanese only match the trigram one
+	return "(p.search_vector @@ plainto_tsquery('simple', " + bind(c.Value) + ") OR p.search_text ILIKE " + bind(LikePattern(c.Value)) + ")"
+}
+
+// LikePattern matches s anywhere, with LIKE wildcards in s taken literally
+func LikePattern(s string) string {
+	return "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s) + "%"
+}
@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"backend/internal/apierror"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Local stores blobs as files in a directory and serves them itself
+type Local struct {
+	Dir     string
+	BaseURL string
+}
+
+// NewLocal returns a store writing to dir, creating it if needed. URLs
+// point at baseURL/uploads/.
+func NewLocal(dir, baseURL string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Local{Dir: dir, BaseURL: strings.TrimRight(baseURL, "/")}, nil
+}
+
+func (l *Local) path(key string) (string, error) {
+	if !validKey(key) {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(l.Dir, key), nil
+}
+
+// Put writes to a temporary file first so readers never see a partial blob
+func (l *Local) Put(ctx context.Context, key string, data io.Reader, size int64, contentType string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(l.Dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (l *Local) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (l *Local) List(ctx context.Context, prefix string) ([]string, error) {
+	entries, err := os.ReadDir(l.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && validKey(e.Name()) && strings.HasPrefix(e.Name(), prefix) {
+			keys = append(keys, e.Name())
+		}
+	}
+	return keys, nil
+}
+
+func (l *Local) URL(key string) string {
+	return l.BaseURL + "/uploads/" + key
+}
+
+// ServeHTTP serves a single file; directories are never listed
+func (l *Local) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path, err := l.path(strings.TrimPrefix(r.URL.Path, "/"))
+	if err != nil {
+		apierror.Write(w, r, apierror.NotFound("Not found"))
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		apierror.Write(w, r, apierror.NotFound("Not found"))
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		apierror.Write(w, r, apierror.NotFound("Not found"))
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"backend/internal/apierror"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Config configures an S3-compatible store
+type S3Config struct {
+	// Endpoint is the host[:port] of the service, e.g. "s3.amazonaws.com"
+	// or "minio:9000"
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+	// PublicURL is the base URL of a publicly readable bucket or CDN. When
+	// set, blob URLs point there directly; otherwise they point at
+	// BaseURL/uploads/, which redirects to a presigned URL.
+	PublicURL string
+	BaseURL   string
+	// SignedURLTTL is how long presigned URLs stay valid
+	SignedURLTTL time.Duration
+}
+
+// S3 stores blobs in an S3 bucket
+type S3 struct {
+	client *minio.Client
+	config S3Config
+}
+
+// NewS3 connects to the bucket, creating it if it does not exist yet
+func NewS3(ctx context.Context, config S3Config) (*S3, error) {
+	if config.Endpoint == "" || config.Bucket == "" {
+		return nil, errors.New("S3 endpoint and bucket are required")
+	}
+	if config.SignedURLTTL <= 0 {
+		config.SignedURLTTL = 15 * time.Minute
+	}
+	config.PublicURL = strings.TrimRight(config.PublicURL, "/")
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+
+	client, err := minio.New(config.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.AccessKey, config.SecretKey, ""),
+		Secure: config.UseSSL,
+		Region: config.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := client.BucketExists(ctx, config.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("check bucket %s: %w", config.Bucket, err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, config.Bucket, minio.MakeBucketOptions{Region: config.Region}); err != nil {
+			return nil, fmt.Errorf("create bucket %s: %w", config.Bucket, err)
+		}
+	}
+
+	return &S3{client: client, config: config}, nil
+}
+
+func (s *S3) Put(ctx context.Context, key string, data io.Reader, size int64, contentType string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+	_, err := s.client.PutObject(ctx, s.config.Bucket, key, data, size, minio.PutObjectOptions{
+		ContentType:  contentType,
+		CacheControl: "public, max-age=31536000, immutable",
+	})
+	return err
+}
+
+func (s *S3) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	if !validKey(key) {
+		return nil, ErrInvalidKey
+	}
+	obj, err := s.client.GetObject(ctx, s.config.Bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// GetObject is lazy; Stat surfaces a missing key
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+	// Deleting a missing key succeeds in S3
+	return s.client.RemoveObject(ctx, s.config.Bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *S3) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	for obj := range s.client.ListObjects(ctx, s.config.Bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		keys = append(keys, obj.Key)
+	}
+	return keys, nil
+}
+
+func (s *S3) URL(key string) string {
+	if s.config.PublicURL != "" {
+		return s.config.PublicURL + "/" + key
+	}
+	return s.config.BaseURL + "/uploads/" + key
+}
+
+// SignedURL returns a presigned GET URL valid for SignedURLTTL
+func (s *S3) SignedURL(ctx context.Context, key string) (*url.URL, error) {
+	if !validKey(key) {
+		return nil, ErrInvalidKey
+	}
+	return s.client.PresignedGetObject(ctx, s.config.Bucket, key, s.config.SignedURLTTL, nil)
+}
+
+// ServeHTTP redirects to the public URL or a freshly presigned one. The
+// redirect may be cached for half the signature's lifetime.
+func (s *S3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	if !validKey(key) {
+		apierror.Write(w, r, apierror.NotFound("Not found"))
+		return
+	}
+
+	if s.config.PublicURL != "" {
+		http.Redirect(w, r, s.URL(key), http.StatusFound)
+		return
+	}
+
+	signed, err := s.SignedURL(r.Context(), key)
+	if err != nil {
+		apierror.Write(w, r, fmt.Errorf("sign %s: %w", key, err))
+		return
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(s.config.SignedURLTTL.Seconds()/2)))
+	http.Redirect(w, r, signed.String(), http.StatusFound)
+}
@@ -0,0 +1,97 @@
+// Package storage keeps uploaded files behind the BlobStore interface so the
+// API can run on local disk in development and on S3-compatible object
+// storage (AWS S3, MinIO, R2, ...) when running several replicas.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when a blob does not exist
+var ErrNotFound = errors.New("blob not found")
+
+// ErrInvalidKey is returned for keys that could escape the store, e.g. "../x"
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// BlobStore stores uploaded files under flat keys such as "12_ab34_256.jpg"
+type BlobStore interface {
+	// Put stores size bytes from data under key, replacing any existing blob
+	Put(ctx context.Context, key string, data io.Reader, size int64, contentType string) error
+	// Open returns the content of a blob, or ErrNotFound
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes a blob. Deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+	// List returns the keys that start with prefix
+	List(ctx context.Context, prefix string) ([]string, error)
+	// URL returns the permanent URL of a blob, safe to store in the database
+	URL(key string) string
+	// ServeHTTP serves the blob named by the request path, relative to
+	// /uploads/. The local store sends the file; S3 redirects to it.
+	http.Handler
+}
+
+// validKey accepts keys made of letters, digits, '.', '-' and '_' that do
+// not start with a dot
+func validKey(key string) bool {
+	if key == "" || len(key) > 200 || key[0] == '.' {
+		return false
+	}
+	for _, c := range key {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// BackendURL returns the public base URL of the API, from BACKEND_URL
+func BackendURL() string {
+	if url := os.Getenv("BACKEND_URL"); url != "" {
+		return strings.TrimRight(url, "/")
+	}
+	return "http://127.0.0.1:8080"
+}
+
+// FromEnv builds the store selected by BLOB_BACKEND: "local" (default,
+// files in UPLOAD_DIR) or "s3" (configured by the S3_* variables)
+func FromEnv(ctx context.Context) (BlobStore, error) {
+	switch backend := os.Getenv("BLOB_BACKEND"); backend {
+	case "", "local":
+		dir := os.Getenv("UPLOAD_DIR")
+		if dir == "" {
+			dir = "./uploads"
+		}
+		return NewLocal(dir, BackendURL())
+	case "s3":
+		ttl := 15 * time.Minute
+		if v := os.Getenv("S3_SIGNED_URL_TTL"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("S3_SIGNED_URL_TTL: %w", err)
+			}
+			ttl = d
+		}
+		return NewS3(ctx, S3Config{
+			Endpoint:     os.Getenv("S3_ENDPOINT"),
+			Region:       os.Getenv("S3_REGION"),
+			Bucket:       os.Getenv("S3_BUCKET"),
+			AccessKey:    os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretKey:    os.Getenv("S3_SECRET_ACCESS_KEY"),
+			UseSSL:       os.Getenv("S3_USE_SSL") != "false",
+			PublicURL:    os.Getenv("S3_PUBLIC_URL"),
+			BaseURL:      BackendURL(),
+			SignedURLTTL: ttl,
+		})
+	default:
+		return nil, fmt.Errorf("unknown BLOB_BACKEND %q", backend)
+	}
+}
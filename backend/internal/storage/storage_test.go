@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testBlobStore runs the behaviour every BlobStore must share
+func testBlobStore(t *testing.T, store BlobStore) {
+	ctx := context.Background()
+	put := func(key, data string) {
+		t.Helper()
+		if err := store.Put(ctx, key, strings.NewReader(data), int64(len(data)), "image/png"); err != nil {
+			t.Fatalf("Put(%s): %v", key, err)
+		}
+	}
+
+	put("1_aaa_64.png", "small")
+	put("1_aaa_256.png", "medium")
+	put("2_bbb_64.png", "other user")
+	put("1_aaa_64.png", "replaced")
+
+	rc, err := store.Open(ctx, "1_aaa_64.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "replaced" {
+		t.Errorf("Open = %q, want %q", data, "replaced")
+	}
+
+	keys, err := store.List(ctx, "1_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "1_aaa_256.png,1_aaa_64.png" {
+		t.Errorf("List = %v", keys)
+	}
+
+	if err := store.Delete(ctx, "1_aaa_64.png"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, "1_aaa_64.png"); err != nil {
+		t.Errorf("deleting a missing blob: %v", err)
+	}
+	if _, err := store.Open(ctx, "1_aaa_64.png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open after Delete: err = %v, want %v", err, ErrNotFound)
+	}
+
+	for _, key := range []string{"", "../etc/passwd", "a/b.png", ".hidden", "x y.png"} {
+		if err := store.Put(ctx, key, strings.NewReader("x"), 1, "image/png"); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q): err = %v, want %v", key, err, ErrInvalidKey)
+		}
+	}
+}
+
+func TestLocal(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocal(dir, "http://api.test/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBlobStore(t, store)
+
+	if url := store.URL("1_aaa_256.png"); url != "http://api.test/uploads/1_aaa_256.png" {
+		t.Errorf("URL = %s", url)
+	}
+
+	// Files outside the store must not be reachable through the handler
+	os.WriteFile(dir+"/../secret.txt", []byte("secret"), 0644)
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/1_aaa_256.png", http.StatusOK},
+		{"/missing.png", http.StatusNotFound},
+		{"/", http.StatusNotFound},
+		{"/../secret.txt", http.StatusNotFound},
+		{"/..%2fsecret.txt", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		store.ServeHTTP(rec, httptest.NewRequest("GET", "http://api.test"+tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("GET %s: status = %d, want %d", tt.path, rec.Code, tt.want)
+		}
+	}
+}
+
+// TestS3 runs against a real S3-compatible service, e.g. a local MinIO:
+//
+//	docker run -p 9000:9000 minio/minio server /data
+//	S3_TEST_ENDPOINT=localhost:9000 S3_TEST_ACCESS_KEY_ID=minioadmin \
+//	  S3_TEST_SECRET_ACCESS_KEY=minioadmin go test ./internal/storage
+func TestS3(t *testing.T) {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT not set")
+	}
+
+	ctx := context.Background()
+	store, err := NewS3(ctx, S3Config{
+		Endpoint:     endpoint,
+		Bucket:       "otogram-test-" + time.Now().Format("20060102150405"),
+		AccessKey:    os.Getenv("S3_TEST_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("S3_TEST_SECRET_ACCESS_KEY"),
+		UseSSL:       os.Getenv("S3_TEST_USE_SSL") == "true",
+		BaseURL:      "http://api.test",
+		SignedURLTTL: time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBlobStore(t, store)
+
+	if url := store.URL("1_aaa_256.png"); url != "http://api.test/uploads/1_aaa_256.png" {
+		t.Errorf("URL = %s", url)
+	}
+
+	rec := httptest.NewRecorder()
+	store.ServeHTTP(rec, httptest.NewRequest("GET", "/1_aaa_256.png", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusFound)
+	}
+	resp, err := http.Get(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(data) != "medium" {
+		t.Errorf("presigned GET: status %d, body %q", resp.StatusCode, data)
+	}
+}
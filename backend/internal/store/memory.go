@@ -0,0 +1,1650 @@
+package store
+
+import (
+	"backend/internal/database"
+	"backend/internal/models"
+	"backend/internal/search"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Memory keeps every store's data in maps. It mirrors the behavior of the
+// Postgres stores closely enough for handler tests and is safe for
+// concurrent use.
+type Memory struct {
+	mu sync.Mutex
+
+	// Now is the clock used for created_at values
+	Now func() time.Time
+
+	nextID        map[string]int
+	users         map[int]*models.User
+	posts         map[int]*models.Post
+	replies       map[int]*models.Reply
+	likes         map[[2]int]time.Time // {user_id, post_id}
+	follows       map[[2]int]time.Time // {follower_id, followee_id}
+	tokens        map[int]*models.AccessToken
+	tokenHash     map[string]int
+	uploads       map[int]*models.Upload
+	notifications map[int]*models.Notification
+	oauthTokens   map[connectionKey]*models.OAuthToken
+	crossposts    []models.CrosspostJob
+	leases        map[int]time.Time // crosspost job ID -> locked_until
+	identities    map[int]*models.Identity
+	sessions      map[int]*models.Session
+}
+
+type connectionKey struct {
+	userID   int
+	provider string
+}
+
+// NewMemory returns an empty in-memory database
+func NewMemory() *Memory {
+	return &Memory{
+		Now:       time.Now,
+		nextID:    make(map[string]int),
+		users:     make(map[int]*models.User),
+		posts:     make(map[int]*models.Post),
+		replies:   make(map[int]*models.Reply),
+		likes:     make(map[[2]int]time.Time),
+		follows:   make(map[[2]int]time.Time),
+		tokens:    make(map[int]*models.AccessToken),
+		tokenHash: make(map[string]int),
+		uploads:   make(map[int]*models.Upload),
+
+		notifications: make(map[int]*models.Notification),
+		oauthTokens:   make(map[connectionKey]*models.OAuthToken),
+		leases:        make(map[int]time.Time),
+		identities:    make(map[int]*models.Identity),
+		sessions:      make(map[int]*models.Session),
+	}
+}
+
+// Stores returns the stores backed by m
+func (m *Memory) Stores() *Stores {
+	return &Stores{
+		Posts:   memPostStore{m},
+		Users:   memUserStore{m},
+		Likes:   memLikeStore{m},
+		Replies: memReplyStore{m},
+		Tokens:  memTokenStore{m},
+		Uploads: memUploadStore{m},
+
+		Follows:       memFollowStore{m},
+		Notifications: memNotificationStore{m},
+		Connections:   memConnectionStore{m},
+		Crossposts:    memCrosspostStore{m},
+		Accounts:      memAccountStore{m},
+		Identities:    memIdentityStore{m},
+		Sessions:      memSessionStore{m},
+	}
+}
+
+// AddUser inserts a user, setting its ID and CreatedAt, and links the
+// identity given by its OAuthProvider and OAuthID
+func (m *Memory) AddUser(user models.User) *models.User {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user.ID = m.id("users")
+	user.CreatedAt = m.Now()
+	m.users[user.ID] = &user
+	if user.OAuthProvider != "" {
+		m.link(user.ID, user.OAuthProvider, user.OAuthID)
+	}
+	copied := user
+	return &copied
+}
+
+// Follow makes follower follow followee
+func (m *Memory) Follow(followerID, followeeID int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.follows[[2]int{followerID, followeeID}] = m.Now()
+}
+
+// Connect records that a user connected an external account, with a token
+// valid for an hour
+func (m *Memory) Connect(userID int, provider string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.Now()
+	m.oauthTokens[connectionKey{userID, provider}] = &models.OAuthToken{
+		ID: m.id("oauth_tokens"), UserID: userID, Provider: provider, AccessToken: "access-token",
+		ExpiresAt: now.Add(time.Hour), CreatedAt: now, UpdatedAt: now,
+	}
+}
+
+// Crossposts returns the cross-post jobs queued so far
+func (m *Memory) Crossposts() []models.CrosspostJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]models.CrosspostJob(nil), m.crossposts...)
+}
+
+func (m *Memory) id(table string) int {
+	m.nextID[table]++
+	return m.nextID[table]
+}
+
+// author returns the user fields selected with a post or reply
+func (m *Memory) author(id int) *models.User {
+	u, ok := m.users[id]
+	if !ok {
+		return &models.User{}
+	}
+	return &models.User{ID: u.ID, DisplayName: u.DisplayName, ProfileImage: u.ProfileImage, Bio: u.Bio}
+}
+
+// post returns a copy of a post with the computed fields of PostSelectFields
+func (m *Memory) post(p *models.Post, viewerID int) models.Post {
+	post := *p
+	post.Tags = append(pq.StringArray(nil), p.Tags...)
+	post.User = m.author(p.UserID)
+	for key := range m.likes {
+		if key[1] == p.ID {
+			post.LikeCount++
+			if key[0] == viewerID {
+				post.LikedByCurrentUser = true
+			}
+		}
+	}
+	for _, r := range m.replies {
+		if r.PostID == p.ID {
+			post.ReplyCount++
+		}
+	}
+	return post
+}
+
+// paginate orders items by their cursor and returns the page after
+// page.Cursor, with one extra item like database.Keyset.Build
+func paginate[T any](items []T, cursorOf func(T) database.Cursor, ascending bool, page database.PageRequest) []T {
+	less := func(a, b database.Cursor) bool {
+		if a.Rank != nil && b.Rank != nil {
+			if *a.Rank != *b.Rank {
+				return *a.Rank < *b.Rank
+			}
+			return a.ID < b.ID
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if ascending {
+			return less(cursorOf(items[i]), cursorOf(items[j]))
+		}
+		return less(cursorOf(items[j]), cursorOf(items[i]))
+	})
+
+	var result []T
+	for _, item := range items {
+		if page.Cursor != nil {
+			c := cursorOf(item)
+			if ascending && !less(*page.Cursor, c) || !ascending && !less(c, *page.Cursor) {
+				continue
+			}
+		}
+		result = append(result, item)
+		if len(result) > page.Limit {
+			break
+		}
+	}
+	return result
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+type memPostStore struct{ m *Memory }
+
+func (s memPostStore) List(ctx context.Context, viewerID int, filter PostFilter, page database.PageRequest) ([]models.Post, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var posts []models.Post
+	for _, p := range s.m.posts {
+		if filter.UserID != 0 && p.UserID != filter.UserID {
+			continue
+		}
+		if filter.FollowedBy != 0 {
+			if _, ok := s.m.follows[[2]int{filter.FollowedBy, p.UserID}]; !ok {
+				continue
+			}
+		}
+		if filter.Search != nil && !s.m.matches(p, filter.Search) {
+			continue
+		}
+		post := s.m.post(p, viewerID)
+		if filter.Search != nil {
+			post.Rank = searchRank(p, filter)
+		}
+		posts = append(posts, post)
+	}
+
+	return paginate(posts, func(p models.Post) database.Cursor {
+		c := database.Cursor{CreatedAt: p.CreatedAt, ID: p.ID}
+		if filter.Search != nil {
+			c.Rank = &p.Rank
+		}
+		return c
+	}, false, page), nil
+}
+
+// searchRank approximates the Postgres ranking: each query word found in
+// the title counts most, then in a tag, then in the comment
+func searchRank(p *models.Post, filter PostFilter) float64 {
+	rank := 0.0
+	for _, word := range strings.Fields(filter.Search.Text()) {
+		if containsFold(p.Title, word) {
+			rank += 1
+		}
+		for _, tag := range p.Tags {
+			if strings.EqualFold(tag, word) {
+				rank += 0.4
+			}
+		}
+		if containsFold(p.Comment, word) {
+			rank += 0.2
+		}
+	}
+	if filter.BoostRecent {
+		rank += float64(p.CreatedAt.Unix()) / 86400 * RecencyBoost
+	}
+	return rank
+}
+
+// matches evaluates a search query the way search.Query.Where does in SQL
+func (m *Memory) matches(p *models.Post, query *search.Query) bool {
+	for _, c := range query.Clauses {
+		if m.matchesClause(p, c) == c.Negated {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Memory) matchesClause(p *models.Post, c search.Clause) bool {
+	switch c.Field {
+	case search.FieldTitle:
+		return containsFold(p.Title, c.Value)
+	case search.FieldComment:
+		return containsFold(p.Comment, c.Value)
+	case search.FieldTag:
+		for _, tag := range p.Tags {
+			if tag == c.Value {
+				return true
+			}
+		}
+		return false
+	case search.FieldFrom:
+		u, ok := m.users[p.UserID]
+		return ok && strings.EqualFold(u.DisplayName, c.Value)
+	case search.FieldType:
+		return p.SongType == c.Value
+	case search.FieldAfter:
+		return !p.CreatedAt.Before(c.Date)
+	case search.FieldBefore:
+		return p.CreatedAt.Before(c.Date)
+	}
+	return containsFold(p.Title+" "+strings.Join(p.Tags, " ")+" "+p.Comment, c.Value)
+}
+
+func (s memPostStore) Get(ctx context.Context, viewerID, id int) (*models.Post, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	p, ok := s.m.posts[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	post := s.m.post(p, viewerID)
+	return &post, nil
+}
+
+func (s memPostStore) Create(ctx context.Context, post *models.Post, crossposts ...Crosspost) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.users[post.UserID]; !ok {
+		return fmt.Errorf("user %d does not exist", post.UserID)
+	}
+
+	post.ID = s.m.id("posts")
+	post.CreatedAt = s.m.Now()
+	stored := models.Post{
+		ID:        post.ID,
+		UserID:    post.UserID,
+		Title:     post.Title,
+		SongID:    post.SongID,
+		SongType:  post.SongType,
+		Comment:   post.Comment,
+		Tags:      append(pq.StringArray(nil), post.Tags...),
+		CreatedAt: post.CreatedAt,
+	}
+	s.m.posts[post.ID] = &stored
+
+	for _, c := range crossposts {
+		nextAttemptAt := post.CreatedAt
+		s.m.crossposts = append(s.m.crossposts, models.CrosspostJob{
+			ID:            s.m.id("crosspost_jobs"),
+			PostID:        post.ID,
+			UserID:        post.UserID,
+			Provider:      c.Provider,
+			Text:          c.Text(post.ID),
+			Status:        models.CrosspostPending,
+			NextAttemptAt: &nextAttemptAt,
+			CreatedAt:     post.CreatedAt,
+			UpdatedAt:     post.CreatedAt,
+		})
+	}
+	return nil
+}
+
+func (s memPostStore) Update(ctx context.Context, id int, update PostUpdate) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	p, ok := s.m.posts[id]
+	if !ok {
+		return nil
+	}
+	if update.Title != nil {
+		p.Title = *update.Title
+	}
+	if update.SongID != nil {
+		p.SongID = *update.SongID
+	}
+	if update.SongType != nil {
+		p.SongType = *update.SongType
+	}
+	if update.Comment != nil {
+		p.Comment = *update.Comment
+	}
+	if update.Tags != nil {
+		p.Tags = append(pq.StringArray{}, *update.Tags...)
+	}
+	return nil
+}
+
+func (s memPostStore) Delete(ctx context.Context, id int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	s.m.deletePost(id)
+	return nil
+}
+
+// deletePost removes a post with the rows that reference it
+func (m *Memory) deletePost(id int) {
+	delete(m.posts, id)
+	for key := range m.likes {
+		if key[1] == id {
+			delete(m.likes, key)
+		}
+	}
+	for replyID, r := range m.replies {
+		if r.PostID == id {
+			delete(m.replies, replyID)
+		}
+	}
+	for notificationID, n := range m.notifications {
+		if n.PostID != nil && *n.PostID == id {
+			delete(m.notifications, notificationID)
+		}
+	}
+	jobs := m.crossposts[:0]
+	for _, j := range m.crossposts {
+		if j.PostID != id {
+			jobs = append(jobs, j)
+		} else {
+			delete(m.leases, j.ID)
+		}
+	}
+	m.crossposts = jobs
+}
+
+func (s memPostStore) OwnerID(ctx context.Context, id int) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	p, ok := s.m.posts[id]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return p.UserID, nil
+}
+
+type memUserStore struct{ m *Memory }
+
+// listedUser returns a copy of a user with the fields of UserSelectFields
+func (m *Memory) listedUser(u *models.User, viewerID int) models.User {
+	user := models.User{
+		ID:           u.ID,
+		DisplayName:  u.DisplayName,
+		ProfileImage: u.ProfileImage,
+		Bio:          u.Bio,
+		CreatedAt:    u.CreatedAt,
+	}
+	for key := range m.follows {
+		if key[1] == u.ID {
+			user.FollowerCount++
+			if key[0] == viewerID {
+				user.FollowedByCurrentUser = true
+			}
+		}
+		if key[0] == u.ID {
+			user.FollowingCount++
+		}
+	}
+	return user
+}
+
+func (s memUserStore) Get(ctx context.Context, id int) (*models.User, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	u, ok := s.m.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	user := *u
+	return &user, nil
+}
+
+func (s memUserStore) UpdateProfile(ctx context.Context, id int, displayName, profileImage, bio string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if u, ok := s.m.users[id]; ok {
+		u.DisplayName = displayName
+		u.ProfileImage = profileImage
+		u.Bio = bio
+	}
+	return nil
+}
+
+func (s memUserStore) Search(ctx context.Context, viewerID int, query string, page database.PageRequest) ([]models.User, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var users []models.User
+	for _, u := range s.m.users {
+		if query != "" && !containsFold(u.DisplayName, query) {
+			continue
+		}
+		users = append(users, s.m.listedUser(u, viewerID))
+	}
+
+	return paginate(users, func(u models.User) database.Cursor {
+		return database.Cursor{CreatedAt: u.CreatedAt, ID: u.ID}
+	}, false, page), nil
+}
+
+func (s memUserStore) List(ctx context.Context, limit int) ([]models.User, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var users []models.User
+	for _, u := range s.m.users {
+		users = append(users, models.User{
+			ID: u.ID, OAuthID: u.OAuthID, OAuthProvider: u.OAuthProvider,
+			DisplayName: u.DisplayName, ProfileImage: u.ProfileImage, Bio: u.Bio, CreatedAt: u.CreatedAt,
+		})
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	return users, nil
+}
+
+type memLikeStore struct{ m *Memory }
+
+func (s memLikeStore) Liked(ctx context.Context, userID, postID int) (bool, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	_, ok := s.m.likes[[2]int{userID, postID}]
+	return ok, nil
+}
+
+func (s memLikeStore) Like(ctx context.Context, userID, postID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.posts[postID]; !ok {
+		return fmt.Errorf("post %d does not exist", postID)
+	}
+	key := [2]int{userID, postID}
+	if _, ok := s.m.likes[key]; !ok {
+		s.m.likes[key] = s.m.Now()
+	}
+	return nil
+}
+
+func (s memLikeStore) Unlike(ctx context.Context, userID, postID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	delete(s.m.likes, [2]int{userID, postID})
+	return nil
+}
+
+func (s memLikeStore) Count(ctx context.Context, postID int) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	count := 0
+	for key := range s.m.likes {
+		if key[1] == postID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+type memReplyStore struct{ m *Memory }
+
+func (s memReplyStore) Create(ctx context.Context, reply *models.Reply) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.posts[reply.PostID]; !ok {
+		return fmt.Errorf("post %d does not exist", reply.PostID)
+	}
+
+	reply.ID = s.m.id("replies")
+	reply.CreatedAt = s.m.Now()
+	stored := *reply
+	stored.User = nil
+	s.m.replies[reply.ID] = &stored
+	return nil
+}
+
+func (s memReplyStore) List(ctx context.Context, postID int, page database.PageRequest) ([]models.Reply, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var replies []models.Reply
+	for _, r := range s.m.replies {
+		if r.PostID != postID {
+			continue
+		}
+		reply := *r
+		author := s.m.author(r.UserID)
+		reply.User = &models.User{ID: author.ID, DisplayName: author.DisplayName, ProfileImage: author.ProfileImage}
+		replies = append(replies, reply)
+	}
+
+	return paginate(replies, func(r models.Reply) database.Cursor {
+		return database.Cursor{CreatedAt: r.CreatedAt, ID: r.ID}
+	}, true, page), nil
+}
+
+type memTokenStore struct{ m *Memory }
+
+func (s memTokenStore) Create(ctx context.Context, token *models.AccessToken, hash string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	token.ID = s.m.id("personal_access_tokens")
+	token.CreatedAt = s.m.Now()
+	stored := *token
+	stored.Token = ""
+	s.m.tokens[token.ID] = &stored
+	s.m.tokenHash[hash] = token.ID
+	return nil
+}
+
+func (s memTokenStore) List(ctx context.Context, userID int) ([]models.AccessToken, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	tokens := []models.AccessToken{}
+	for _, t := range s.m.tokens {
+		if t.UserID == userID {
+			tokens = append(tokens, *t)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].ID > tokens[j].ID })
+	return tokens, nil
+}
+
+func (s memTokenStore) Revoke(ctx context.Context, userID, id int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	t, ok := s.m.tokens[id]
+	if !ok || t.UserID != userID {
+		return ErrNotFound
+	}
+	delete(s.m.tokens, id)
+	for hash, tokenID := range s.m.tokenHash {
+		if tokenID == id {
+			delete(s.m.tokenHash, hash)
+		}
+	}
+	return nil
+}
+
+func (s memTokenStore) Lookup(ctx context.Context, hash string) (*models.AccessToken, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	t, ok := s.m.tokens[s.m.tokenHash[hash]]
+	if !ok || !t.ExpiresAt.After(s.m.Now()) {
+		return nil, ErrNotFound
+	}
+	if u, ok := s.m.users[t.UserID]; !ok || u.DeletionScheduledAt != nil {
+		return nil, ErrNotFound
+	}
+	token := *t
+	return &token, nil
+}
+
+func (s memTokenStore) Touch(ctx context.Context, id int, at time.Time) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if t, ok := s.m.tokens[id]; ok {
+		t.LastUsedAt = &at
+	}
+	return nil
+}
+
+type memUploadStore struct{ m *Memory }
+
+// upload returns a copy of an upload that does not share its Variants
+func (m *Memory) upload(u *models.Upload) *models.Upload {
+	upload := *u
+	upload.Variants = make(map[string]string, len(u.Variants))
+	for size, key := range u.Variants {
+		upload.Variants[size] = key
+	}
+	return &upload
+}
+
+// referenced reports whether a profile image or post comment links to u,
+// wherever its blobs are served from
+func (m *Memory) referenced(u *models.Upload) bool {
+	link := "/" + u.KeyPrefix + "_"
+	for _, user := range m.users {
+		if strings.Contains(user.ProfileImage, link) {
+			return true
+		}
+	}
+	for _, p := range m.posts {
+		if strings.Contains(p.Comment, link) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s memUploadStore) Reuse(ctx context.Context, userID int, sha256 string) (*models.Upload, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, u := range s.m.uploads {
+		if u.UserID == userID && u.SHA256 == sha256 {
+			u.LastReferencedAt = s.m.Now()
+			return s.m.upload(u), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s memUploadStore) Usage(ctx context.Context, userID int) (int64, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	return s.m.usage(userID), nil
+}
+
+func (s memUploadStore) List(ctx context.Context, userID int) ([]models.Upload, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var uploads []models.Upload
+	for _, u := range s.m.uploads {
+		if u.UserID == userID {
+			uploads = append(uploads, *s.m.upload(u))
+		}
+	}
+	sort.Slice(uploads, func(i, j int) bool { return uploads[i].ID < uploads[j].ID })
+	return uploads, nil
+}
+
+func (m *Memory) usage(userID int) int64 {
+	var usage int64
+	for _, u := range m.uploads {
+		if u.UserID == userID {
+			usage += u.Size
+		}
+	}
+	return usage
+}
+
+func (s memUploadStore) Create(ctx context.Context, upload *models.Upload, quota int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.users[upload.UserID]; !ok {
+		return ErrNotFound
+	}
+	if s.m.usage(upload.UserID)+upload.Size > quota {
+		return ErrQuotaExceeded
+	}
+	for _, u := range s.m.uploads {
+		if u.UserID == upload.UserID && u.SHA256 == upload.SHA256 {
+			return ErrDuplicate
+		}
+	}
+
+	upload.ID = s.m.id("uploads")
+	upload.CreatedAt = s.m.Now()
+	upload.LastReferencedAt = upload.CreatedAt
+	s.m.uploads[upload.ID] = s.m.upload(upload)
+	return nil
+}
+
+func (s memUploadStore) Sweep(ctx context.Context, grace time.Duration) ([]models.Upload, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	now := s.m.Now()
+	var deleted []models.Upload
+	for id, u := range s.m.uploads {
+		if s.m.referenced(u) {
+			u.LastReferencedAt = now
+			continue
+		}
+		if u.LastReferencedAt.Before(now.Add(-grace)) {
+			deleted = append(deleted, *s.m.upload(u))
+			delete(s.m.uploads, id)
+		}
+	}
+	sort.Slice(deleted, func(i, j int) bool { return deleted[i].ID < deleted[j].ID })
+	return deleted, nil
+}
+
+type memFollowStore struct{ m *Memory }
+
+func (s memFollowStore) Follow(ctx context.Context, followerID, followeeID int) (bool, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.users[followeeID]; !ok {
+		return false, fmt.Errorf("user %d does not exist", followeeID)
+	}
+	key := [2]int{followerID, followeeID}
+	if _, ok := s.m.follows[key]; ok {
+		return false, nil
+	}
+	s.m.follows[key] = s.m.Now()
+	return true, nil
+}
+
+func (s memFollowStore) Unfollow(ctx context.Context, followerID, followeeID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	delete(s.m.follows, [2]int{followerID, followeeID})
+	return nil
+}
+
+func (s memFollowStore) Followers(ctx context.Context, viewerID, userID int, page database.PageRequest) ([]models.User, error) {
+	return s.list(viewerID, userID, 1, page), nil
+}
+
+func (s memFollowStore) Following(ctx context.Context, viewerID, userID int, page database.PageRequest) ([]models.User, error) {
+	return s.list(viewerID, userID, 0, page), nil
+}
+
+// list returns the users on the other side of userID's follows, where side
+// is the index of userID in the follows keys
+func (s memFollowStore) list(viewerID, userID, side int, page database.PageRequest) []models.User {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var users []models.User
+	for key, followedAt := range s.m.follows {
+		if key[side] != userID {
+			continue
+		}
+		u, ok := s.m.users[key[1-side]]
+		if !ok {
+			continue
+		}
+		user := s.m.listedUser(u, viewerID)
+		at := followedAt
+		user.FollowedAt = &at
+		users = append(users, user)
+	}
+
+	return paginate(users, func(u models.User) database.Cursor {
+		return database.Cursor{CreatedAt: *u.FollowedAt, ID: u.ID}
+	}, false, page)
+}
+
+type memNotificationStore struct{ m *Memory }
+
+func (s memNotificationStore) Create(ctx context.Context, n *models.Notification) (bool, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if n.PostID != nil {
+		p, ok := s.m.posts[*n.PostID]
+		if !ok || p.UserID == n.ActorID {
+			return false, nil
+		}
+		n.UserID = p.UserID
+	}
+
+	n.ID = s.m.id("notifications")
+	n.CreatedAt = s.m.Now()
+	stored := *n
+	stored.Actor = nil
+	s.m.notifications[n.ID] = &stored
+	return true, nil
+}
+
+func (s memNotificationStore) DeleteForPost(ctx context.Context, actorID, postID int, verb string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for id, n := range s.m.notifications {
+		if n.ActorID == actorID && n.PostID != nil && *n.PostID == postID && n.Verb == verb {
+			delete(s.m.notifications, id)
+		}
+	}
+	return nil
+}
+
+func (s memNotificationStore) DeleteForUser(ctx context.Context, actorID, userID int, verb string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for id, n := range s.m.notifications {
+		if n.ActorID == actorID && n.UserID == userID && n.Verb == verb {
+			delete(s.m.notifications, id)
+		}
+	}
+	return nil
+}
+
+func (s memNotificationStore) List(ctx context.Context, userID int, unreadOnly bool, page database.PageRequest) ([]models.Notification, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var notifications []models.Notification
+	for _, n := range s.m.notifications {
+		if n.UserID != userID || unreadOnly && n.ReadAt != nil {
+			continue
+		}
+		notification := *n
+		notification.Read = n.ReadAt != nil
+		author := s.m.author(n.ActorID)
+		notification.Actor = &models.User{ID: author.ID, DisplayName: author.DisplayName, ProfileImage: author.ProfileImage}
+		notifications = append(notifications, notification)
+	}
+
+	return paginate(notifications, func(n models.Notification) database.Cursor {
+		return database.Cursor{CreatedAt: n.CreatedAt, ID: n.ID}
+	}, false, page), nil
+}
+
+func (s memNotificationStore) UnreadCount(ctx context.Context, userID int) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	count := 0
+	for _, n := range s.m.notifications {
+		if n.UserID == userID && n.ReadAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s memNotificationStore) MarkRead(ctx context.Context, userID int, ids []int64) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	now := s.m.Now()
+	for _, id := range ids {
+		if n, ok := s.m.notifications[int(id)]; ok && n.UserID == userID && n.ReadAt == nil {
+			n.ReadAt = &now
+		}
+	}
+	return nil
+}
+
+func (s memNotificationStore) MarkAllRead(ctx context.Context, userID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	now := s.m.Now()
+	for _, n := range s.m.notifications {
+		if n.UserID == userID && n.ReadAt == nil {
+			n.ReadAt = &now
+		}
+	}
+	return nil
+}
+
+type memConnectionStore struct{ m *Memory }
+
+func (s memConnectionStore) Get(ctx context.Context, userID int, provider string) (*models.Connection, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	t, ok := s.m.oauthTokens[connectionKey{userID, provider}]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &models.Connection{
+		UserID: t.UserID, Provider: t.Provider, NeedsReauth: t.NeedsReauth, CreatedAt: t.CreatedAt, UpdatedAt: t.UpdatedAt,
+	}, nil
+}
+
+func (s memConnectionStore) Delete(ctx context.Context, userID int, provider string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	delete(s.m.oauthTokens, connectionKey{userID, provider})
+	return nil
+}
+
+func (s memConnectionStore) Save(ctx context.Context, token *models.OAuthToken) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	key := connectionKey{token.UserID, token.Provider}
+	stored := *token
+	stored.NeedsReauth = false
+	stored.UpdatedAt = s.m.Now()
+	if existing, ok := s.m.oauthTokens[key]; ok {
+		stored.ID, stored.CreatedAt = existing.ID, existing.CreatedAt
+	} else {
+		stored.ID, stored.CreatedAt = s.m.id("oauth_tokens"), stored.UpdatedAt
+	}
+	s.m.oauthTokens[key] = &stored
+	return nil
+}
+
+// Refresh holds the store's lock while refresh runs, which serializes
+// refreshes like the row lock of the Postgres store
+func (s memConnectionStore) Refresh(ctx context.Context, userID int, provider string, refresh func(token *models.OAuthToken) error) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	stored, ok := s.m.oauthTokens[connectionKey{userID, provider}]
+	if !ok {
+		return ErrNotFound
+	}
+	token := *stored
+	err := refresh(&token)
+	if token != *stored {
+		token.UpdatedAt = s.m.Now()
+		*stored = token
+	}
+	return err
+}
+
+type memCrosspostStore struct{ m *Memory }
+
+func (s memCrosspostStore) Jobs(ctx context.Context, postID int) ([]models.CrosspostJob, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	jobs := []models.CrosspostJob{}
+	for _, j := range s.m.crossposts {
+		if j.PostID == postID {
+			jobs = append(jobs, j)
+		}
+	}
+	return jobs, nil
+}
+
+func (s memCrosspostStore) Claim(ctx context.Context, lease time.Duration) (*models.CrosspostJob, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	now := s.m.Now()
+	claimed := -1
+	for i, j := range s.m.crossposts {
+		due := j.Status == models.CrosspostPending && !j.NextAttemptAt.After(now) ||
+			j.Status == models.CrosspostRunning && s.m.leases[j.ID].Before(now)
+		if due && (claimed < 0 || j.NextAttemptAt.Before(*s.m.crossposts[claimed].NextAttemptAt)) {
+			claimed = i
+		}
+	}
+	if claimed < 0 {
+		return nil, ErrNotFound
+	}
+
+	j := &s.m.crossposts[claimed]
+	j.Status = models.CrosspostRunning
+	j.Attempts++
+	j.UpdatedAt = now
+	s.m.leases[j.ID] = now.Add(lease)
+	job := *j
+	return &job, nil
+}
+
+// updateJob applies update to a job and releases its lease
+func (m *Memory) updateJob(id int, update func(j *models.CrosspostJob)) {
+	for i := range m.crossposts {
+		if j := &m.crossposts[i]; j.ID == id {
+			update(j)
+			j.UpdatedAt = m.Now()
+			delete(m.leases, id)
+		}
+	}
+}
+
+func (s memCrosspostStore) Succeed(ctx context.Context, id int, remoteID string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	s.m.updateJob(id, func(j *models.CrosspostJob) {
+		j.Status, j.RemoteID, j.LastError = models.CrosspostSucceeded, &remoteID, nil
+	})
+	return nil
+}
+
+func (s memCrosspostStore) Fail(ctx context.Context, id int, lastError string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	s.m.updateJob(id, func(j *models.CrosspostJob) {
+		j.Status, j.LastError = models.CrosspostFailed, &lastError
+	})
+	return nil
+}
+
+func (s memCrosspostStore) Retry(ctx context.Context, id int, lastError string, next time.Time) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	s.m.updateJob(id, func(j *models.CrosspostJob) {
+		j.Status, j.LastError, j.NextAttemptAt = models.CrosspostPending, &lastError, &next
+	})
+	return nil
+}
+
+type memAccountStore struct{ m *Memory }
+
+func (s memAccountStore) ScheduleDeletion(ctx context.Context, userID int, grace time.Duration) (time.Time, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	u, ok := s.m.users[userID]
+	if !ok {
+		return time.Time{}, ErrNotFound
+	}
+	if u.DeletionScheduledAt == nil {
+		at := s.m.Now().Add(grace)
+		u.DeletionScheduledAt = &at
+	}
+	return *u.DeletionScheduledAt, nil
+}
+
+func (s memAccountStore) CancelDeletion(ctx context.Context, userID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	u, ok := s.m.users[userID]
+	if !ok || u.DeletionScheduledAt == nil {
+		return ErrNotFound
+	}
+	u.DeletionScheduledAt = nil
+	return nil
+}
+
+func (s memAccountStore) DueForDeletion(ctx context.Context) ([]int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var userIDs []int
+	for id, u := range s.m.users {
+		if s.m.dueForDeletion(u) {
+			userIDs = append(userIDs, id)
+		}
+	}
+	sort.Ints(userIDs)
+	return userIDs, nil
+}
+
+func (m *Memory) dueForDeletion(u *models.User) bool {
+	return u.DeletionScheduledAt != nil && !u.DeletionScheduledAt.After(m.Now())
+}
+
+func (s memAccountStore) Delete(ctx context.Context, userID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	u, ok := s.m.users[userID]
+	if !ok || !s.m.dueForDeletion(u) {
+		return ErrNotFound
+	}
+
+	for id, p := range s.m.posts {
+		if p.UserID == userID {
+			s.m.deletePost(id)
+		}
+	}
+	delete(s.m.users, userID)
+	for key := range s.m.likes {
+		if key[0] == userID {
+			delete(s.m.likes, key)
+		}
+	}
+	for id, r := range s.m.replies {
+		if r.UserID == userID {
+			delete(s.m.replies, id)
+		}
+	}
+	for key := range s.m.follows {
+		if key[0] == userID || key[1] == userID {
+			delete(s.m.follows, key)
+		}
+	}
+	for id, n := range s.m.notifications {
+		if n.UserID == userID || n.ActorID == userID {
+			delete(s.m.notifications, id)
+		}
+	}
+	for key := range s.m.oauthTokens {
+		if key.userID == userID {
+			delete(s.m.oauthTokens, key)
+		}
+	}
+	for id, i := range s.m.identities {
+		if i.UserID == userID {
+			delete(s.m.identities, id)
+		}
+	}
+	for id, session := range s.m.sessions {
+		if session.UserID == userID {
+			delete(s.m.sessions, id)
+		}
+	}
+	for id, t := range s.m.tokens {
+		if t.UserID == userID {
+			delete(s.m.tokens, id)
+		}
+	}
+	for hash, id := range s.m.tokenHash {
+		if _, ok := s.m.tokens[id]; !ok {
+			delete(s.m.tokenHash, hash)
+		}
+	}
+	for id, up := range s.m.uploads {
+		if up.UserID == userID {
+			delete(s.m.uploads, id)
+		}
+	}
+	return nil
+}
+
+func (s memAccountStore) Export(ctx context.Context, userID int) ([]ExportFile, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	type record = map[string]interface{}
+	var profile, posts, replies, likes, following, followers, identities, connections []record
+
+	if u, ok := s.m.users[userID]; ok {
+		profile = append(profile, record{
+			"id": u.ID, "display_name": u.DisplayName, "profile_image": u.ProfileImage, "bio": u.Bio, "created_at": u.CreatedAt,
+		})
+	}
+	for _, i := range s.m.identities {
+		if i.UserID == userID {
+			identities = append(identities, record{
+				"provider": i.Provider, "provider_user_id": i.ProviderUserID, "created_at": i.CreatedAt,
+			})
+		}
+	}
+	for _, p := range s.m.posts {
+		if p.UserID == userID {
+			posts = append(posts, record{
+				"id": p.ID, "title": p.Title, "song_id": p.SongID, "song_type": p.SongType, "comment": p.Comment,
+				"tags": append([]string{}, p.Tags...), "created_at": p.CreatedAt,
+			})
+		}
+	}
+	for _, r := range s.m.replies {
+		if r.UserID == userID {
+			replies = append(replies, record{"id": r.ID, "post_id": r.PostID, "content": r.Content, "created_at": r.CreatedAt})
+		}
+	}
+	for key, at := range s.m.likes {
+		if key[0] == userID {
+			likes = append(likes, record{"post_id": key[1], "created_at": at})
+		}
+	}
+	for key, at := range s.m.follows {
+		if key[0] == userID {
+			following = append(following, record{"user_id": key[1], "created_at": at})
+		}
+		if key[1] == userID {
+			followers = append(followers, record{"user_id": key[0], "created_at": at})
+		}
+	}
+	for key, c := range s.m.oauthTokens {
+		if key.userID == userID {
+			connections = append(connections, record{"provider": c.Provider, "created_at": c.CreatedAt, "updated_at": c.UpdatedAt})
+		}
+	}
+
+	files := []ExportFile{
+		{"profile.json", profile},
+		{"posts.json", posts},
+		{"replies.json", replies},
+		{"likes.json", likes},
+		{"following.json", following},
+		{"followers.json", followers},
+		{"identities.json", identities},
+		{"connections.json", connections},
+	}
+	// Like the Postgres queries: oldest first, and empty rather than nil
+	for i, f := range files {
+		if f.Records == nil {
+			files[i].Records = []map[string]interface{}{}
+		}
+		sort.Slice(f.Records, func(a, b int) bool {
+			return f.Records[a]["created_at"].(time.Time).Before(f.Records[b]["created_at"].(time.Time))
+		})
+	}
+	return files, nil
+}
+
+// link inserts an identity for a user
+func (m *Memory) link(userID int, provider, providerUserID string) {
+	id := m.id("user_identities")
+	m.identities[id] = &models.Identity{
+		ID: id, UserID: userID, Provider: provider, ProviderUserID: providerUserID, CreatedAt: m.Now(),
+	}
+}
+
+// identity returns the identity of a provider account
+func (m *Memory) identity(provider, providerUserID string) (*models.Identity, bool) {
+	for _, i := range m.identities {
+		if i.Provider == provider && i.ProviderUserID == providerUserID {
+			return i, true
+		}
+	}
+	return nil, false
+}
+
+type memIdentityStore struct{ m *Memory }
+
+func (s memIdentityStore) List(ctx context.Context, userID int) ([]models.Identity, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	identities := []models.Identity{}
+	for _, i := range s.m.identities {
+		if i.UserID == userID {
+			identities = append(identities, *i)
+		}
+	}
+	sort.Slice(identities, func(a, b int) bool { return identities[a].ID < identities[b].ID })
+	return identities, nil
+}
+
+func (s memIdentityStore) Login(ctx context.Context, provider, providerUserID, profileImage string) (*models.User, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if i, ok := s.m.identity(provider, providerUserID); ok {
+		u, ok := s.m.users[i.UserID]
+		if !ok {
+			return nil, ErrNotFound
+		}
+		if profileImage != "" {
+			u.ProfileImage = profileImage
+		}
+		user := *u
+		return &user, nil
+	}
+
+	user := &models.User{
+		ID: s.m.id("users"), OAuthID: providerUserID, OAuthProvider: provider, ProfileImage: profileImage, CreatedAt: s.m.Now(),
+	}
+	s.m.users[user.ID] = user
+	s.m.link(user.ID, provider, providerUserID)
+	created := *user
+	return &created, nil
+}
+
+func (s memIdentityStore) Owner(ctx context.Context, provider, providerUserID string) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	i, ok := s.m.identity(provider, providerUserID)
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return i.UserID, nil
+}
+
+func (s memIdentityStore) Link(ctx context.Context, userID int, provider, providerUserID string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.identity(provider, providerUserID); ok {
+		return ErrDuplicate
+	}
+	s.m.link(userID, provider, providerUserID)
+	return nil
+}
+
+func (s memIdentityStore) Unlink(ctx context.Context, userID, id int) (*models.Identity, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	removed, ok := s.m.identities[id]
+	if !ok || removed.UserID != userID {
+		return nil, ErrNotFound
+	}
+	var oldest *models.Identity
+	providerLinked := false
+	for _, i := range s.m.identities {
+		if i.UserID != userID || i.ID == id {
+			continue
+		}
+		if oldest == nil || i.ID < oldest.ID {
+			oldest = i
+		}
+		providerLinked = providerLinked || i.Provider == removed.Provider
+	}
+	if oldest == nil {
+		return nil, ErrLastIdentity
+	}
+
+	delete(s.m.identities, id)
+	if !providerLinked {
+		delete(s.m.oauthTokens, connectionKey{userID, removed.Provider})
+	}
+
+	// Point the account's original identity at the oldest one still linked
+	if u, ok := s.m.users[userID]; ok && u.OAuthProvider == removed.Provider && u.OAuthID == removed.ProviderUserID {
+		u.OAuthProvider, u.OAuthID = oldest.Provider, oldest.ProviderUserID
+	}
+	identity := *removed
+	return &identity, nil
+}
+
+func (s memIdentityStore) Merge(ctx context.Context, sourceID, targetID int) ([]models.Upload, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	source, ok := s.m.users[sourceID]
+	target, ok2 := s.m.users[targetID]
+	if !ok || !ok2 {
+		return nil, ErrNotFound
+	}
+
+	// Point links to a file both users uploaded at the target's copy
+	var dropped []models.Upload
+	for id, up := range s.m.uploads {
+		if up.UserID != sourceID {
+			continue
+		}
+		for _, other := range s.m.uploads {
+			if other.UserID != targetID || other.SHA256 != up.SHA256 {
+				continue
+			}
+			from, to := "/"+up.KeyPrefix+"_", "/"+other.KeyPrefix+"_"
+			for _, p := range s.m.posts {
+				p.Comment = strings.ReplaceAll(p.Comment, from, to)
+			}
+			for _, u := range s.m.users {
+				u.ProfileImage = strings.ReplaceAll(u.ProfileImage, from, to)
+			}
+			dropped = append(dropped, *s.m.upload(up))
+			delete(s.m.uploads, id)
+			break
+		}
+	}
+	if target.DisplayName == "" {
+		target.DisplayName = source.DisplayName
+	}
+	if target.ProfileImage == "" {
+		target.ProfileImage = source.ProfileImage
+	}
+	if target.Bio == "" {
+		target.Bio = source.Bio
+	}
+
+	for _, p := range s.m.posts {
+		if p.UserID == sourceID {
+			p.UserID = targetID
+		}
+	}
+	for _, r := range s.m.replies {
+		if r.UserID == sourceID {
+			r.UserID = targetID
+		}
+	}
+	for key, at := range s.m.likes {
+		if key[0] != sourceID {
+			continue
+		}
+		if _, ok := s.m.likes[[2]int{targetID, key[1]}]; !ok {
+			s.m.likes[[2]int{targetID, key[1]}] = at
+		}
+		delete(s.m.likes, key)
+	}
+	for key, at := range s.m.follows {
+		moved := key
+		if key[0] == sourceID {
+			moved[0] = targetID
+		}
+		if key[1] == sourceID {
+			moved[1] = targetID
+		}
+		if moved == key {
+			continue
+		}
+		delete(s.m.follows, key)
+		if _, ok := s.m.follows[moved]; !ok && moved[0] != moved[1] {
+			s.m.follows[moved] = at
+		}
+	}
+	for id, n := range s.m.notifications {
+		if n.UserID == sourceID {
+			n.UserID = targetID
+		}
+		if n.ActorID == sourceID {
+			n.ActorID = targetID
+		}
+		if n.UserID == targetID && n.ActorID == targetID {
+			delete(s.m.notifications, id)
+		}
+	}
+	for i := range s.m.crossposts {
+		if s.m.crossposts[i].UserID == sourceID {
+			s.m.crossposts[i].UserID = targetID
+		}
+	}
+	for _, up := range s.m.uploads {
+		if up.UserID == sourceID {
+			up.UserID = targetID
+		}
+	}
+	for key, t := range s.m.oauthTokens {
+		if key.userID != sourceID {
+			continue
+		}
+		delete(s.m.oauthTokens, key)
+		if _, ok := s.m.oauthTokens[connectionKey{targetID, key.provider}]; !ok {
+			t.UserID = targetID
+			s.m.oauthTokens[connectionKey{targetID, key.provider}] = t
+		}
+	}
+	for _, i := range s.m.identities {
+		if i.UserID == sourceID {
+			i.UserID = targetID
+		}
+	}
+
+	// Like ON DELETE CASCADE
+	for id, session := range s.m.sessions {
+		if session.UserID == sourceID {
+			delete(s.m.sessions, id)
+		}
+	}
+	for id, t := range s.m.tokens {
+		if t.UserID == sourceID {
+			delete(s.m.tokens, id)
+		}
+	}
+	delete(s.m.users, sourceID)
+	return dropped, nil
+}
+
+type memSessionStore struct{ m *Memory }
+
+// session returns the session with a token hash
+func (m *Memory) session(tokenHash string) (*models.Session, bool) {
+	for _, s := range m.sessions {
+		if s.TokenHash == tokenHash {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+func (s memSessionStore) Create(ctx context.Context, session *models.Session) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.session(session.TokenHash); ok {
+		return ErrDuplicate
+	}
+	session.ID = s.m.id("sessions")
+	session.CreatedAt = s.m.Now()
+	session.LastSeenAt = session.CreatedAt
+	stored := *session
+	stored.Data = append([]byte(nil), session.Data...)
+	s.m.sessions[session.ID] = &stored
+	return nil
+}
+
+func (s memSessionStore) Get(ctx context.Context, tokenHash string) (*models.Session, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	stored, ok := s.m.session(tokenHash)
+	if !ok || !stored.ExpiresAt.After(s.m.Now()) {
+		return nil, ErrNotFound
+	}
+	session := *stored
+	session.Data = append([]byte(nil), stored.Data...)
+	return &session, nil
+}
+
+func (s memSessionStore) Update(ctx context.Context, session *models.Session) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if stored, ok := s.m.session(session.TokenHash); ok {
+		stored.UserID = session.UserID
+		stored.Provider = session.Provider
+		stored.Data = append([]byte(nil), session.Data...)
+		stored.ExpiresAt = session.ExpiresAt
+		stored.LastSeenAt = s.m.Now()
+	}
+	return nil
+}
+
+func (s memSessionStore) Touch(ctx context.Context, tokenHash, ip string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if stored, ok := s.m.session(tokenHash); ok {
+		stored.LastSeenAt = s.m.Now()
+		stored.IP = ip
+	}
+	return nil
+}
+
+func (s memSessionStore) Delete(ctx context.Context, tokenHash string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if stored, ok := s.m.session(tokenHash); ok {
+		delete(s.m.sessions, stored.ID)
+	}
+	return nil
+}
+
+func (s memSessionStore) List(ctx context.Context, userID int) ([]models.Session, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	now := s.m.Now()
+	sessions := []models.Session{}
+	for _, session := range s.m.sessions {
+		if session.UserID == userID && session.ExpiresAt.After(now) {
+			sessions = append(sessions, *session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt) })
+	return sessions, nil
+}
+
+func (s memSessionStore) Revoke(ctx context.Context, userID, id int) (string, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	session, ok := s.m.sessions[id]
+	if !ok || session.UserID != userID {
+		return "", ErrNotFound
+	}
+	delete(s.m.sessions, id)
+	return session.TokenHash, nil
+}
+
+func (s memSessionStore) RevokeAll(ctx context.Context, userID int, keepHash, provider string) (int64, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var revoked int64
+	for id, session := range s.m.sessions {
+		if session.UserID == userID && session.TokenHash != keepHash && (provider == "" || session.Provider == provider) {
+			delete(s.m.sessions, id)
+			revoked++
+		}
+	}
+	return revoked, nil
+}
+
+func (s memSessionStore) DeleteExpired(ctx context.Context) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	now := s.m.Now()
+	for id, session := range s.m.sessions {
+		if !session.ExpiresAt.After(now) {
+			delete(s.m.sessions, id)
+		}
+	}
+	return nil
+}
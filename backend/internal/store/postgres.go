@@ -0,0 +1,1425 @@
+package store
+
+import (
+	"backend/internal/database"
+	"backend/internal/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// NewPostgres returns stores backed by db
+func NewPostgres(db *sql.DB) *Stores {
+	return &Stores{
+		Posts:   &pgPostStore{db: db},
+		Users:   &pgUserStore{db: db},
+		Likes:   &pgLikeStore{db: db},
+		Replies: &pgReplyStore{db: db},
+		Tokens:  &pgTokenStore{db: db},
+		Uploads: &pgUploadStore{db: db},
+
+		Follows:       &pgFollowStore{db: db},
+		Notifications: &pgNotificationStore{db: db},
+		Connections:   &pgConnectionStore{db: db},
+		Crossposts:    &pgCrosspostStore{db: db},
+		Accounts:      &pgAccountStore{db: db},
+		Identities:    &pgIdentityStore{db: db},
+		Sessions:      &pgSessionStore{db: db},
+	}
+}
+
+// ScanPostRows extracts post data selected with database.PostSelectFields
+// from SQL rows
+func ScanPostRows(rows *sql.Rows) []models.Post {
+	return scanPostRows(rows, false)
+}
+
+// scanPostRows is ScanPostRows for rows that may be followed by the rank
+// selected by database.BuildPostSearchQuery
+func scanPostRows(rows *sql.Rows, ranked bool) []models.Post {
+	var posts []models.Post
+	for rows.Next() {
+		var p models.Post
+		var u models.User
+
+		dest := []interface{}{&p.ID, &p.UserID, &p.Title, &p.SongID, &p.SongType, &p.Comment, &p.Tags, &p.CreatedAt,
+			&u.ID, &u.DisplayName, &u.ProfileImage, &u.Bio,
+			&p.LikeCount, &p.ReplyCount, &p.LikedByCurrentUser}
+		if ranked {
+			dest = append(dest, &p.Rank)
+		}
+		err := rows.Scan(dest...)
+		if err != nil {
+			log.Println("Error scanning row:", err)
+			continue
+		}
+		p.User = &u
+		posts = append(posts, p)
+	}
+	return posts
+}
+
+// ScanUserRows extracts user data selected with database.UserSelectFields
+// from SQL rows. When withFollowedAt is set, each row must end with the
+// follow timestamp.
+func ScanUserRows(rows *sql.Rows, withFollowedAt bool) []models.User {
+	var users []models.User
+	for rows.Next() {
+		var u models.User
+		dest := []interface{}{&u.ID, &u.DisplayName, &u.ProfileImage, &u.Bio, &u.CreatedAt,
+			&u.FollowerCount, &u.FollowingCount, &u.FollowedByCurrentUser}
+		if withFollowedAt {
+			dest = append(dest, &u.FollowedAt)
+		}
+
+		if err := rows.Scan(dest...); err != nil {
+			log.Println("Error scanning row:", err)
+			continue
+		}
+		users = append(users, u)
+	}
+	return users
+}
+
+type pgPostStore struct {
+	db *sql.DB
+}
+
+func (s *pgPostStore) List(ctx context.Context, viewerID int, filter PostFilter, page database.PageRequest) ([]models.Post, error) {
+	var conditions []string
+	args := []interface{}{viewerID}
+	bind := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if filter.UserID != 0 {
+		conditions = append(conditions, "p.user_id = "+bind(filter.UserID))
+	}
+	if filter.FollowedBy != 0 {
+		conditions = append(conditions, "p.user_id IN (SELECT followee_id FROM follows WHERE follower_id = "+bind(filter.FollowedBy)+")")
+	}
+	if filter.Search == nil {
+		query, args := database.BuildPostPageQuery(strings.Join(conditions, " AND "), args, page)
+		rows, err := s.db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		return ScanPostRows(rows), nil
+	}
+
+	conditions = append(conditions, filter.Search.Where(bind))
+	rank := postRank(bind(filter.Search.Text()), filter.BoostRecent)
+	query, args := database.BuildPostSearchQuery(rank, strings.Join(conditions, " AND "), args, page)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanPostRows(rows, true), nil
+}
+
+// postRank scores a post against the search text bound at q. Full-text
+// matches weigh title over tags over comment; trigram word similarity lets
+// substrings of unspaced Japanese text, which the tsvector keeps as one
+// word, score too.
+func postRank(q string, boostRecent bool) string {
+	rank := "ts_rank_cd('{0.1, 0.2, 0.4, 1.0}', p.search_vector, plainto_tsquery('simple', " + q + "))" +
+		" + word_similarity(" + q + ", p.search_text)"
+	if boostRecent {
+		rank += " + extract(epoch FROM p.created_at) / 86400 * " + strconv.FormatFloat(RecencyBoost, 'f', -1, 64)
+	}
+	return rank
+}
+
+func (s *pgPostStore) Get(ctx context.Context, viewerID, id int) (*models.Post, error) {
+	rows, err := s.db.QueryContext(ctx, database.BuildPostQuery("p.id = $2"), viewerID, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := ScanPostRows(rows)
+	if len(posts) == 0 {
+		return nil, ErrNotFound
+	}
+	return &posts[0], nil
+}
+
+func (s *pgPostStore) Create(ctx context.Context, post *models.Post, crossposts ...Crosspost) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO posts (user_id, title, song_id, song_type, comment, tags)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`, post.UserID, post.Title, post.SongID, post.SongType, post.Comment, post.Tags).Scan(&post.ID, &post.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range crossposts {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO crosspost_jobs (post_id, user_id, provider, text)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (post_id, provider) DO NOTHING
+		`, post.ID, post.UserID, c.Provider, c.Text(post.ID))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *pgPostStore) Update(ctx context.Context, id int, update PostUpdate) error {
+	var tags pq.StringArray
+	if update.Tags != nil {
+		tags = pq.StringArray(*update.Tags)
+		if tags == nil {
+			tags = pq.StringArray{}
+		}
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE posts SET
+			title = COALESCE($1, title),
+			song_id = COALESCE($2, song_id),
+			song_type = COALESCE($3, song_type),
+			comment = COALESCE($4, comment),
+			tags = COALESCE($5, tags)
+		WHERE id = $6
+	`, update.Title, update.SongID, update.SongType, update.Comment, tags, id)
+	return err
+}
+
+func (s *pgPostStore) Delete(ctx context.Context, id int) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM posts WHERE id = $1", id)
+	return err
+}
+
+func (s *pgPostStore) OwnerID(ctx context.Context, id int) (int, error) {
+	var ownerID sql.NullInt64
+	err := s.db.QueryRowContext(ctx, "SELECT user_id FROM posts WHERE id = $1", id).Scan(&ownerID)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int(ownerID.Int64), nil
+}
+
+type pgUserStore struct {
+	db *sql.DB
+}
+
+// userKeyset orders users newest first
+var userKeyset = database.Keyset{CreatedAt: "u.created_at", ID: "u.id"}
+
+func (s *pgUserStore) Get(ctx context.Context, id int) (*models.User, error) {
+	var user models.User
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, oauth_id, oauth_provider, display_name, profile_image, bio, created_at, deletion_scheduled_at
+		FROM users WHERE id = $1
+	`, id).Scan(&user.ID, &user.OAuthID, &user.OAuthProvider, &user.DisplayName, &user.ProfileImage, &user.Bio, &user.CreatedAt, &user.DeletionScheduledAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *pgUserStore) UpdateProfile(ctx context.Context, id int, displayName, profileImage, bio string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE users SET display_name = $1, profile_image = $2, bio = $3
+		WHERE id = $4
+	`, displayName, profileImage, bio, id)
+	return err
+}
+
+func (s *pgUserStore) Search(ctx context.Context, viewerID int, query string, page database.PageRequest) ([]models.User, error) {
+	whereClause := ""
+	args := []interface{}{viewerID}
+	if query != "" {
+		whereClause = "u.display_name ILIKE '%' || $2 || '%'"
+		args = append(args, query)
+	}
+
+	sqlQuery, args := userKeyset.Build("SELECT "+database.UserSelectFields+" FROM users u", whereClause, args, page)
+	rows, err := s.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return ScanUserRows(rows, false), nil
+}
+
+func (s *pgUserStore) List(ctx context.Context, limit int) ([]models.User, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, oauth_id, oauth_provider, display_name, profile_image, bio, created_at
+		FROM users
+		ORDER BY id
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var u models.User
+		if err := rows.Scan(&u.ID, &u.OAuthID, &u.OAuthProvider, &u.DisplayName, &u.ProfileImage, &u.Bio, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+type pgLikeStore struct {
+	db *sql.DB
+}
+
+func (s *pgLikeStore) Liked(ctx context.Context, userID, postID int) (bool, error) {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM likes WHERE user_id = $1 AND post_id = $2)", userID, postID).Scan(&exists)
+	return exists, err
+}
+
+func (s *pgLikeStore) Like(ctx context.Context, userID, postID int) error {
+	_, err := s.db.ExecContext(ctx, "INSERT INTO likes (user_id, post_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", userID, postID)
+	return err
+}
+
+func (s *pgLikeStore) Unlike(ctx context.Context, userID, postID int) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM likes WHERE user_id = $1 AND post_id = $2", userID, postID)
+	return err
+}
+
+func (s *pgLikeStore) Count(ctx context.Context, postID int) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM likes WHERE post_id = $1", postID).Scan(&count)
+	return count, err
+}
+
+type pgReplyStore struct {
+	db *sql.DB
+}
+
+// replyKeyset orders replies oldest first
+var replyKeyset = database.Keyset{CreatedAt: "r.created_at", ID: "r.id", Ascending: true}
+
+func (s *pgReplyStore) Create(ctx context.Context, reply *models.Reply) error {
+	return s.db.QueryRowContext(ctx, `
+		INSERT INTO replies (user_id, post_id, content)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`, reply.UserID, reply.PostID, reply.Content).Scan(&reply.ID, &reply.CreatedAt)
+}
+
+func (s *pgReplyStore) List(ctx context.Context, postID int, page database.PageRequest) ([]models.Reply, error) {
+	query, args := replyKeyset.Build(`
+		SELECT r.id, r.user_id, r.post_id, r.content, r.created_at,
+		       u.id, u.display_name, u.profile_image
+		FROM replies r
+		JOIN users u ON r.user_id = u.id
+	`, "r.post_id = $1", []interface{}{postID}, page)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var replies []models.Reply
+	for rows.Next() {
+		var r models.Reply
+		var u models.User
+		if err := rows.Scan(&r.ID, &r.UserID, &r.PostID, &r.Content, &r.CreatedAt, &u.ID, &u.DisplayName, &u.ProfileImage); err != nil {
+			continue
+		}
+		r.User = &u
+		replies = append(replies, r)
+	}
+	return replies, nil
+}
+
+type pgTokenStore struct {
+	db *sql.DB
+}
+
+func (s *pgTokenStore) Create(ctx context.Context, token *models.AccessToken, hash string) error {
+	return s.db.QueryRowContext(ctx, `
+		INSERT INTO personal_access_tokens (user_id, name, token_hash, token_prefix, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`, token.UserID, token.Name, hash, token.Prefix, token.Scopes, token.ExpiresAt).Scan(&token.ID, &token.CreatedAt)
+}
+
+func (s *pgTokenStore) List(ctx context.Context, userID int) ([]models.AccessToken, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, user_id, name, token_prefix, scopes, expires_at, last_used_at, created_at
+		FROM personal_access_tokens
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []models.AccessToken{}
+	for rows.Next() {
+		var t models.AccessToken
+		if err := rows.Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &t.Scopes, &t.ExpiresAt, &t.LastUsedAt, &t.CreatedAt); err != nil {
+			log.Println("Error scanning row:", err)
+			continue
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
+
+func (s *pgTokenStore) Revoke(ctx context.Context, userID, id int) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM personal_access_tokens WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return err
+	}
+	if removed, _ := result.RowsAffected(); removed == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *pgTokenStore) Lookup(ctx context.Context, hash string) (*models.AccessToken, error) {
+	var t models.AccessToken
+	err := s.db.QueryRowContext(ctx, `
+		SELECT t.id, t.user_id, t.name, t.token_prefix, t.scopes, t.expires_at, t.last_used_at, t.created_at
+		FROM personal_access_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = $1 AND t.expires_at > CURRENT_TIMESTAMP AND u.deletion_scheduled_at IS NULL
+	`, hash).Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &t.Scopes, &t.ExpiresAt, &t.LastUsedAt, &t.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (s *pgTokenStore) Touch(ctx context.Context, id int, at time.Time) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE personal_access_tokens SET last_used_at = $1 WHERE id = $2", at, id)
+	return err
+}
+
+type pgUploadStore struct {
+	db *sql.DB
+}
+
+const uploadColumns = "id, user_id, sha256, key_prefix, variants, size, created_at, last_referenced_at"
+
+func scanUpload(row interface{ Scan(...interface{}) error }) (*models.Upload, error) {
+	var u models.Upload
+	var variants []byte
+	if err := row.Scan(&u.ID, &u.UserID, &u.SHA256, &u.KeyPrefix, &variants, &u.Size, &u.CreatedAt, &u.LastReferencedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(variants, &u.Variants); err != nil {
+		return nil, fmt.Errorf("upload %d variants: %w", u.ID, err)
+	}
+	return &u, nil
+}
+
+func (s *pgUploadStore) Reuse(ctx context.Context, userID int, sha256 string) (*models.Upload, error) {
+	u, err := scanUpload(s.db.QueryRowContext(ctx, `
+		UPDATE uploads SET last_referenced_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND sha256 = $2
+		RETURNING `+uploadColumns, userID, sha256))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return u, err
+}
+
+func (s *pgUploadStore) Usage(ctx context.Context, userID int) (int64, error) {
+	var usage int64
+	err := s.db.QueryRowContext(ctx, "SELECT COALESCE(SUM(size), 0) FROM uploads WHERE user_id = $1", userID).Scan(&usage)
+	return usage, err
+}
+
+func (s *pgUploadStore) List(ctx context.Context, userID int) ([]models.Upload, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+uploadColumns+" FROM uploads WHERE user_id = $1 ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var uploads []models.Upload
+	for rows.Next() {
+		u, err := scanUpload(rows)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, *u)
+	}
+	return uploads, rows.Err()
+}
+
+func (s *pgUploadStore) Create(ctx context.Context, upload *models.Upload, quota int64) error {
+	variants, err := json.Marshal(upload.Variants)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the owner so concurrent uploads cannot both pass the quota check
+	var userID int
+	err = tx.QueryRowContext(ctx, "SELECT id FROM users WHERE id = $1 FOR UPDATE", upload.UserID).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	var usage int64
+	if err := tx.QueryRowContext(ctx, "SELECT COALESCE(SUM(size), 0) FROM uploads WHERE user_id = $1", userID).Scan(&usage); err != nil {
+		return err
+	}
+	if usage+upload.Size > quota {
+		return ErrQuotaExceeded
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO uploads (user_id, sha256, key_prefix, variants, size)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, sha256) DO NOTHING
+		RETURNING id, created_at, last_referenced_at
+	`, upload.UserID, upload.SHA256, upload.KeyPrefix, string(variants), upload.Size).Scan(&upload.ID, &upload.CreatedAt, &upload.LastReferencedAt)
+	if err == sql.ErrNoRows {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// uploadReferenced matches uploads whose URL appears in a profile image or
+// post comment. Every variant key starts with the key prefix and an
+// underscore, and follows a "/" in its URL whether it is served under
+// /uploads/ or from S3_PUBLIC_URL.
+const uploadReferenced = `(
+	EXISTS (SELECT 1 FROM users u WHERE strpos(u.profile_image, '/' || up.key_prefix || '_') > 0)
+	OR EXISTS (SELECT 1 FROM posts p WHERE strpos(p.comment, '/' || up.key_prefix || '_') > 0)
+)`
+
+func (s *pgUploadStore) Sweep(ctx context.Context, grace time.Duration) ([]models.Upload, error) {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE uploads up SET last_referenced_at = CURRENT_TIMESTAMP
+		WHERE `+uploadReferenced)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the references again in case one was added since the update
+	rows, err := s.db.QueryContext(ctx, `
+		DELETE FROM uploads up
+		WHERE last_referenced_at < CURRENT_TIMESTAMP - make_interval(secs => $1)
+		  AND NOT `+uploadReferenced+`
+		RETURNING `+uploadColumns, grace.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deleted []models.Upload
+	for rows.Next() {
+		u, err := scanUpload(rows)
+		if err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, *u)
+	}
+	return deleted, rows.Err()
+}
+
+type pgFollowStore struct {
+	db *sql.DB
+}
+
+// followKeyset orders follower and following lists by follow time, newest first
+var followKeyset = database.Keyset{CreatedAt: "f.created_at", ID: "u.id"}
+
+func (s *pgFollowStore) Follow(ctx context.Context, followerID, followeeID int) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO follows (follower_id, followee_id)
+		VALUES ($1, $2)
+		ON CONFLICT (follower_id, followee_id) DO NOTHING
+	`, followerID, followeeID)
+	if err != nil {
+		return false, err
+	}
+	inserted, err := result.RowsAffected()
+	return inserted > 0, err
+}
+
+func (s *pgFollowStore) Unfollow(ctx context.Context, followerID, followeeID int) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM follows WHERE follower_id = $1 AND followee_id = $2", followerID, followeeID)
+	return err
+}
+
+func (s *pgFollowStore) Followers(ctx context.Context, viewerID, userID int, page database.PageRequest) ([]models.User, error) {
+	return s.list(ctx, "f.follower_id = u.id", "f.followee_id = $2", viewerID, userID, page)
+}
+
+func (s *pgFollowStore) Following(ctx context.Context, viewerID, userID int, page database.PageRequest) ([]models.User, error) {
+	return s.list(ctx, "f.followee_id = u.id", "f.follower_id = $2", viewerID, userID, page)
+}
+
+func (s *pgFollowStore) list(ctx context.Context, joinCondition, whereClause string, viewerID, userID int, page database.PageRequest) ([]models.User, error) {
+	query, args := followKeyset.Build(
+		"SELECT "+database.UserSelectFields+", f.created_at FROM follows f JOIN users u ON "+joinCondition,
+		whereClause, []interface{}{viewerID, userID}, page)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return ScanUserRows(rows, true), nil
+}
+
+type pgNotificationStore struct {
+	db *sql.DB
+}
+
+// notificationKeyset orders notifications newest first
+var notificationKeyset = database.Keyset{CreatedAt: "n.created_at", ID: "n.id"}
+
+func (s *pgNotificationStore) Create(ctx context.Context, n *models.Notification) (bool, error) {
+	var err error
+	if n.PostID != nil {
+		err = s.db.QueryRowContext(ctx, `
+			INSERT INTO notifications (user_id, actor_id, verb, post_id, reply_id)
+			SELECT p.user_id, $1, $2, p.id, $4::integer
+			FROM posts p
+			WHERE p.id = $3 AND p.user_id IS NOT NULL AND p.user_id <> $1
+			RETURNING id, user_id, created_at
+		`, n.ActorID, n.Verb, *n.PostID, n.ReplyID).Scan(&n.ID, &n.UserID, &n.CreatedAt)
+	} else {
+		err = s.db.QueryRowContext(ctx, `
+			INSERT INTO notifications (user_id, actor_id, verb)
+			VALUES ($1, $2, $3)
+			RETURNING id, created_at
+		`, n.UserID, n.ActorID, n.Verb).Scan(&n.ID, &n.CreatedAt)
+	}
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *pgNotificationStore) DeleteForPost(ctx context.Context, actorID, postID int, verb string) error {
+	_, err := s.db.ExecContext(ctx, `
+		DELETE FROM notifications
+		WHERE actor_id = $1 AND post_id = $2 AND verb = $3
+	`, actorID, postID, verb)
+	return err
+}
+
+func (s *pgNotificationStore) DeleteForUser(ctx context.Context, actorID, userID int, verb string) error {
+	_, err := s.db.ExecContext(ctx, `
+		DELETE FROM notifications
+		WHERE actor_id = $1 AND user_id = $2 AND verb = $3
+	`, actorID, userID, verb)
+	return err
+}
+
+func (s *pgNotificationStore) List(ctx context.Context, userID int, unreadOnly bool, page database.PageRequest) ([]models.Notification, error) {
+	whereClause := "n.user_id = $1"
+	if unreadOnly {
+		whereClause += " AND n.read_at IS NULL"
+	}
+
+	query, args := notificationKeyset.Build(`
+		SELECT n.id, n.user_id, n.actor_id, n.verb, n.post_id, n.reply_id, n.read_at, n.created_at,
+		       u.id, u.display_name, u.profile_image
+		FROM notifications n
+		JOIN users u ON n.actor_id = u.id
+	`, whereClause, []interface{}{userID}, page)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []models.Notification
+	for rows.Next() {
+		var n models.Notification
+		var u models.User
+		if err := rows.Scan(&n.ID, &n.UserID, &n.ActorID, &n.Verb, &n.PostID, &n.ReplyID, &n.ReadAt, &n.CreatedAt,
+			&u.ID, &u.DisplayName, &u.ProfileImage); err != nil {
+			log.Println("Error scanning row:", err)
+			continue
+		}
+		n.Read = n.ReadAt != nil
+		n.Actor = &u
+		notifications = append(notifications, n)
+	}
+	return notifications, nil
+}
+
+func (s *pgNotificationStore) UnreadCount(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL", userID).Scan(&count)
+	return count, err
+}
+
+func (s *pgNotificationStore) MarkRead(ctx context.Context, userID int, ids []int64) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE notifications SET read_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND id = ANY($2) AND read_at IS NULL
+	`, userID, pq.Int64Array(ids))
+	return err
+}
+
+func (s *pgNotificationStore) MarkAllRead(ctx context.Context, userID int) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE notifications SET read_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND read_at IS NULL
+	`, userID)
+	return err
+}
+
+type pgConnectionStore struct {
+	db *sql.DB
+}
+
+func (s *pgConnectionStore) Get(ctx context.Context, userID int, provider string) (*models.Connection, error) {
+	c := models.Connection{UserID: userID, Provider: provider}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT needs_reauth, created_at, updated_at
+		FROM oauth_tokens
+		WHERE user_id = $1 AND provider = $2
+	`, userID, provider).Scan(&c.NeedsReauth, &c.CreatedAt, &c.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (s *pgConnectionStore) Delete(ctx context.Context, userID int, provider string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM oauth_tokens WHERE user_id = $1 AND provider = $2", userID, provider)
+	return err
+}
+
+func (s *pgConnectionStore) Save(ctx context.Context, token *models.OAuthToken) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO oauth_tokens (user_id, provider, access_token, refresh_token, expires_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)
+		ON CONFLICT (user_id, provider)
+		DO UPDATE SET
+			access_token = EXCLUDED.access_token,
+			refresh_token = EXCLUDED.refresh_token,
+			expires_at = EXCLUDED.expires_at,
+			needs_reauth = FALSE,
+			updated_at = CURRENT_TIMESTAMP
+	`, token.UserID, token.Provider, token.AccessToken, token.RefreshToken, token.ExpiresAt)
+	return err
+}
+
+func (s *pgConnectionStore) Refresh(ctx context.Context, userID int, provider string, refresh func(token *models.OAuthToken) error) error {
+	// The row lock serializes refreshes across goroutines and replicas
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	token := models.OAuthToken{UserID: userID, Provider: provider}
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, access_token, COALESCE(refresh_token, ''), expires_at, needs_reauth, created_at, updated_at
+		FROM oauth_tokens
+		WHERE user_id = $1 AND provider = $2
+		FOR UPDATE
+	`, userID, provider).Scan(&token.ID, &token.AccessToken, &token.RefreshToken, &token.ExpiresAt, &token.NeedsReauth,
+		&token.CreatedAt, &token.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	stored := token
+	refreshErr := refresh(&token)
+	if token == stored {
+		return refreshErr
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE oauth_tokens
+		SET access_token = $1, refresh_token = $2, expires_at = $3, needs_reauth = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $5
+	`, token.AccessToken, token.RefreshToken, token.ExpiresAt, token.NeedsReauth, token.ID)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return refreshErr
+}
+
+type pgCrosspostStore struct {
+	db *sql.DB
+}
+
+func (s *pgCrosspostStore) Jobs(ctx context.Context, postID int) ([]models.CrosspostJob, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, post_id, user_id, provider, status, attempts, next_attempt_at, last_error, remote_id, created_at, updated_at
+		FROM crosspost_jobs
+		WHERE post_id = $1
+		ORDER BY id
+	`, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []models.CrosspostJob{}
+	for rows.Next() {
+		var j models.CrosspostJob
+		if err := rows.Scan(&j.ID, &j.PostID, &j.UserID, &j.Provider, &j.Status, &j.Attempts, &j.NextAttemptAt,
+			&j.LastError, &j.RemoteID, &j.CreatedAt, &j.UpdatedAt); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// Claim uses SKIP LOCKED so several workers and replicas can poll the table
+// without blocking on each other
+func (s *pgCrosspostStore) Claim(ctx context.Context, lease time.Duration) (*models.CrosspostJob, error) {
+	job := &models.CrosspostJob{Status: models.CrosspostRunning}
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE crosspost_jobs SET
+			status = $1,
+			attempts = attempts + 1,
+			locked_until = CURRENT_TIMESTAMP + $2 * INTERVAL '1 second',
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id FROM crosspost_jobs
+			WHERE (status = $3 AND next_attempt_at <= CURRENT_TIMESTAMP)
+			   OR (status = $1 AND locked_until < CURRENT_TIMESTAMP)
+			ORDER BY next_attempt_at
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING id, post_id, user_id, provider, text, attempts
+	`, models.CrosspostRunning, int(lease.Seconds()), models.CrosspostPending).Scan(&job.ID, &job.PostID, &job.UserID, &job.Provider, &job.Text, &job.Attempts)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (s *pgCrosspostStore) Succeed(ctx context.Context, id int, remoteID string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE crosspost_jobs
+		SET status = $1, remote_id = $2, last_error = NULL, locked_until = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3
+	`, models.CrosspostSucceeded, remoteID, id)
+	return err
+}
+
+func (s *pgCrosspostStore) Fail(ctx context.Context, id int, lastError string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE crosspost_jobs
+		SET status = $1, last_error = $2, locked_until = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3
+	`, models.CrosspostFailed, lastError, id)
+	return err
+}
+
+func (s *pgCrosspostStore) Retry(ctx context.Context, id int, lastError string, next time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE crosspost_jobs
+		SET status = $1, last_error = $2, next_attempt_at = $3, locked_until = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4
+	`, models.CrosspostPending, lastError, next, id)
+	return err
+}
+
+type pgAccountStore struct {
+	db *sql.DB
+}
+
+func (s *pgAccountStore) ScheduleDeletion(ctx context.Context, userID int, grace time.Duration) (time.Time, error) {
+	var scheduledAt time.Time
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE users SET deletion_scheduled_at = COALESCE(deletion_scheduled_at, CURRENT_TIMESTAMP + make_interval(secs => $2))
+		WHERE id = $1
+		RETURNING deletion_scheduled_at
+	`, userID, grace.Seconds()).Scan(&scheduledAt)
+	if err == sql.ErrNoRows {
+		return scheduledAt, ErrNotFound
+	}
+	return scheduledAt, err
+}
+
+func (s *pgAccountStore) CancelDeletion(ctx context.Context, userID int) error {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE users SET deletion_scheduled_at = NULL
+		WHERE id = $1 AND deletion_scheduled_at IS NOT NULL
+	`, userID)
+	if err != nil {
+		return err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *pgAccountStore) DueForDeletion(ctx context.Context) ([]int, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id FROM users WHERE deletion_scheduled_at <= CURRENT_TIMESTAMP ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, id)
+	}
+	return userIDs, rows.Err()
+}
+
+// Delete removes the user's posts; likes, replies, follows, notifications,
+// identities, OAuth tokens and sessions go with the user row through ON
+// DELETE CASCADE.
+func (s *pgAccountStore) Delete(ctx context.Context, userID int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"posts", "uploads"} {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE user_id = $1", userID); err != nil {
+			return err
+		}
+	}
+	// The deletion may have been cancelled since the user was found due
+	result, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id = $1 AND deletion_scheduled_at <= CURRENT_TIMESTAMP", userID)
+	if err != nil {
+		return err
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return ErrNotFound
+	}
+	return tx.Commit()
+}
+
+// accountExports lists the files of an account export and the query, taking
+// the user ID as $1, that reads each
+var accountExports = []struct {
+	name  string
+	query string
+}{
+	{"profile.json", `
+		SELECT id, display_name, profile_image, bio, created_at
+		FROM users WHERE id = $1`},
+	{"posts.json", `
+		SELECT id, title, song_id, song_type, comment, tags, created_at
+		FROM posts WHERE user_id = $1 ORDER BY created_at`},
+	{"replies.json", `
+		SELECT id, post_id, content, created_at
+		FROM replies WHERE user_id = $1 ORDER BY created_at`},
+	{"likes.json", `
+		SELECT post_id, created_at
+		FROM likes WHERE user_id = $1 ORDER BY created_at`},
+	{"following.json", `
+		SELECT followee_id AS user_id, created_at
+		FROM follows WHERE follower_id = $1 ORDER BY created_at`},
+	{"followers.json", `
+		SELECT follower_id AS user_id, created_at
+		FROM follows WHERE followee_id = $1 ORDER BY created_at`},
+	{"identities.json", `
+		SELECT provider, provider_user_id, created_at
+		FROM user_identities WHERE user_id = $1 ORDER BY created_at`},
+	{"connections.json", `
+		SELECT provider, created_at, updated_at
+		FROM oauth_tokens WHERE user_id = $1 ORDER BY created_at`},
+}
+
+func (s *pgAccountStore) Export(ctx context.Context, userID int) ([]ExportFile, error) {
+	files := make([]ExportFile, 0, len(accountExports))
+	for _, e := range accountExports {
+		records, err := s.queryRecords(ctx, e.query, userID)
+		if err != nil {
+			return nil, fmt.Errorf("export %s: %w", e.name, err)
+		}
+		files = append(files, ExportFile{Name: e.name, Records: records})
+	}
+	return files, nil
+}
+
+// queryRecords runs a query and returns its rows as column-name maps
+func (s *pgAccountStore) queryRecords(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	records := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		record := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			switch v := values[i].(type) {
+			case []byte:
+				// Arrays such as tags arrive in their text form
+				var array pq.StringArray
+				if err := array.Scan(v); err == nil {
+					record[column] = []string(array)
+				} else {
+					record[column] = string(v)
+				}
+			default:
+				record[column] = v
+			}
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+type pgIdentityStore struct {
+	db *sql.DB
+}
+
+func (s *pgIdentityStore) List(ctx context.Context, userID int) ([]models.Identity, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, user_id, provider, provider_user_id, created_at
+		FROM user_identities
+		WHERE user_id = $1
+		ORDER BY created_at ASC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []models.Identity{}
+	for rows.Next() {
+		var i models.Identity
+		if err := rows.Scan(&i.ID, &i.UserID, &i.Provider, &i.ProviderUserID, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		identities = append(identities, i)
+	}
+	return identities, rows.Err()
+}
+
+func (s *pgIdentityStore) Login(ctx context.Context, provider, providerUserID, profileImage string) (*models.User, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var user models.User
+	err = tx.QueryRowContext(ctx, `
+		UPDATE users u SET profile_image = COALESCE(NULLIF($3, ''), u.profile_image)
+		FROM user_identities i
+		WHERE i.user_id = u.id AND i.provider = $1 AND i.provider_user_id = $2
+		RETURNING u.id, u.oauth_id, u.oauth_provider, u.display_name, u.profile_image, u.bio, u.created_at
+	`, provider, providerUserID, profileImage).Scan(&user.ID, &user.OAuthID, &user.OAuthProvider, &user.DisplayName, &user.ProfileImage, &user.Bio, &user.CreatedAt)
+	if err == sql.ErrNoRows {
+		// An empty display name sends the new user to profile setup
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO users (oauth_id, oauth_provider, display_name, profile_image, bio)
+			VALUES ($1, $2, '', $3, '')
+			RETURNING id, oauth_id, oauth_provider, display_name, profile_image, bio, created_at
+		`, providerUserID, provider, profileImage).Scan(&user.ID, &user.OAuthID, &user.OAuthProvider, &user.DisplayName, &user.ProfileImage, &user.Bio, &user.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO user_identities (user_id, provider, provider_user_id)
+			VALUES ($1, $2, $3)
+		`, user.ID, provider, providerUserID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *pgIdentityStore) Owner(ctx context.Context, provider, providerUserID string) (int, error) {
+	var userID int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT user_id FROM user_identities
+		WHERE provider = $1 AND provider_user_id = $2
+	`, provider, providerUserID).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	return userID, err
+}
+
+func (s *pgIdentityStore) Link(ctx context.Context, userID int, provider, providerUserID string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO user_identities (user_id, provider, provider_user_id)
+		VALUES ($1, $2, $3)
+	`, userID, provider, providerUserID)
+	return err
+}
+
+func (s *pgIdentityStore) Unlink(ctx context.Context, userID, id int) (*models.Identity, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock the user's identities so concurrent unlinks cannot remove all of
+	// them
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, user_id, provider, provider_user_id, created_at
+		FROM user_identities
+		WHERE user_id = $1
+		ORDER BY created_at ASC
+		FOR UPDATE
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	var removed *models.Identity
+	var remaining []models.Identity
+	for rows.Next() {
+		var i models.Identity
+		if err := rows.Scan(&i.ID, &i.UserID, &i.Provider, &i.ProviderUserID, &i.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if i.ID == id {
+			removed = &i
+		} else {
+			remaining = append(remaining, i)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if removed == nil {
+		return nil, ErrNotFound
+	}
+	if len(remaining) == 0 {
+		return nil, ErrLastIdentity
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_identities WHERE id = $1", id); err != nil {
+		return nil, err
+	}
+
+	// The token belongs to the provider, which another identity may still use
+	providerLinked := false
+	for _, i := range remaining {
+		providerLinked = providerLinked || i.Provider == removed.Provider
+	}
+	if !providerLinked {
+		_, err := tx.ExecContext(ctx, "DELETE FROM oauth_tokens WHERE user_id = $1 AND provider = $2", userID, removed.Provider)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Point the account's original identity at one that is still linked, so
+	// logging in with the unlinked account later can create a fresh user
+	_, err = tx.ExecContext(ctx, `
+		UPDATE users SET oauth_id = $4, oauth_provider = $5
+		WHERE id = $1 AND oauth_provider = $2 AND oauth_id = $3
+	`, userID, removed.Provider, removed.ProviderUserID, remaining[0].ProviderUserID, remaining[0].Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
+
+// mergeStatements move the rows of user $1 to user $2
+var mergeStatements = []string{
+	// Fill in profile fields the target never set
+	`UPDATE users t SET
+		display_name = COALESCE(NULLIF(t.display_name, ''), s.display_name),
+		profile_image = COALESCE(NULLIF(t.profile_image, ''), s.profile_image),
+		bio = COALESCE(NULLIF(t.bio, ''), s.bio)
+	FROM users s WHERE t.id = $2 AND s.id = $1`,
+	`UPDATE posts SET user_id = $2 WHERE user_id = $1`,
+	`UPDATE replies SET user_id = $2 WHERE user_id = $1`,
+	`INSERT INTO likes (user_id, post_id, created_at)
+		SELECT $2, post_id, created_at FROM likes WHERE user_id = $1
+		ON CONFLICT (user_id, post_id) DO NOTHING`,
+	`DELETE FROM likes WHERE user_id = $1`,
+	`INSERT INTO follows (follower_id, followee_id, created_at)
+		SELECT $2, followee_id, created_at FROM follows WHERE follower_id = $1 AND followee_id <> $2
+		ON CONFLICT (follower_id, followee_id) DO NOTHING`,
+	`INSERT INTO follows (follower_id, followee_id, created_at)
+		SELECT follower_id, $2, created_at FROM follows WHERE followee_id = $1 AND follower_id <> $2
+		ON CONFLICT (follower_id, followee_id) DO NOTHING`,
+	`DELETE FROM follows WHERE follower_id = $1 OR followee_id = $1`,
+	`UPDATE notifications SET user_id = $2 WHERE user_id = $1`,
+	`UPDATE notifications SET actor_id = $2 WHERE actor_id = $1`,
+	`DELETE FROM notifications WHERE user_id = $2 AND actor_id = $2`,
+	`UPDATE crosspost_jobs SET user_id = $2 WHERE user_id = $1`,
+	// Uploads keep their keys, so links to them in moved posts still work
+	`UPDATE uploads SET user_id = $2
+		WHERE user_id = $1 AND sha256 NOT IN (SELECT sha256 FROM uploads WHERE user_id = $2)`,
+	`UPDATE oauth_tokens SET user_id = $2
+		WHERE user_id = $1 AND provider NOT IN (SELECT provider FROM oauth_tokens WHERE user_id = $2)`,
+	`UPDATE user_identities SET user_id = $2 WHERE user_id = $1`,
+}
+
+func (s *pgIdentityStore) Merge(ctx context.Context, sourceID, targetID int) ([]models.Upload, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// A file both users uploaded has variants of the same sizes and formats
+	// under each copy's key prefix, so links can switch to the target's copy
+	rows, err := tx.QueryContext(ctx, `
+		SELECT s.key_prefix, t.key_prefix
+		FROM uploads s JOIN uploads t ON t.sha256 = s.sha256
+		WHERE s.user_id = $1 AND t.user_id = $2
+	`, sourceID, targetID)
+	if err != nil {
+		return nil, err
+	}
+	var relinks [][2]string
+	for rows.Next() {
+		var from, to string
+		if err := rows.Scan(&from, &to); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		relinks = append(relinks, [2]string{"/" + from + "_", "/" + to + "_"})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, relink := range relinks {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE posts SET comment = replace(comment, $1, $2) WHERE strpos(comment, $1) > 0
+		`, relink[0], relink[1])
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE users SET profile_image = replace(profile_image, $1, $2) WHERE strpos(profile_image, $1) > 0
+		`, relink[0], relink[1])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, statement := range mergeStatements {
+		if _, err := tx.ExecContext(ctx, statement, sourceID, targetID); err != nil {
+			return nil, err
+		}
+	}
+
+	// The uploads left are the source's copies of the target's files
+	rows, err = tx.QueryContext(ctx, "DELETE FROM uploads WHERE user_id = $1 RETURNING "+uploadColumns, sourceID)
+	if err != nil {
+		return nil, err
+	}
+	var dropped []models.Upload
+	for rows.Next() {
+		u, err := scanUpload(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		dropped = append(dropped, *u)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id = $1", sourceID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return dropped, nil
+}
+
+type pgSessionStore struct {
+	db *sql.DB
+}
+
+const sessionColumns = `id, token_hash, COALESCE(user_id, 0), COALESCE(provider, ''), data, COALESCE(device, ''),
+	COALESCE(user_agent, ''), COALESCE(ip, ''), created_at, last_seen_at, expires_at`
+
+func scanSession(row interface{ Scan(...interface{}) error }) (*models.Session, error) {
+	var s models.Session
+	err := row.Scan(&s.ID, &s.TokenHash, &s.UserID, &s.Provider, &s.Data, &s.Device, &s.UserAgent, &s.IP,
+		&s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *pgSessionStore) Create(ctx context.Context, session *models.Session) error {
+	return s.db.QueryRowContext(ctx, `
+		INSERT INTO sessions (token_hash, user_id, provider, data, user_agent, device, ip, expires_at)
+		VALUES ($1, NULLIF($2, 0), NULLIF($3, ''), $4, $5, $6, $7, $8)
+		RETURNING id, created_at, last_seen_at
+	`, session.TokenHash, session.UserID, session.Provider, session.Data, session.UserAgent, session.Device, session.IP,
+		session.ExpiresAt).Scan(&session.ID, &session.CreatedAt, &session.LastSeenAt)
+}
+
+func (s *pgSessionStore) Get(ctx context.Context, tokenHash string) (*models.Session, error) {
+	session, err := scanSession(s.db.QueryRowContext(ctx, `
+		SELECT `+sessionColumns+` FROM sessions
+		WHERE token_hash = $1 AND expires_at > CURRENT_TIMESTAMP
+	`, tokenHash))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return session, err
+}
+
+func (s *pgSessionStore) Update(ctx context.Context, session *models.Session) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE sessions SET user_id = NULLIF($2, 0), provider = NULLIF($3, ''), data = $4, expires_at = $5, last_seen_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1
+	`, session.TokenHash, session.UserID, session.Provider, session.Data, session.ExpiresAt)
+	return err
+}
+
+func (s *pgSessionStore) Touch(ctx context.Context, tokenHash, ip string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE sessions SET last_seen_at = CURRENT_TIMESTAMP, ip = $2
+		WHERE token_hash = $1
+	`, tokenHash, ip)
+	return err
+}
+
+func (s *pgSessionStore) Delete(ctx context.Context, tokenHash string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM sessions WHERE token_hash = $1", tokenHash)
+	return err
+}
+
+func (s *pgSessionStore) List(ctx context.Context, userID int) ([]models.Session, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+sessionColumns+` FROM sessions
+		WHERE user_id = $1 AND expires_at > CURRENT_TIMESTAMP
+		ORDER BY last_seen_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *pgSessionStore) Revoke(ctx context.Context, userID, id int) (string, error) {
+	var tokenHash string
+	err := s.db.QueryRowContext(ctx, `
+		DELETE FROM sessions WHERE id = $1 AND user_id = $2
+		RETURNING token_hash
+	`, id, userID).Scan(&tokenHash)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	return tokenHash, err
+}
+
+func (s *pgSessionStore) RevokeAll(ctx context.Context, userID int, keepHash, provider string) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM sessions
+		WHERE user_id = $1 AND token_hash <> $2 AND ($3 = '' OR provider = $3)
+	`, userID, keepHash, provider)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (s *pgSessionStore) DeleteExpired(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM sessions WHERE expires_at <= CURRENT_TIMESTAMP")
+	return err
+}
@@ -0,0 +1,305 @@
+// Package store defines the persistence interfaces the HTTP handlers depend
+// on, with a Postgres implementation and an in-memory one for tests.
+package store
+
+import (
+	"backend/internal/database"
+	"backend/internal/models"
+	"backend/internal/search"
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when the requested row does not exist
+var ErrNotFound = errors.New("not found")
+
+// ErrDuplicate is returned when creating a row that already exists
+var ErrDuplicate = errors.New("duplicate")
+
+// ErrQuotaExceeded is returned when an upload would take a user past their
+// storage quota
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// ErrLastIdentity is returned when unlinking would leave an account without
+// any way to log in
+var ErrLastIdentity = errors.New("cannot unlink the last login method")
+
+// Stores bundles every store so they can be injected together
+type Stores struct {
+	Posts         PostStore
+	Users         UserStore
+	Likes         LikeStore
+	Replies       ReplyStore
+	Tokens        TokenStore
+	Uploads       UploadStore
+	Follows       FollowStore
+	Notifications NotificationStore
+	Connections   ConnectionStore
+	Crossposts    CrosspostStore
+	Accounts      AccountStore
+	Identities    IdentityStore
+	Sessions      SessionStore
+}
+
+// PostFilter narrows a post listing. Zero values do not filter.
+type PostFilter struct {
+	// UserID only lists posts by this user
+	UserID int
+	// FollowedBy only lists posts by users this user follows
+	FollowedBy int
+	// Search only lists posts matching this query, by relevance, paginated
+	// with database.Cursor.Rank
+	Search *search.Query
+	// BoostRecent adds RecencyBoost per day of age to the relevance of
+	// newer posts
+	BoostRecent bool
+}
+
+// RecencyBoost is the relevance a search result gains for each day it is
+// newer than another. A fixed amount per day keeps ranks, and so cursors,
+// stable between requests.
+const RecencyBoost = 0.01
+
+// PostUpdate holds the fields of a post to change; nil fields are kept
+type PostUpdate struct {
+	Title    *string
+	SongID   *string
+	SongType *string
+	Comment  *string
+	Tags     *[]string
+}
+
+// Crosspost asks PostStore.Create to queue the new post for another network
+// in the same transaction, so the job exists exactly when the post does
+type Crosspost struct {
+	Provider string
+	// Text builds the message from the ID of the new post
+	Text func(postID int) string
+}
+
+// PostStore persists posts. Posts are returned with their author, like and
+// reply counts, and whether viewerID liked them.
+//
+// List methods return one page in (created_at, id) order and fetch one row
+// more than page.Limit so callers can tell whether a next page exists.
+type PostStore interface {
+	List(ctx context.Context, viewerID int, filter PostFilter, page database.PageRequest) ([]models.Post, error)
+	Get(ctx context.Context, viewerID, id int) (*models.Post, error)
+	// Create inserts post and sets its ID and CreatedAt
+	Create(ctx context.Context, post *models.Post, crossposts ...Crosspost) error
+	Update(ctx context.Context, id int, update PostUpdate) error
+	Delete(ctx context.Context, id int) error
+	// OwnerID returns the author of a post
+	OwnerID(ctx context.Context, id int) (int, error)
+}
+
+// UserStore persists user profiles
+type UserStore interface {
+	Get(ctx context.Context, id int) (*models.User, error)
+	UpdateProfile(ctx context.Context, id int, displayName, profileImage, bio string) error
+	// Search lists users whose display name contains query, newest first,
+	// with follower counts as seen by viewerID
+	Search(ctx context.Context, viewerID int, query string, page database.PageRequest) ([]models.User, error)
+	// List returns up to limit users in ID order with the identity they
+	// were created with, for the dev login page
+	List(ctx context.Context, limit int) ([]models.User, error)
+}
+
+// LikeStore persists likes of posts
+type LikeStore interface {
+	Liked(ctx context.Context, userID, postID int) (bool, error)
+	Like(ctx context.Context, userID, postID int) error
+	Unlike(ctx context.Context, userID, postID int) error
+	Count(ctx context.Context, postID int) (int, error)
+}
+
+// ReplyStore persists replies to posts
+type ReplyStore interface {
+	// Create inserts reply and sets its ID and CreatedAt
+	Create(ctx context.Context, reply *models.Reply) error
+	// List returns the replies of a post oldest first, with their authors
+	List(ctx context.Context, postID int, page database.PageRequest) ([]models.Reply, error)
+}
+
+// TokenStore persists personal access tokens. Only the hash of a token's
+// secret is stored.
+type TokenStore interface {
+	// Create inserts token and sets its ID and CreatedAt
+	Create(ctx context.Context, token *models.AccessToken, hash string) error
+	List(ctx context.Context, userID int) ([]models.AccessToken, error)
+	// Revoke deletes one of a user's tokens
+	Revoke(ctx context.Context, userID, id int) error
+	// Lookup returns the unexpired token with the given hash. Tokens of a
+	// user whose account is scheduled for deletion are suspended until the
+	// deletion is cancelled.
+	Lookup(ctx context.Context, hash string) (*models.AccessToken, error)
+	// Touch records that a token was used at time at
+	Touch(ctx context.Context, id int, at time.Time) error
+}
+
+// UploadStore records uploaded images so identical files are stored once
+// per user, usage can be limited and unreferenced files collected
+type UploadStore interface {
+	// Reuse returns the user's upload of the file with this SHA-256 and
+	// marks it referenced now
+	Reuse(ctx context.Context, userID int, sha256 string) (*models.Upload, error)
+	// Usage returns the total size of a user's uploads in bytes
+	Usage(ctx context.Context, userID int) (int64, error)
+	// List returns a user's uploads, oldest first
+	List(ctx context.Context, userID int) ([]models.Upload, error)
+	// Create inserts upload and sets its ID, CreatedAt and LastReferencedAt.
+	// It returns ErrQuotaExceeded if the owner's usage would pass quota and
+	// ErrDuplicate if they already uploaded the same file.
+	Create(ctx context.Context, upload *models.Upload, quota int64) error
+	// Sweep marks the uploads a profile image or post comment links to as
+	// referenced now, then deletes and returns those that have not been
+	// referenced for longer than grace
+	Sweep(ctx context.Context, grace time.Duration) ([]models.Upload, error)
+}
+
+// FollowStore persists follows between users
+type FollowStore interface {
+	// Follow makes followerID follow followeeID and reports whether they did
+	// not already
+	Follow(ctx context.Context, followerID, followeeID int) (bool, error)
+	Unfollow(ctx context.Context, followerID, followeeID int) error
+	// Followers lists the users following userID and Following the users
+	// userID follows, most recent follow first, with FollowedAt set and
+	// follower counts as seen by viewerID
+	Followers(ctx context.Context, viewerID, userID int, page database.PageRequest) ([]models.User, error)
+	Following(ctx context.Context, viewerID, userID int, page database.PageRequest) ([]models.User, error)
+}
+
+// NotificationStore persists notifications of likes, replies and follows
+type NotificationStore interface {
+	// Create inserts n and sets its ID and CreatedAt. A notification about a
+	// post is addressed to the post's author, whose ID is set in UserID; it
+	// is not inserted, and Create returns false, when the post does not
+	// exist or the actor is its author.
+	Create(ctx context.Context, n *models.Notification) (bool, error)
+	// DeleteForPost removes the notification of an actor's action on a post
+	DeleteForPost(ctx context.Context, actorID, postID int, verb string) error
+	// DeleteForUser removes the notification of an actor's action on a user
+	DeleteForUser(ctx context.Context, actorID, userID int, verb string) error
+	// List returns a user's notifications newest first, with their actors
+	List(ctx context.Context, userID int, unreadOnly bool, page database.PageRequest) ([]models.Notification, error)
+	UnreadCount(ctx context.Context, userID int) (int, error)
+	// MarkRead marks the user's notifications with the given IDs as read
+	MarkRead(ctx context.Context, userID int, ids []int64) error
+	MarkAllRead(ctx context.Context, userID int) error
+}
+
+// ConnectionStore persists the external accounts users connect for
+// cross-posting and the OAuth tokens used to post to them
+type ConnectionStore interface {
+	// Get returns a user's connection to provider
+	Get(ctx context.Context, userID int, provider string) (*models.Connection, error)
+	Delete(ctx context.Context, userID int, provider string) error
+	// Save stores token as the user's token for its provider, replacing any
+	// earlier one and clearing NeedsReauth
+	Save(ctx context.Context, token *models.OAuthToken) error
+	// Refresh calls refresh with the user's token for provider while holding
+	// a lock on it, so a single-use refresh token is never redeemed twice,
+	// then saves the changes refresh made to the token, even when it
+	// returns an error. It returns ErrNotFound if no token is stored.
+	Refresh(ctx context.Context, userID int, provider string, refresh func(token *models.OAuthToken) error) error
+}
+
+// CrosspostStore persists the cross-post jobs queued by PostStore.Create.
+// Workers claim due jobs and record how each attempt went.
+type CrosspostStore interface {
+	// Jobs lists the jobs of a post in the order they were queued
+	Jobs(ctx context.Context, postID int) ([]models.CrosspostJob, error)
+	// Claim reserves the oldest due job for lease and counts the attempt.
+	// Jobs whose lease ran out are due again. It returns ErrNotFound when no
+	// job is due.
+	Claim(ctx context.Context, lease time.Duration) (*models.CrosspostJob, error)
+	// Succeed records the ID of the post created on the remote service
+	Succeed(ctx context.Context, id int, remoteID string) error
+	// Fail gives up on a job
+	Fail(ctx context.Context, id int, lastError string) error
+	// Retry makes a job due again at next
+	Retry(ctx context.Context, id int, lastError string, next time.Time) error
+}
+
+// IdentityStore persists the login provider accounts linked to users
+type IdentityStore interface {
+	// List returns a user's identities, oldest first
+	List(ctx context.Context, userID int) ([]models.Identity, error)
+	// Login returns the user an identity is linked to, updating their
+	// profile image unless profileImage is empty. A user without a display
+	// name is created for an identity seen for the first time.
+	Login(ctx context.Context, provider, providerUserID, profileImage string) (*models.User, error)
+	// Owner returns the ID of the user an identity is linked to
+	Owner(ctx context.Context, provider, providerUserID string) (int, error)
+	// Link attaches an identity seen for the first time to a user
+	Link(ctx context.Context, userID int, provider, providerUserID string) error
+	// Unlink removes one of a user's identities and returns it. The OAuth
+	// token stored for its provider goes with the user's last identity of
+	// that provider. It returns ErrLastIdentity if it is the user's only one.
+	Unlink(ctx context.Context, userID, id int) (*models.Identity, error)
+	// Merge moves everything owned by the duplicate account sourceID to
+	// targetID and deletes the duplicate. Rows that would collide with the
+	// target's own are dropped. Links to a file both users uploaded are
+	// pointed at the target's copy, and the source's copies are returned so
+	// their blobs can be deleted.
+	//
+	// Moved uploads are not checked against the target's quota: they are
+	// already stored and linked from the moved posts, so refusing the merge
+	// or dropping them would lose images. Usage over quota only blocks
+	// further uploads.
+	Merge(ctx context.Context, sourceID, targetID int) ([]models.Upload, error)
+}
+
+// SessionStore persists server-side login sessions by the hash of their
+// cookie token
+type SessionStore interface {
+	// Create inserts session and sets its ID, CreatedAt and LastSeenAt
+	Create(ctx context.Context, session *models.Session) error
+	// Get returns the unexpired session with the given token hash
+	Get(ctx context.Context, tokenHash string) (*models.Session, error)
+	// Update saves the user, provider, data and expiry of a session and
+	// records it as seen now
+	Update(ctx context.Context, session *models.Session) error
+	// Touch records that a session was seen now from ip
+	Touch(ctx context.Context, tokenHash, ip string) error
+	Delete(ctx context.Context, tokenHash string) error
+	// List returns a user's unexpired sessions, most recently seen first
+	List(ctx context.Context, userID int) ([]models.Session, error)
+	// Revoke deletes one of a user's sessions and returns its token hash
+	Revoke(ctx context.Context, userID, id int) (string, error)
+	// RevokeAll deletes a user's sessions except the one with keepHash and
+	// returns how many were deleted. A non-empty provider only deletes
+	// sessions that logged in through it.
+	RevokeAll(ctx context.Context, userID int, keepHash, provider string) (int64, error)
+	// DeleteExpired removes sessions past their expiry
+	DeleteExpired(ctx context.Context) error
+}
+
+// ExportFile is one file of an account export: Records are its rows as
+// column-name maps
+type ExportFile struct {
+	Name    string
+	Records []map[string]interface{}
+}
+
+// AccountStore persists account deletion requests and reads account exports
+type AccountStore interface {
+	// ScheduleDeletion marks a user for deletion once grace has passed,
+	// keeping a deletion already pending, and returns when the account will
+	// be deleted
+	ScheduleDeletion(ctx context.Context, userID int, grace time.Duration) (time.Time, error)
+	// CancelDeletion withdraws a pending deletion. It returns ErrNotFound if
+	// none is pending.
+	CancelDeletion(ctx context.Context, userID int) error
+	// DueForDeletion lists the users whose deletion time has passed
+	DueForDeletion(ctx context.Context) ([]int, error)
+	// Delete removes a user due for deletion and everything they created.
+	// It returns ErrNotFound if the deletion was cancelled in the meantime.
+	Delete(ctx context.Context, userID int) error
+	// Export returns everything stored about a user: profile, posts,
+	// replies, likes, follows, linked providers and connections, without
+	// tokens
+	Export(ctx context.Context, userID int) ([]ExportFile, error)
+}
@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"backend/internal/apierror"
+	"backend/internal/database"
+	"backend/internal/models"
+	"net/http"
+	"strconv"
+)
+
+// ParsePageRequest reads the limit and cursor query parameters. Errors are
+// *apierror.Error values ready to be written to the client.
+func ParsePageRequest(r *http.Request) (database.PageRequest, error) {
+	page := database.PageRequest{Limit: database.DefaultPageLimit}
+
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		limit, err := strconv.Atoi(limitParam)
+		if err != nil || limit < 1 || limit > database.MaxPageLimit {
+			return page, apierror.Invalid("limit", "limit must be between 1 and "+strconv.Itoa(database.MaxPageLimit))
+		}
+		page.Limit = limit
+	}
+
+	if cursorParam := r.URL.Query().Get("cursor"); cursorParam != "" {
+		cursor, err := database.DecodeCursor(cursorParam)
+		if err != nil {
+			return page, apierror.Invalid("cursor", "Invalid cursor")
+		}
+		page.Cursor = cursor
+	}
+
+	return page, nil
+}
+
+// BuildPage trims the extra row fetched by database.Keyset.Build and sets
+// the next cursor from the last item of the page
+func BuildPage[T any](items []T, page database.PageRequest, cursorOf func(T) database.Cursor) models.Page[T] {
+	result := models.Page[T]{Items: items}
+	if len(items) > page.Limit {
+		result.Items = items[:page.Limit]
+		next := cursorOf(result.Items[page.Limit-1]).Encode()
+		result.NextCursor = &next
+	}
+	if result.Items == nil {
+		result.Items = []T{}
+	}
+	return result
+}
+
+// PostCursor returns the pagination cursor for a post
+func PostCursor(p models.Post) database.Cursor {
+	return database.Cursor{CreatedAt: p.CreatedAt, ID: p.ID}
+}
+
+// RankedPostCursor returns the pagination cursor for a post in search results
+func RankedPostCursor(p models.Post) database.Cursor {
+	rank := p.Rank
+	return database.Cursor{CreatedAt: p.CreatedAt, ID: p.ID, Rank: &rank}
+}
+
+// ReplyCursor returns the pagination cursor for a reply
+func ReplyCursor(r models.Reply) database.Cursor {
+	return database.Cursor{CreatedAt: r.CreatedAt, ID: r.ID}
+}
+
+// FollowCursor returns the pagination cursor for a user in a follower or
+// following list, which is ordered by follow time
+func FollowCursor(u models.User) database.Cursor {
+	return database.Cursor{CreatedAt: *u.FollowedAt, ID: u.ID}
+}
+
+// UserCursor returns the pagination cursor for a user
+func UserCursor(u models.User) database.Cursor {
+	return database.Cursor{CreatedAt: u.CreatedAt, ID: u.ID}
+}
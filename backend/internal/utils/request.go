@@ -1,32 +1,19 @@
 package utils
 
 import (
-	"backend/internal/auth"
+	"backend/internal/apierror"
 	"net/http"
 	"strconv"
-	"strings"
 )
 
-// GetCurrentUserID retrieves the current user ID from session
-func GetCurrentUserID(r *http.Request) (int, bool) {
-	session, err := auth.Store.Get(r, auth.GetSessionCookieName())
-	if err != nil {
+// PathID returns the numeric path wildcard name of a route pattern, e.g.
+// {id} in "GET /api/posts/{id}". A value that is not a positive integer
+// cannot name any resource, so it writes a 404 and returns false.
+func PathID(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue(name))
+	if err != nil || id <= 0 {
+		apierror.Write(w, r, apierror.NotFound("Not found"))
 		return 0, false
 	}
-	
-	if id, ok := session.Values["user_id"].(int); ok {
-		return id, true
-	}
-	
-	return 0, false
-}
-
-// ExtractIDFromPath extracts the numeric ID from a URL path
-// Example: /api/posts/123/like -> 123
-func ExtractIDFromPath(path string, position int) (int, error) {
-	parts := strings.Split(path, "/")
-	if len(parts) <= position {
-		return 0, strconv.ErrSyntax
-	}
-	return strconv.Atoi(parts[position])
+	return id, true
 }
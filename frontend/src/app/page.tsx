@@ -16,6 +16,8 @@ export default function Home() {
         posts,
         loading,
         isSearching,
+        loadingMore,
+        hasMore,
         searchQuery,
         searchType,
         activeSearch,
@@ -26,6 +28,7 @@ export default function Home() {
         clearSearch,
         searchByTag,
         refreshPosts,
+        loadMore,
     } = useSearch();
 
     useEffect(() => {
@@ -93,6 +96,16 @@ export default function Home() {
                         <PostCard key={post.id} post={post} onTagClick={searchByTag} />
                     ))
                 )}
+
+                {!loading && hasMore && (
+                    <button
+                        onClick={loadMore}
+                        disabled={loadingMore}
+                        className="w-full py-2 text-sm font-medium text-primary hover:underline disabled:opacity-50"
+                    >
+                        {loadingMore ? 'Loading...' : 'Load more'}
+                    </button>
+                )}
             </div>
         </main>
     );
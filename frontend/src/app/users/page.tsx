@@ -10,7 +10,7 @@ import { UserProfile } from '@/entities/user/types'
 import { API_BASE_URL, DEFAULT_AVATAR_URL } from '@/shared/config'
 
 function UsersFeedContent() {
-    const { posts, loading: postsLoading, error, filterByUser } = usePosts()
+    const { posts, loading: postsLoading, loadingMore, hasMore, error, loadMore, filterByUser } = usePosts()
     const { currentUser, refreshUser } = useAuth()
     const searchParams = useSearchParams()
     const userIdParam = searchParams.get('user_id')
@@ -270,6 +270,15 @@ function UsersFeedContent() {
                             {posts.map((post) => (
                                 <PostCard key={post.id} post={post} />
                             ))}
+                            {hasMore && (
+                                <button
+                                    onClick={loadMore}
+                                    disabled={loadingMore}
+                                    className="w-full py-2 text-sm font-medium text-primary hover:underline disabled:opacity-50"
+                                >
+                                    {loadingMore ? 'Loading...' : 'Load more'}
+                                </button>
+                            )}
                         </div>
                     )}
                 </section>
@@ -1,9 +1,11 @@
-import { fetchJson } from '@/shared/api'
+import { fetchJson, withCursor } from '@/shared/api'
+import { Page } from '@/shared/types'
 import { UserSummary } from '../types'
 
-export async function fetchUsers(query?: string) {
+// fetchUsers returns a page of users matching query, starting after cursor
+export async function fetchUsers(query?: string, cursor: string | null = null) {
     const endpoint = query
-        ? `/api/search/users?q=${encodeURIComponent(query)}`
-        : '/api/search/users'
-    return fetchJson<UserSummary[]>(endpoint)
+        ? `/api/search/users?q=${encodeURIComponent(query)}&limit=100`
+        : '/api/search/users?limit=100'
+    return fetchJson<Page<UserSummary>>(withCursor(endpoint, cursor))
 }
@@ -1,6 +1,7 @@
 import React, { useEffect, useState } from 'react';
-import { Reply } from '@/shared/types';
+import { Page, Reply } from '@/shared/types';
 import { API_BASE_URL, DEFAULT_AVATAR_URL } from '@/shared/config';
+import { withCursor } from '@/shared/api';
 
 interface ReplyListProps {
     postId: number;
@@ -9,7 +10,9 @@ interface ReplyListProps {
 
 export const ReplyList: React.FC<ReplyListProps> = ({ postId, refreshTrigger }) => {
     const [replies, setReplies] = useState<Reply[]>([]);
+    const [nextCursor, setNextCursor] = useState<string | null>(null);
     const [loading, setLoading] = useState(true);
+    const [loadingMore, setLoadingMore] = useState(false);
 
     useEffect(() => {
         const fetchReplies = async () => {
@@ -17,8 +20,9 @@ export const ReplyList: React.FC<ReplyListProps> = ({ postId, refreshTrigger })
             try {
                 const res = await fetch(`${API_BASE_URL}/api/posts/${postId}/replies`);
                 if (res.ok) {
-                    const data = await res.json();
-                    setReplies(data || []);
+                    const data: Page<Reply> = await res.json();
+                    setReplies(data?.items || []);
+                    setNextCursor(data?.next_cursor ?? null);
                 }
             } catch (error) {
                 console.error('Failed to fetch replies', error);
@@ -30,6 +34,23 @@ export const ReplyList: React.FC<ReplyListProps> = ({ postId, refreshTrigger })
         fetchReplies();
     }, [postId, refreshTrigger]);
 
+    const loadMore = async () => {
+        if (!nextCursor || loadingMore) return;
+        setLoadingMore(true);
+        try {
+            const res = await fetch(withCursor(`${API_BASE_URL}/api/posts/${postId}/replies`, nextCursor));
+            if (res.ok) {
+                const data: Page<Reply> = await res.json();
+                setReplies(prev => [...prev, ...(data?.items || [])]);
+                setNextCursor(data?.next_cursor ?? null);
+            }
+        } catch (error) {
+            console.error('Failed to fetch more replies', error);
+        } finally {
+            setLoadingMore(false);
+        }
+    };
+
     if (loading) {
         return <div className="text-center py-4 text-sm text-gray-500">Loading replies...</div>;
     }
@@ -58,6 +79,15 @@ export const ReplyList: React.FC<ReplyListProps> = ({ postId, refreshTrigger })
                     </div>
                 </div>
             ))}
+            {nextCursor && (
+                <button
+                    onClick={loadMore}
+                    disabled={loadingMore}
+                    className="w-full py-1 text-sm text-gray-500 hover:underline disabled:opacity-50"
+                >
+                    {loadingMore ? 'Loading...' : 'Show more replies'}
+                </button>
+            )}
         </div>
     );
 };
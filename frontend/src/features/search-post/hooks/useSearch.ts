@@ -1,11 +1,14 @@
 import { useState, useCallback } from 'react';
-import { Post } from '@/shared/types';
+import { Page, Post } from '@/shared/types';
 import { API_BASE_URL } from '@/shared/config';
+import { withCursor } from '@/shared/api';
 
 interface UseSearchResult {
     posts: Post[];
     loading: boolean;
     isSearching: boolean;
+    loadingMore: boolean;
+    hasMore: boolean;
     searchQuery: string;
     searchType: string;
     activeSearch: string;
@@ -16,6 +19,7 @@ interface UseSearchResult {
     clearSearch: () => void;
     searchByTag: (tag: string) => void;
     refreshPosts: () => void;
+    loadMore: () => void;
 }
 
 export const useSearch = (): UseSearchResult => {
@@ -24,6 +28,9 @@ export const useSearch = (): UseSearchResult => {
     const [searchType, setSearchType] = useState('all');
     const [loading, setLoading] = useState(true);
     const [isSearching, setIsSearching] = useState(false);
+    const [nextCursor, setNextCursor] = useState<string | null>(null);
+    const [endpoint, setEndpoint] = useState('');
+    const [loadingMore, setLoadingMore] = useState(false);
     const [activeSearch, setActiveSearch] = useState('');
     const [activeSearchType, setActiveSearchType] = useState('all');
 
@@ -35,25 +42,48 @@ export const useSearch = (): UseSearchResult => {
         }
         
         try {
-            const endpoint = query
+            const endpointToUse = query
                 ? `${API_BASE_URL}/api/search/posts?q=${encodeURIComponent(query)}&type=${type}`
                 : `${API_BASE_URL}/api/posts`;
 
-            const res = await fetch(endpoint, {
+            const res = await fetch(endpointToUse, {
                 credentials: 'include'
             });
             if (!res.ok) throw new Error('Failed to fetch');
-            const data = await res.json();
-            setPosts(data || []);
+            const data: Page<Post> = await res.json();
+            setPosts(data?.items || []);
+            setNextCursor(data?.next_cursor ?? null);
+            setEndpoint(endpointToUse);
         } catch (error) {
             console.error(error);
             setPosts([]);
+            setNextCursor(null);
         } finally {
             setLoading(false);
             setIsSearching(false);
         }
     }, []);
 
+    // loadMore appends the page after the last one loaded for the current
+    // search or feed
+    const loadMore = useCallback(async () => {
+        if (!nextCursor || loadingMore) return;
+        setLoadingMore(true);
+        try {
+            const res = await fetch(withCursor(endpoint, nextCursor), {
+                credentials: 'include'
+            });
+            if (!res.ok) throw new Error('Failed to fetch');
+            const data: Page<Post> = await res.json();
+            setPosts(prev => [...prev, ...(data?.items || [])]);
+            setNextCursor(data?.next_cursor ?? null);
+        } catch (error) {
+            console.error(error);
+        } finally {
+            setLoadingMore(false);
+        }
+    }, [endpoint, nextCursor, loadingMore]);
+
     const handleSearch = useCallback((e: React.FormEvent) => {
         e.preventDefault();
         setActiveSearch(searchQuery);
@@ -87,6 +117,8 @@ export const useSearch = (): UseSearchResult => {
         posts,
         loading,
         isSearching,
+        loadingMore,
+        hasMore: nextCursor !== null,
         searchQuery,
         searchType,
         activeSearch,
@@ -97,5 +129,6 @@ export const useSearch = (): UseSearchResult => {
         clearSearch,
         searchByTag,
         refreshPosts,
+        loadMore,
     };
 };
@@ -1,11 +1,46 @@
 import { API_BASE_URL } from './config'
 
+export type FieldError = {
+    field: string
+    message: string
+}
+
+// ApiError mirrors the {"error": {...}} envelope returned by the backend
+export class ApiError extends Error {
+    constructor(
+        readonly status: number,
+        readonly code: string,
+        message: string,
+        readonly fields: FieldError[] = [],
+        readonly requestId?: string,
+    ) {
+        super(message)
+        this.name = 'ApiError'
+    }
+}
+
+export async function toApiError(res: Response): Promise<ApiError> {
+    try {
+        const { error } = await res.json()
+        return new ApiError(res.status, error.code, error.message, error.fields ?? [], error.request_id)
+    } catch {
+        return new ApiError(res.status, 'unknown', `Request failed: ${res.status}`)
+    }
+}
+
 export async function fetchJson<T>(endpoint: string, credentials: RequestCredentials = 'include') {
     const res = await fetch(`${API_BASE_URL}${endpoint}`, {
         credentials,
     })
     if (!res.ok) {
-        throw new Error(`Request failed: ${res.status}`)
+        throw await toApiError(res)
     }
     return res.json() as Promise<T>
 }
+
+// withCursor adds the next_cursor of the previous page to a list endpoint
+export function withCursor(endpoint: string, cursor: string | null) {
+    if (!cursor) return endpoint
+    const separator = endpoint.includes('?') ? '&' : '?'
+    return `${endpoint}${separator}cursor=${encodeURIComponent(cursor)}`
+}
@@ -17,6 +17,13 @@ export interface Post {
     like_count: number;
     reply_count: number;
     liked_by_current_user: boolean;
+    // Search results only: HTML-escaped excerpt with matches in <mark>
+    snippet?: string;
+}
+
+export interface Page<T> {
+    items: T[];
+    next_cursor: string | null;
 }
 
 export interface Reply {
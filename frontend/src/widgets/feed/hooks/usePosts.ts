@@ -1,6 +1,6 @@
 import { useCallback, useState } from 'react'
-import { Post } from '@/shared/types'
-import { fetchJson } from '@/shared/api'
+import { Page, Post } from '@/shared/types'
+import { fetchJson, withCursor } from '@/shared/api'
 
 interface FetchOptions {
     endpoint: string
@@ -10,7 +10,9 @@ const defaultEndpoint = '/api/posts'
 
 export const usePosts = () => {
     const [posts, setPosts] = useState<Post[]>([])
+    const [nextCursor, setNextCursor] = useState<string | null>(null)
     const [loading, setLoading] = useState(false)
+    const [loadingMore, setLoadingMore] = useState(false)
     const [error, setError] = useState<string | null>(null)
     const [endpoint, setEndpoint] = useState<string>(defaultEndpoint)
 
@@ -18,18 +20,37 @@ export const usePosts = () => {
         setLoading(true)
         setError(null)
         try {
-            const data = await fetchJson<Post[]>(endpointToUse)
-            setPosts(data || [])
+            const data = await fetchJson<Page<Post>>(endpointToUse)
+            setPosts(data?.items || [])
+            setNextCursor(data?.next_cursor ?? null)
             setEndpoint(endpointToUse)
         } catch (err) {
             console.error(err)
             setError('Failed to load posts')
             setPosts([])
+            setNextCursor(null)
         } finally {
             setLoading(false)
         }
     }, [])
 
+    // loadMore appends the page after the last one loaded
+    const loadMore = useCallback(async () => {
+        if (!nextCursor || loadingMore) return
+        setLoadingMore(true)
+        setError(null)
+        try {
+            const data = await fetchJson<Page<Post>>(withCursor(endpoint, nextCursor))
+            setPosts(prev => [...prev, ...(data?.items || [])])
+            setNextCursor(data?.next_cursor ?? null)
+        } catch (err) {
+            console.error(err)
+            setError('Failed to load more posts')
+        } finally {
+            setLoadingMore(false)
+        }
+    }, [endpoint, nextCursor, loadingMore])
+
     const filterByUser = useCallback((userId: number) => {
         loadPosts(`${defaultEndpoint}?user_id=${userId}`)
     }, [loadPosts])
@@ -45,8 +66,11 @@ export const usePosts = () => {
     return {
         posts,
         loading,
+        loadingMore,
+        hasMore: nextCursor !== null,
         error,
         refresh,
+        loadMore,
         filterByUser,
         showAll,
     }
@@ -1,10 +1,12 @@
-import { useEffect, useState } from 'react'
+import { useCallback, useEffect, useState } from 'react'
 import { UserSummary } from '@/entities/user/types'
 import { fetchUsers } from '@/entities/user/api/users'
 
 export const useUsers = () => {
     const [users, setUsers] = useState<UserSummary[]>([])
+    const [nextCursor, setNextCursor] = useState<string | null>(null)
     const [loading, setLoading] = useState(false)
+    const [loadingMore, setLoadingMore] = useState(false)
     const [error, setError] = useState<string | null>(null)
 
     useEffect(() => {
@@ -13,11 +15,13 @@ export const useUsers = () => {
             setError(null)
             try {
                 const data = await fetchUsers()
-                setUsers(data)
+                setUsers(data.items)
+                setNextCursor(data.next_cursor)
             } catch (err) {
                 console.error(err)
                 setError('Failed to load users')
                 setUsers([])
+                setNextCursor(null)
             } finally {
                 setLoading(false)
             }
@@ -26,5 +30,22 @@ export const useUsers = () => {
         loadUsers()
     }, [])
 
-    return { users, loading, error }
+    // loadMore appends the page after the last one loaded
+    const loadMore = useCallback(async () => {
+        if (!nextCursor || loadingMore) return
+        setLoadingMore(true)
+        setError(null)
+        try {
+            const data = await fetchUsers(undefined, nextCursor)
+            setUsers(prev => [...prev, ...data.items])
+            setNextCursor(data.next_cursor)
+        } catch (err) {
+            console.error(err)
+            setError('Failed to load more users')
+        } finally {
+            setLoadingMore(false)
+        }
+    }, [nextCursor, loadingMore])
+
+    return { users, loading, loadingMore, hasMore: nextCursor !== null, error, loadMore }
 }